@@ -123,6 +123,25 @@ func (s *Snappy) Search(accountID int, query string, page int) (results SearchRe
 	return
 }
 
+// SearchAll walks every page of results for query and returns all of the tickets
+func (s *Snappy) SearchAll(accountID int, query string) (tickets []Ticket, err error) {
+	var results SearchResults
+
+	for page := 1; ; page++ {
+		results, err = s.Search(accountID, query, page)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tickets = append(tickets, results.Tickets...)
+
+		if len(results.Tickets) == 0 || len(tickets) >= results.Meta.Total {
+			return tickets, nil
+		}
+	}
+}
+
 // Documents gets all documents for an account
 func (s *Snappy) Documents(accountID int) (documents []Document, err error) {
 	up := urlAndParams{
@@ -178,7 +197,7 @@ type WallComment struct {
 	WallPostID      int    `json:"post_id"`
 	StaffID         int    `json:"staff_id"`
 	Content         string `json:"content"`
-	ContentMarkdown string `json:"content"`
+	ContentMarkdown string `json:"content_markdown"`
 
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
@@ -214,6 +233,11 @@ func (s *Snappy) LikeWallPost(accountID, wallPostID int) (err error) {
 	}
 
 	rc, err := s.post(up, "", nil)
+
+	if err != nil {
+		return
+	}
+
 	defer rc.Close()
 
 	return
@@ -226,6 +250,11 @@ func (s *Snappy) UnlikeWallPost(accountID, wallPostID int) (err error) {
 	}
 
 	rc, err := s.del(up)
+
+	if err != nil {
+		return
+	}
+
 	defer rc.Close()
 
 	return
@@ -240,6 +269,11 @@ func (s *Snappy) CommentWallPost(accountID, wallPostID int, comment string) (err
 	rc, err := s.postForm(up, map[string][]string{
 		"content": []string{comment},
 	})
+
+	if err != nil {
+		return
+	}
+
 	defer rc.Close()
 
 	return
@@ -252,18 +286,34 @@ func (s *Snappy) DeleteComment(accountID, wallPostID, commentID int) (err error)
 	}
 
 	rc, err := s.del(up)
+
+	if err != nil {
+		return
+	}
+
 	defer rc.Close()
 
 	return
 }
 
-// CreateWallPost creates a wall post using NewWallPost
+// CreateWallPost creates a wall post using NewWallPost, after checking it
+// with Validate
 func (s *Snappy) CreateWallPost(accountID int, newPost NewWallPost) (err error) {
+	if err = newPost.Validate(); err != nil {
+		return
+	}
+
 	up := urlAndParams{
 		url: fmt.Sprintf("/account/%d/wall", accountID),
 	}
 
-	_, err = s.postAsJSON(up, newPost)
+	rc, err := s.postAsJSON(up, newPost)
+
+	if err != nil {
+		return
+	}
+
+	defer rc.Close()
 
 	return
 }
@@ -275,6 +325,11 @@ func (s *Snappy) DeleteWallPost(accountID, wallPostID int) (err error) {
 	}
 
 	rc, err := s.del(up)
+
+	if err != nil {
+		return
+	}
+
 	defer rc.Close()
 
 	return
@@ -458,6 +458,38 @@ func TestSearch(t *testing.T) {
 	// TODO: deep equal of returned ticket result
 }
 
+func TestSearchAll(t *testing.T) {
+	setup()
+	defer teardown()
+
+	pages := 0
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		q := r.URL.Query()
+
+		if q["page"][0] != fmt.Sprint(pages) {
+			t.Errorf("Expected SearchAll to ask for page %d", pages)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"meta":{"total":3,"page":"%d"},"data":[{"id":%d},{"id":%d}]}`, pages, pages*2-1, pages*2)
+	})
+
+	got, err := client.SearchAll(1, "test")
+
+	if err != nil {
+		t.Error("Expected no error in SearchAll()")
+	}
+
+	if pages != 2 {
+		t.Errorf("Expected 2 pages to be fetched, got %d", pages)
+	}
+
+	if len(got) != 4 || got[3].ID != 4 {
+		t.Errorf("Expected the tickets from both pages, got %v", got)
+	}
+}
+
 func TestDocuments(t *testing.T) {
 	setup()
 	defer teardown()
@@ -0,0 +1,285 @@
+// Package assign hands new tickets out to staff. An Assigner takes the
+// unassigned tickets of a mailbox inbox and gives each one to an available
+// staff member chosen by a Strategy: RoundRobin, LeastLoaded or Skills.
+//
+// Snappy assigns a ticket by tagging it "@username", so a ticket counts as
+// new when it has no "@" tag, and a staff member's load is the number of
+// open tickets tagged with their username. The rotation is kept in a State
+// that can be saved to a file, so restarts don't reset whose turn it is.
+package assign
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/calendar"
+	"github.com/derekpitt/snappy/internal/atomicfile"
+)
+
+// State is what an Assigner remembers between runs
+type State struct {
+	// Last is the username the last ticket went to
+	Last string `json:"last"`
+
+	// Assigned counts the tickets given to each username so far
+	Assigned map[string]int `json:"assigned"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LoadState reads a State from a file. A missing file is an empty State
+func LoadState(path string) (s *State, err error) {
+	s = &State{Assigned: map[string]int{}}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("assign: %s: %v", path, err)
+	}
+
+	if s.Assigned == nil {
+		s.Assigned = map[string]int{}
+	}
+
+	return
+}
+
+// Save writes a State to a file. It writes a temporary file first and
+// renames it into place so a crash never leaves a half written state behind
+func (s *State) Save(path string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(path, b, 0644)
+}
+
+// Assignment is a ticket given to someone, or left alone when Username is
+// empty
+type Assignment struct {
+	TicketID int    `json:"ticket_id"`
+	Username string `json:"username"`
+	DryRun   bool   `json:"dry_run"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Assigner gives new tickets to staff
+type Assigner struct {
+	Client    *snappy.Snappy
+	AccountID int
+	Strategy  Strategy
+
+	// Staff are the people tickets can go to, fetched from the account when nil
+	Staff []snappy.Employee
+
+	// Available holds the usernames that can take tickets right now, nil
+	// means everyone. See OnShift
+	Available map[string]bool
+
+	// Loads are the open tickets of each username. When nil they are counted
+	// from the inbox and waiting listings of the mailbox being assigned
+	Loads map[string]int
+
+	// State is the rotation, loaded from StatePath when nil
+	State *State
+
+	// StatePath is where State is saved after every assignment, when set
+	StatePath string
+
+	// DryRun works out the assignments without making them or saving state
+	DryRun bool
+
+	// Now is time.Now unless set
+	Now func() time.Time
+}
+
+// New creates an Assigner
+func New(client *snappy.Snappy, accountID int, strategy Strategy) *Assigner {
+	return &Assigner{
+		Client:    client,
+		AccountID: accountID,
+		Strategy:  strategy,
+	}
+}
+
+func (a *Assigner) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+	return time.Now()
+}
+
+// IsNew reports whether a ticket is unassigned, that is has no "@" tag
+func IsNew(t snappy.Ticket) bool {
+	for _, tag := range t.Tags {
+		if strings.HasPrefix(tag, "@") {
+			return false
+		}
+	}
+	return true
+}
+
+// CountLoads counts the tickets assigned to each username. Tickets are
+// counted once however many listings they appear in
+func CountLoads(tickets []snappy.Ticket) map[string]int {
+	loads := map[string]int{}
+	seen := map[int]bool{}
+
+	for _, t := range tickets {
+		if seen[t.ID] {
+			continue
+		}
+		seen[t.ID] = true
+
+		for _, tag := range t.Tags {
+			if strings.HasPrefix(tag, "@") {
+				loads[strings.ToLower(tag[1:])]++
+			}
+		}
+	}
+
+	return loads
+}
+
+// OnShift returns the usernames of the staff working at now, going by the
+// time zone of each (see calendar.ForEmployee, staff without one are in
+// UTC). Staff whose time zone can't be loaded are left out
+func OnShift(staff []snappy.Employee, now time.Time) map[string]bool {
+	available := map[string]bool{}
+	for _, e := range staff {
+		c, err := calendar.ForEmployee(e)
+		if err == nil && c.IsWorking(now) {
+			available[e.UserName] = true
+		}
+	}
+	return available
+}
+
+// candidates returns the available staff ordered by username
+func (a *Assigner) candidates(staff []snappy.Employee) []snappy.Employee {
+	var result []snappy.Employee
+	for _, e := range staff {
+		if e.UserName == "" {
+			continue
+		}
+		if a.Available != nil && !a.Available[e.UserName] {
+			continue
+		}
+		result = append(result, e)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].UserName < result[j].UserName })
+	return result
+}
+
+// Run assigns the new tickets in the inbox of a mailbox. Tickets nobody
+// could be picked for, or whose tags couldn't be updated, are returned with
+// an Error and left for the next run
+func (a *Assigner) Run(mailboxID int) (assignments []Assignment, err error) {
+	staff := a.Staff
+	if staff == nil {
+		if staff, err = a.Client.Staff(a.AccountID); err != nil {
+			return nil, fmt.Errorf("assign: staff: %v", err)
+		}
+	}
+
+	if a.State == nil {
+		a.State = &State{Assigned: map[string]int{}}
+		if a.StatePath != "" {
+			if a.State, err = LoadState(a.StatePath); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	inbox, err := a.Client.InboxAtMailbox(mailboxID)
+	if err != nil {
+		return nil, fmt.Errorf("assign: inbox of mailbox %d: %v", mailboxID, err)
+	}
+
+	loads := map[string]int{}
+	if a.Loads != nil {
+		for k, v := range a.Loads {
+			loads[strings.ToLower(k)] = v
+		}
+	} else {
+		waiting, err := a.Client.WaitingAtMailbox(mailboxID)
+		if err != nil {
+			return nil, fmt.Errorf("assign: waiting tickets of mailbox %d: %v", mailboxID, err)
+		}
+		loads = CountLoads(append(append([]snappy.Ticket{}, inbox...), waiting...))
+	}
+
+	candidates := a.candidates(staff)
+
+	// a dry run works on a copy, so it doesn't move the rotation
+	state := a.State
+	if a.DryRun {
+		copied := *a.State
+		copied.Assigned = map[string]int{}
+		for k, v := range a.State.Assigned {
+			copied.Assigned[k] = v
+		}
+		state = &copied
+	}
+
+	for _, t := range inbox {
+		if !IsNew(t) {
+			continue
+		}
+
+		assignment := Assignment{TicketID: t.ID, DryRun: a.DryRun}
+
+		// loads are counted by lowercased username, strategies get them by username
+		byUser := map[string]int{}
+		for _, e := range candidates {
+			byUser[e.UserName] = loads[strings.ToLower(e.UserName)]
+		}
+
+		e, ok := a.Strategy.Pick(t, candidates, byUser, state.Last)
+		if !ok {
+			assignment.Error = "no one to assign to"
+			assignments = append(assignments, assignment)
+			continue
+		}
+
+		assignment.Username = e.UserName
+
+		if !a.DryRun {
+			if err := a.Client.UpdateTags(t.ID, append(append([]string{}, t.Tags...), "@"+e.UserName)...); err != nil {
+				assignment.Error = err.Error()
+				assignments = append(assignments, assignment)
+				continue
+			}
+		}
+
+		loads[strings.ToLower(e.UserName)]++
+		state.Last = e.UserName
+		state.Assigned[e.UserName]++
+		state.UpdatedAt = a.now()
+
+		assignments = append(assignments, assignment)
+
+		if a.StatePath != "" && !a.DryRun {
+			if err = state.Save(a.StatePath); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,201 @@
+package assign
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+var (
+	mux    *http.ServeMux
+	server *httptest.Server
+	client *snappy.Snappy
+)
+
+func setup() {
+	mux = http.NewServeMux()
+	server = httptest.NewServer(mux)
+
+	client = snappy.WithAPIKey("apikey")
+	client.SetEndpointPrefix(server.URL)
+}
+
+func teardown() {
+	server.Close()
+}
+
+func join(s []string) string {
+	return strings.Join(s, " ")
+}
+
+// handleMailbox serves an inbox of three new tickets and one of sam's, and
+// records the tags each ticket is given
+func handleMailbox(tagged map[int][]string) {
+	mux.HandleFunc("/account/1/staff", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":1,"username":"alex"},{"id":2,"username":"sam"},{"id":3,"username":"kim"}]`)
+	})
+	mux.HandleFunc("/mailbox/2/inbox", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":10,"tags":["#billing"]},{"id":11},{"id":12,"tags":["@Sam"]},{"id":13}]`)
+	})
+	mux.HandleFunc("/mailbox/2/tickets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":12,"tags":["@Sam"]},{"id":14,"tags":["@alex"]},{"id":15,"tags":["@alex"]}]`)
+	})
+	for _, id := range []int{10, 11, 13} {
+		id := id
+		mux.HandleFunc(fmt.Sprintf("/ticket/%d/tags", id), func(w http.ResponseWriter, r *http.Request) {
+			var tags []string
+			r.ParseForm()
+			json.Unmarshal([]byte(r.PostForm.Get("tags")), &tags)
+			tagged[id] = tags
+		})
+	}
+}
+
+func TestRunLeastLoaded(t *testing.T) {
+	setup()
+	defer teardown()
+
+	tagged := map[int][]string{}
+	handleMailbox(tagged)
+
+	dir, err := ioutil.TempDir("", "assign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := New(client, 1, LeastLoaded{})
+	a.StatePath = filepath.Join(dir, "state.json")
+	a.Now = func() time.Time { return time.Date(2014, 1, 2, 12, 0, 0, 0, time.UTC) }
+
+	assignments, err := a.Run(2)
+	if err != nil {
+		t.Fatalf("Expected no error in Run(), got %v", err)
+	}
+
+	// alex has 2 open tickets and sam 1, so kim goes first
+	expected := []Assignment{
+		{TicketID: 10, Username: "kim"},
+		{TicketID: 11, Username: "sam"},
+		{TicketID: 13, Username: "kim"},
+	}
+	if reflect.DeepEqual(expected, assignments) == false {
+		t.Errorf("Expected %+v, got %+v", expected, assignments)
+	}
+
+	if expected := []string{"#billing", "@kim"}; reflect.DeepEqual(expected, tagged[10]) == false {
+		t.Errorf("Expected tags %v, got %v", expected, tagged[10])
+	}
+
+	state, err := LoadState(a.StatePath)
+	if err != nil {
+		t.Fatalf("Expected no error in LoadState(), got %v", err)
+	}
+	if state.Last != "kim" || state.Assigned["kim"] != 2 || state.Assigned["sam"] != 1 {
+		t.Errorf("Unexpected saved state %+v", state)
+	}
+}
+
+func TestRunKeepsRotation(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleMailbox(map[int][]string{})
+
+	dir, err := ioutil.TempDir("", "assign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	(&State{Last: "alex"}).Save(path)
+
+	// a new Assigner, as after a restart, carries on after alex
+	a := New(client, 1, RoundRobin{})
+	a.StatePath = path
+	a.Available = map[string]bool{"alex": true, "sam": true}
+
+	assignments, err := a.Run(2)
+	if err != nil {
+		t.Fatalf("Expected no error in Run(), got %v", err)
+	}
+
+	var got []string
+	for _, as := range assignments {
+		got = append(got, as.Username)
+	}
+	if expected := "sam alex sam"; join(got) != expected {
+		t.Errorf("Expected %q, got %q", expected, join(got))
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	setup()
+	defer teardown()
+
+	tagged := map[int][]string{}
+	handleMailbox(tagged)
+
+	a := New(client, 1, Skills{Skills: map[string][]string{"sam": {"#billing"}}})
+	a.DryRun = true
+	a.State = &State{Last: "alex", Assigned: map[string]int{}}
+
+	assignments, err := a.Run(2)
+	if err != nil {
+		t.Fatalf("Expected no error in Run(), got %v", err)
+	}
+
+	expected := []Assignment{
+		{TicketID: 10, Username: "sam", DryRun: true},
+		{TicketID: 11, DryRun: true, Error: "no one to assign to"},
+		{TicketID: 13, DryRun: true, Error: "no one to assign to"},
+	}
+	if reflect.DeepEqual(expected, assignments) == false {
+		t.Errorf("Expected %+v, got %+v", expected, assignments)
+	}
+
+	if len(tagged) != 0 || a.State.Last != "alex" {
+		t.Errorf("Expected a dry run to change nothing, got tags %v and state %+v", tagged, a.State)
+	}
+}
+
+func TestCountLoads(t *testing.T) {
+	loads := CountLoads([]snappy.Ticket{
+		{ID: 1, Tags: []string{"@Sam", "#billing"}},
+		{ID: 1, Tags: []string{"@Sam", "#billing"}},
+		{ID: 2, Tags: []string{"@sam"}},
+		{ID: 3, Tags: []string{"@alex"}},
+		{ID: 4},
+	})
+
+	if expected := map[string]int{"sam": 2, "alex": 1}; reflect.DeepEqual(expected, loads) == false {
+		t.Errorf("Expected %v, got %v", expected, loads)
+	}
+}
+
+func TestOnShift(t *testing.T) {
+	staff := []snappy.Employee{
+		{UserName: "london", TimeZone: "Europe/London"},
+		{UserName: "tokyo", TimeZone: "Asia/Tokyo"},
+		{UserName: "utc"},
+		{UserName: "nowhere", TimeZone: "Nowhere/Special"},
+	}
+
+	// a Thursday, 10am in London and UTC and 7pm in Tokyo
+	available := OnShift(staff, time.Date(2014, 1, 2, 10, 0, 0, 0, time.UTC))
+
+	if expected := map[string]bool{"london": true, "utc": true}; reflect.DeepEqual(expected, available) == false {
+		t.Errorf("Expected %v, got %v", expected, available)
+	}
+}
@@ -0,0 +1,106 @@
+package assign
+
+import (
+	"strings"
+
+	"github.com/derekpitt/snappy"
+)
+
+// Strategy picks who a ticket goes to. Candidates are the available staff,
+// ordered by username, loads are how many open tickets each username has,
+// and last is the username the previous ticket went to
+type Strategy interface {
+	Pick(t snappy.Ticket, candidates []snappy.Employee, loads map[string]int, last string) (snappy.Employee, bool)
+}
+
+// rotate orders candidates starting after the username last, wrapping
+// around, so every candidate gets a turn even when last has since left or
+// become unavailable
+func rotate(candidates []snappy.Employee, last string) []snappy.Employee {
+	start := 0
+	for i, e := range candidates {
+		if e.UserName > last {
+			start = i
+			break
+		}
+	}
+
+	return append(append([]snappy.Employee{}, candidates[start:]...), candidates[:start]...)
+}
+
+// RoundRobin gives tickets to each candidate in turn
+type RoundRobin struct{}
+
+// Pick returns the candidate after last
+func (RoundRobin) Pick(t snappy.Ticket, candidates []snappy.Employee, loads map[string]int, last string) (snappy.Employee, bool) {
+	if len(candidates) == 0 {
+		return snappy.Employee{}, false
+	}
+	return rotate(candidates, last)[0], true
+}
+
+// LeastLoaded gives tickets to the candidate with the fewest open tickets.
+// Ties go round-robin
+type LeastLoaded struct{}
+
+// Pick returns the candidate with the lowest load
+func (LeastLoaded) Pick(t snappy.Ticket, candidates []snappy.Employee, loads map[string]int, last string) (snappy.Employee, bool) {
+	var best snappy.Employee
+	found := false
+
+	for _, e := range rotate(candidates, last) {
+		if !found || loads[e.UserName] < loads[best.UserName] {
+			best, found = e, true
+		}
+	}
+
+	return best, found
+}
+
+// Skills gives tickets to the staff whose skills, which are tags, are on
+// the ticket
+type Skills struct {
+	// Skills maps usernames to the tags they handle, e.g. "sam": {"#billing"}
+	Skills map[string][]string
+
+	// Then picks between the staff with a matching skill, LeastLoaded when nil
+	Then Strategy
+
+	// Fallback picks between all candidates when nobody has a matching skill.
+	// When nil those tickets are left unassigned
+	Fallback Strategy
+}
+
+// Pick returns a candidate skilled in one of the ticket's tags
+func (s Skills) Pick(t snappy.Ticket, candidates []snappy.Employee, loads map[string]int, last string) (snappy.Employee, bool) {
+	var skilled []snappy.Employee
+	for _, e := range candidates {
+		if hasSkill(s.Skills[e.UserName], t.Tags) {
+			skilled = append(skilled, e)
+		}
+	}
+
+	if len(skilled) == 0 {
+		if s.Fallback == nil {
+			return snappy.Employee{}, false
+		}
+		return s.Fallback.Pick(t, candidates, loads, last)
+	}
+
+	then := s.Then
+	if then == nil {
+		then = LeastLoaded{}
+	}
+	return then.Pick(t, skilled, loads, last)
+}
+
+func hasSkill(skills, tags []string) bool {
+	for _, skill := range skills {
+		for _, tag := range tags {
+			if strings.EqualFold(skill, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
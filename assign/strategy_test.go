@@ -0,0 +1,95 @@
+package assign
+
+import (
+	"testing"
+
+	"github.com/derekpitt/snappy"
+)
+
+var staff = []snappy.Employee{
+	{ID: 1, UserName: "alex"},
+	{ID: 2, UserName: "sam"},
+	{ID: 3, UserName: "kim"},
+}
+
+func names(candidates []snappy.Employee) (result []string) {
+	for _, e := range candidates {
+		result = append(result, e.UserName)
+	}
+	return
+}
+
+func TestRoundRobin(t *testing.T) {
+	candidates := (&Assigner{}).candidates(staff)
+
+	var got []string
+	last := "kim"
+	for i := 0; i < 4; i++ {
+		e, ok := RoundRobin{}.Pick(snappy.Ticket{}, candidates, nil, last)
+		if !ok {
+			t.Fatalf("Expected a pick")
+		}
+		got = append(got, e.UserName)
+		last = e.UserName
+	}
+
+	if expected := "sam alex kim sam"; expected != join(got) {
+		t.Errorf("Expected %q, got %q", expected, join(got))
+	}
+
+	// the last pick has left, so the turn goes to whoever is next after them
+	e, _ := RoundRobin{}.Pick(snappy.Ticket{}, candidates, nil, "bob")
+	if e.UserName != "kim" {
+		t.Errorf("Expected kim after bob, got %s", e.UserName)
+	}
+
+	if _, ok := (RoundRobin{}).Pick(snappy.Ticket{}, nil, nil, ""); ok {
+		t.Errorf("Expected no pick without candidates")
+	}
+}
+
+func TestLeastLoaded(t *testing.T) {
+	candidates := (&Assigner{}).candidates(staff)
+
+	e, _ := LeastLoaded{}.Pick(snappy.Ticket{}, candidates, map[string]int{"alex": 3, "kim": 1, "sam": 2}, "")
+	if e.UserName != "kim" {
+		t.Errorf("Expected kim, got %s", e.UserName)
+	}
+
+	// ties go to whoever is next in the rotation
+	e, _ = LeastLoaded{}.Pick(snappy.Ticket{}, candidates, map[string]int{"alex": 1, "kim": 1, "sam": 1}, "alex")
+	if e.UserName != "kim" {
+		t.Errorf("Expected kim after alex, got %s", e.UserName)
+	}
+}
+
+func TestSkills(t *testing.T) {
+	candidates := (&Assigner{}).candidates(staff)
+	s := Skills{Skills: map[string][]string{"sam": {"#billing"}, "kim": {"#Billing", "#api"}}}
+	loads := map[string]int{"sam": 2, "kim": 1}
+
+	e, ok := s.Pick(snappy.Ticket{Tags: []string{"#BILLING"}}, candidates, loads, "")
+	if !ok || e.UserName != "kim" {
+		t.Errorf("Expected kim, got %s", e.UserName)
+	}
+
+	if _, ok := s.Pick(snappy.Ticket{Tags: []string{"#sales"}}, candidates, loads, ""); ok {
+		t.Errorf("Expected no pick without a skill or fallback")
+	}
+
+	s.Fallback = LeastLoaded{}
+	if e, _ := s.Pick(snappy.Ticket{Tags: []string{"#sales"}}, candidates, loads, ""); e.UserName != "alex" {
+		t.Errorf("Expected the fallback to pick alex, got %s", e.UserName)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	candidates := (&Assigner{}).candidates(staff)
+
+	if got := join(names(rotate(candidates, "alex"))); got != "kim sam alex" {
+		t.Errorf("Expected kim sam alex, got %q", got)
+	}
+	if got := join(names(rotate(candidates, "zed"))); got != "alex kim sam" {
+		t.Errorf("Expected alex kim sam, got %q", got)
+	}
+}
@@ -0,0 +1,325 @@
+// Package calendar describes business hours so ticket ages and response
+// time targets can leave out nights, weekends and holidays.
+package calendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+const dateLayout = "2006-01-02"
+
+// maxDays is how far Add looks ahead before giving up
+const maxDays = 3660
+
+// Hours is a span of working time within a day, as offsets from midnight
+type Hours struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseHours parses spans written like "09:00-17:00"
+func ParseHours(s string) (h Hours, err error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 2 {
+		err = fmt.Errorf("calendar: bad hours %q", s)
+		return
+	}
+
+	if h.Start, err = parseClock(parts[0]); err != nil {
+		return
+	}
+
+	if h.End, err = parseClock(parts[1]); err != nil {
+		return
+	}
+
+	if h.End <= h.Start {
+		err = fmt.Errorf("calendar: hours %q end before they start", s)
+	}
+
+	return
+}
+
+func parseClock(s string) (time.Duration, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &hour, &minute); err != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("calendar: bad time of day %q", s)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+func (h Hours) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+	return clock(h.Start) + "-" + clock(h.End)
+}
+
+// Calendar holds the working hours of each weekday in a time zone, and the
+// days that are holidays
+type Calendar struct {
+	// Location is the time zone of the hours, UTC when nil
+	Location *time.Location
+	Week     [7][]Hours
+
+	holidays map[string]bool
+}
+
+// New creates a calendar with no working hours
+func New(loc *time.Location) *Calendar {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Calendar{Location: loc, holidays: map[string]bool{}}
+}
+
+// Standard creates a calendar that works 9 to 5, Monday to Friday
+func Standard(loc *time.Location) *Calendar {
+	c := New(loc)
+	for day := time.Monday; day <= time.Friday; day++ {
+		c.SetHours(day, Hours{Start: 9 * time.Hour, End: 17 * time.Hour})
+	}
+	return c
+}
+
+// ForEmployee creates a Standard calendar in an employee's time zone.
+// Employee.TimeZone has to be an IANA name like "America/Chicago"
+func ForEmployee(e snappy.Employee) (*Calendar, error) {
+	if e.TimeZone == "" {
+		return Standard(time.UTC), nil
+	}
+
+	loc, err := time.LoadLocation(e.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("calendar: time zone of %s: %v", e.Email, err)
+	}
+
+	return Standard(loc), nil
+}
+
+// SetHours replaces the working hours of a weekday. No hours makes it a day off
+func (c *Calendar) SetHours(day time.Weekday, hours ...Hours) {
+	sorted := append([]Hours{}, hours...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	c.Week[day] = sorted
+}
+
+// AddHoliday marks a date as a day off
+func (c *Calendar) AddHoliday(year int, month time.Month, day int) {
+	if c.holidays == nil {
+		c.holidays = map[string]bool{}
+	}
+	c.holidays[time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Format(dateLayout)] = true
+}
+
+// Holidays lists the holidays in order
+func (c *Calendar) Holidays() []string {
+	var days []string
+	for d := range c.holidays {
+		days = append(days, d)
+	}
+	sort.Strings(days)
+	return days
+}
+
+// IsHoliday reports whether t falls on a holiday
+func (c *Calendar) IsHoliday(t time.Time) bool {
+	return c.holidays[t.In(c.location()).Format(dateLayout)]
+}
+
+// spans returns the working spans of the day t falls on
+func (c *Calendar) spans(t time.Time) [][2]time.Time {
+	t = t.In(c.location())
+	if c.IsHoliday(t) {
+		return nil
+	}
+
+	y, m, d := t.Date()
+	at := func(offset time.Duration) time.Time {
+		// built from the wall clock so days that change to or from
+		// daylight saving time still start work at the right hour
+		return time.Date(y, m, d, 0, 0, int(offset/time.Second), 0, c.location())
+	}
+
+	var spans [][2]time.Time
+	for _, h := range c.Week[t.Weekday()] {
+		spans = append(spans, [2]time.Time{at(h.Start), at(h.End)})
+	}
+	return spans
+}
+
+// nextDay returns midnight of the day after t
+func (c *Calendar) nextDay(t time.Time) time.Time {
+	y, m, d := t.In(c.location()).Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, c.location())
+}
+
+func (c *Calendar) location() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+	return c.Location
+}
+
+func (c *Calendar) hasHours() bool {
+	for _, hours := range c.Week {
+		if len(hours) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// IsWorking reports whether t is within working hours
+func (c *Calendar) IsWorking(t time.Time) bool {
+	for _, s := range c.spans(t) {
+		if !t.Before(s[0]) && t.Before(s[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Duration returns how much working time there is between from and to
+func (c *Calendar) Duration(from, to time.Time) time.Duration {
+	var total time.Duration
+
+	for day := from; day.Before(to); day = c.nextDay(day) {
+		for _, s := range c.spans(day) {
+			start, end := s[0], s[1]
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if end.After(start) {
+				total += end.Sub(start)
+			}
+		}
+	}
+
+	return total
+}
+
+// Add returns the time d working time after from, e.g. when a target is
+// due. It returns the zero time when the calendar never works
+func (c *Calendar) Add(from time.Time, d time.Duration) time.Time {
+	if !c.hasHours() {
+		return time.Time{}
+	}
+
+	day := from
+	for i := 0; i < maxDays; i++ {
+		for _, s := range c.spans(day) {
+			start, end := s[0], s[1]
+			if start.Before(from) {
+				start = from
+			}
+			if !end.After(start) {
+				continue
+			}
+			left := end.Sub(start)
+			if d <= left {
+				return start.Add(d)
+			}
+			d -= left
+		}
+		day = c.nextDay(day)
+	}
+
+	return time.Time{}
+}
+
+// Age returns the working time since a ticket was opened
+func (c *Calendar) Age(t snappy.Ticket, now time.Time) time.Duration {
+	return c.Duration(time.Unix(int64(t.OpenedAt), 0), now)
+}
+
+type calendarJSON struct {
+	TimeZone string              `json:"time_zone"`
+	Hours    map[string][]string `json:"hours"`
+	Holidays []string            `json:"holidays,omitempty"`
+}
+
+// MarshalJSON writes a calendar like
+//
+//	{"time_zone": "Europe/London",
+//	 "hours": {"monday": ["09:00-12:00", "13:00-17:00"], ...},
+//	 "holidays": ["2014-12-25"]}
+func (c *Calendar) MarshalJSON() ([]byte, error) {
+	j := calendarJSON{
+		TimeZone: c.location().String(),
+		Hours:    map[string][]string{},
+		Holidays: c.Holidays(),
+	}
+
+	for day, hours := range c.Week {
+		for _, h := range hours {
+			name := strings.ToLower(time.Weekday(day).String())
+			j.Hours[name] = append(j.Hours[name], h.String())
+		}
+	}
+
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON reads a calendar written by MarshalJSON
+func (c *Calendar) UnmarshalJSON(b []byte) (err error) {
+	var j calendarJSON
+	if err = json.Unmarshal(b, &j); err != nil {
+		return
+	}
+
+	loc := time.UTC
+	if j.TimeZone != "" {
+		if loc, err = time.LoadLocation(j.TimeZone); err != nil {
+			return
+		}
+	}
+
+	cal := New(loc)
+
+	for name, spans := range j.Hours {
+		day, ok := weekday(name)
+		if !ok {
+			return fmt.Errorf("calendar: unknown day %q", name)
+		}
+
+		var hours []Hours
+		for _, s := range spans {
+			h, err := ParseHours(s)
+			if err != nil {
+				return err
+			}
+			hours = append(hours, h)
+		}
+		cal.SetHours(day, hours...)
+	}
+
+	for _, s := range j.Holidays {
+		d, err := time.Parse(dateLayout, s)
+		if err != nil {
+			return fmt.Errorf("calendar: bad holiday %q", s)
+		}
+		cal.AddHoliday(d.Date())
+	}
+
+	*c = *cal
+	return
+}
+
+func weekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(name, day.String()) || strings.EqualFold(name, day.String()[:3]) {
+			return day, true
+		}
+	}
+	return 0, false
+}
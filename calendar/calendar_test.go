@@ -0,0 +1,174 @@
+package calendar
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02 15:04", s)
+	return t
+}
+
+func TestParseHours(t *testing.T) {
+	h, err := ParseHours("09:30-17:00")
+	if err != nil {
+		t.Fatalf("Expected no error in ParseHours(), got %v", err)
+	}
+
+	if expected := (Hours{Start: 9*time.Hour + 30*time.Minute, End: 17 * time.Hour}); h != expected {
+		t.Errorf("Expected %v, got %v", expected, h)
+	}
+
+	for _, bad := range []string{"9-5", "17:00-09:00", "09:00", "25:00-26:00"} {
+		if _, err := ParseHours(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	c := Standard(time.UTC)
+	c.AddHoliday(2014, time.January, 1)
+
+	cases := []struct {
+		from, to string
+		expected time.Duration
+	}{
+		// Thursday morning to afternoon
+		{"2014-01-02 10:00", "2014-01-02 15:30", 5*time.Hour + 30*time.Minute},
+		// overnight only counts the working hours either side
+		{"2014-01-02 16:00", "2014-01-03 10:00", 2 * time.Hour},
+		// Friday afternoon to Monday morning skips the weekend
+		{"2014-01-03 16:00", "2014-01-06 09:30", 90 * time.Minute},
+		// New Year's Day is a holiday
+		{"2013-12-31 16:00", "2014-01-02 10:00", 2 * time.Hour},
+		{"2014-01-04 10:00", "2014-01-05 10:00", 0},
+		{"2014-01-03 10:00", "2014-01-02 10:00", 0},
+	}
+
+	for _, tc := range cases {
+		if got := c.Duration(date(tc.from), date(tc.to)); got != tc.expected {
+			t.Errorf("Duration(%s, %s): expected %v, got %v", tc.from, tc.to, tc.expected, got)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	c := Standard(time.UTC)
+	c.AddHoliday(2014, time.January, 6)
+
+	cases := []struct {
+		from     string
+		d        time.Duration
+		expected string
+	}{
+		{"2014-01-02 10:00", 2 * time.Hour, "2014-01-02 12:00"},
+		{"2014-01-02 16:00", 2 * time.Hour, "2014-01-03 10:00"},
+		// Friday afternoon plus four hours lands on Tuesday, Monday is a holiday
+		{"2014-01-03 15:00", 4 * time.Hour, "2014-01-07 11:00"},
+		// opened on a Saturday, the clock starts on Tuesday
+		{"2014-01-04 12:00", time.Hour, "2014-01-07 10:00"},
+	}
+
+	for _, tc := range cases {
+		if got := c.Add(date(tc.from), tc.d); !got.Equal(date(tc.expected)) {
+			t.Errorf("Add(%s, %v): expected %s, got %s", tc.from, tc.d, tc.expected, got)
+		}
+	}
+
+	if got := New(time.UTC).Add(date("2014-01-02 10:00"), time.Hour); !got.IsZero() {
+		t.Errorf("Expected the zero time from a calendar without hours, got %v", got)
+	}
+}
+
+func TestTimeZones(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+
+	c, err := ForEmployee(snappy.Employee{TimeZone: "America/New_York"})
+	if err != nil {
+		t.Fatalf("Expected no error in ForEmployee(), got %v", err)
+	}
+
+	// 14:00 UTC is 09:00 in New York in January
+	if c.IsWorking(date("2014-01-02 13:59")) || !c.IsWorking(date("2014-01-02 14:00")) {
+		t.Errorf("Expected work to start at 9 New York time")
+	}
+
+	// after the clocks go forward work still starts at 9 local time
+	if c.IsWorking(date("2014-03-10 12:59")) || !c.IsWorking(date("2014-03-10 13:00")) {
+		t.Errorf("Expected work to start at 9 New York daylight time")
+	}
+
+	// the night the clocks go forward is an hour shorter
+	c.SetHours(time.Sunday, Hours{Start: time.Hour, End: 5 * time.Hour})
+	if got := c.Duration(time.Date(2014, 3, 9, 0, 0, 0, 0, ny), time.Date(2014, 3, 10, 0, 0, 0, 0, ny)); got != 3*time.Hour {
+		t.Errorf("Expected 3 hours across the DST change, got %v", got)
+	}
+
+	if _, err := ForEmployee(snappy.Employee{TimeZone: "Nowhere/Special"}); err == nil {
+		t.Errorf("Expected an error for an unknown time zone")
+	}
+}
+
+func TestZeroCalendar(t *testing.T) {
+	var c Calendar
+	c.SetHours(time.Thursday, Hours{Start: 9 * time.Hour, End: 17 * time.Hour})
+
+	// without a Location the hours are UTC
+	if got := c.Duration(date("2014-01-02 08:00"), date("2014-01-02 10:00")); got != time.Hour {
+		t.Errorf("Expected an hour, got %v", got)
+	}
+
+	if got := c.Add(date("2014-01-02 08:00"), time.Hour); !got.Equal(date("2014-01-02 10:00")) {
+		t.Errorf("Expected 10:00, got %v", got)
+	}
+}
+
+func TestAge(t *testing.T) {
+	c := Standard(time.UTC)
+	ticket := snappy.Ticket{OpenedAt: int(date("2014-01-03 16:00").Unix())}
+
+	if got := c.Age(ticket, date("2014-01-06 10:00")); got != 2*time.Hour {
+		t.Errorf("Expected an age of 2 hours, got %v", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	in := `{"time_zone":"UTC","hours":{"mon":["13:00-17:00","09:00-12:00"],"Saturday":["10:00-14:00"]},"holidays":["2014-12-25"]}`
+
+	var c Calendar
+	if err := json.Unmarshal([]byte(in), &c); err != nil {
+		t.Fatalf("Expected no error in Unmarshal(), got %v", err)
+	}
+
+	expected := []Hours{{9 * time.Hour, 12 * time.Hour}, {13 * time.Hour, 17 * time.Hour}}
+	if reflect.DeepEqual(expected, c.Week[time.Monday]) == false {
+		t.Errorf("Expected monday hours %v, got %v", expected, c.Week[time.Monday])
+	}
+
+	if !c.IsHoliday(date("2014-12-25 12:00")) {
+		t.Errorf("Expected christmas to be a holiday")
+	}
+
+	b, err := json.Marshal(&c)
+	if err != nil {
+		t.Fatalf("Expected no error in Marshal(), got %v", err)
+	}
+
+	expectedJSON := `{"time_zone":"UTC","hours":{"monday":["09:00-12:00","13:00-17:00"],"saturday":["10:00-14:00"]},"holidays":["2014-12-25"]}`
+	if string(b) != expectedJSON {
+		t.Errorf("Expected %s, got %s", expectedJSON, b)
+	}
+
+	if err := json.Unmarshal([]byte(`{"hours":{"someday":["09:00-17:00"]}}`), &c); err == nil {
+		t.Errorf("Expected an error for an unknown day")
+	}
+}
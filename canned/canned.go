@@ -0,0 +1,324 @@
+// Package canned keeps a library of canned responses, replies agents send
+// again and again, and turns them into notes on tickets. A Response is a
+// template for the subject and body of a reply, executed with Data: the
+// ticket, its opener and mailbox, the staff member sending it, and the
+// response's own variables.
+//
+// A response is written as a file in a library directory, with a header of
+// "key: value" lines, a blank line and the body:
+//
+//	subject: Re: {{.Ticket.DefaultSubject}}
+//	vars: amount, date?
+//
+//	Hi {{.Opener.FirstName}},
+//
+//	We've refunded {{.Vars.amount}}{{with .Vars.date}} on {{.}}{{end}}.
+//
+//	{{.Signature}}
+//
+// The file's extension says how the body is written: .txt for plain text
+// that is escaped and turned into HTML paragraphs, .md for Markdown that is
+// turned into HTML, and .html for HTML, which is
+// executed with html/template so values are escaped. Variables ending in
+// "?" are optional, the rest have to be given. The subject defaults to the
+// ticket's subject.
+package canned
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/render"
+)
+
+// Format is how the body of a response is written
+type Format string
+
+// The formats, named by their file extensions
+const (
+	Text     Format = "txt"
+	Markdown Format = "md"
+	HTML     Format = "html"
+)
+
+// Data is what responses are executed with
+type Data struct {
+	Ticket  snappy.Ticket
+	Opener  snappy.Contact
+	Mailbox snappy.Mailbox
+
+	// Staff is who the reply is sent as, Signature their signature as text
+	Staff     snappy.Employee
+	Signature string
+
+	Vars map[string]string
+}
+
+// NewData creates the Data for replying to a ticket as a staff member
+func NewData(t snappy.Ticket, staff snappy.Employee, vars map[string]string) Data {
+	signature := staff.Signature
+	if render.IsHTML(signature) {
+		signature = render.Text(signature)
+	}
+
+	return Data{
+		Ticket:    t,
+		Opener:    t.Opener,
+		Mailbox:   t.Mailbox,
+		Staff:     staff,
+		Signature: strings.TrimSpace(signature),
+		Vars:      vars,
+	}
+}
+
+// Response is a canned response
+type Response struct {
+	Name   string `json:"name"`
+	Format Format `json:"format"`
+
+	// Subject and Body are the template sources
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+
+	// Vars are the variables the response takes, optional ones end in "?"
+	Vars []string `json:"vars"`
+
+	subject *template.Template
+	text    *template.Template
+	html    *htmltemplate.Template
+}
+
+var textFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+var htmlFuncs = htmltemplate.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	// br escapes text and keeps its line breaks
+	"br": func(s string) htmltemplate.HTML {
+		return htmltemplate.HTML(strings.Replace(htmltemplate.HTMLEscapeString(s), "\n", "<br>\n", -1))
+	},
+}
+
+// New creates a response and compiles it. Its templates may only use the
+// variables it declares, and have to execute with empty Data, so typos are
+// caught here rather than when sending
+func New(name string, format Format, subject, body string, vars []string) (r *Response, err error) {
+	r = &Response{
+		Name:    name,
+		Format:  format,
+		Subject: subject,
+		Body:    body,
+		Vars:    vars,
+	}
+
+	fail := func(err error) (*Response, error) {
+		return nil, fmt.Errorf("canned: %s: %v", name, err)
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("canned: a response needs a name")
+	}
+
+	if strings.TrimSpace(body) == "" {
+		return fail(fmt.Errorf("empty body"))
+	}
+
+	if subject == "" {
+		subject = "{{.Ticket.DefaultSubject}}"
+	}
+
+	if r.subject, err = template.New("subject").Funcs(textFuncs).Option("missingkey=zero").Parse(subject); err != nil {
+		return fail(err)
+	}
+	trees := []*parse.Tree{r.subject.Tree}
+
+	switch format {
+	case Text, Markdown:
+		if r.text, err = template.New("body").Funcs(textFuncs).Option("missingkey=zero").Parse(body); err != nil {
+			return fail(err)
+		}
+		trees = append(trees, r.text.Tree)
+	case HTML:
+		if r.html, err = htmltemplate.New("body").Funcs(htmlFuncs).Option("missingkey=zero").Parse(body); err != nil {
+			return fail(err)
+		}
+		trees = append(trees, r.html.Tree)
+	default:
+		return fail(fmt.Errorf("unknown format %q", format))
+	}
+
+	declared := map[string]bool{}
+	for _, v := range vars {
+		declared[strings.TrimSuffix(v, "?")] = true
+	}
+
+	for _, tree := range trees {
+		for _, used := range usedVars(tree.Root) {
+			if !declared[used] {
+				return fail(fmt.Errorf("uses .Vars.%s without declaring it", used))
+			}
+		}
+	}
+
+	placeholders := map[string]string{}
+	for v := range declared {
+		placeholders[v] = v
+	}
+	if _, _, err := r.execute(Data{Vars: placeholders}); err != nil {
+		return fail(err)
+	}
+
+	return r, nil
+}
+
+// usedVars finds the names used as .Vars.name in a template
+func usedVars(node parse.Node) (names []string) {
+	var walk func(parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				for _, arg := range cmd.Args {
+					walk(arg)
+				}
+			}
+		case *parse.FieldNode:
+			if len(n.Ident) > 1 && n.Ident[0] == "Vars" {
+				names = append(names, n.Ident[1])
+			}
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+
+	walk(node)
+	return
+}
+
+// Check reports the variables that are missing or unknown
+func (r *Response) Check(vars map[string]string) error {
+	declared := map[string]bool{}
+	var missing, unknown []string
+
+	for _, v := range r.Vars {
+		name := strings.TrimSuffix(v, "?")
+		declared[name] = true
+		if !strings.HasSuffix(v, "?") && strings.TrimSpace(vars[name]) == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	for name := range vars {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(missing, ", "))
+	}
+	if len(unknown) > 0 {
+		problems = append(problems, "unknown "+strings.Join(unknown, ", "))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("canned: %s: %s", r.Name, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (r *Response) execute(d Data) (subject, body string, err error) {
+	var b bytes.Buffer
+
+	if err = r.subject.Execute(&b, d); err != nil {
+		return
+	}
+	subject = strings.Join(strings.Fields(b.String()), " ")
+
+	b.Reset()
+	if r.html != nil {
+		err = r.html.Execute(&b, d)
+	} else {
+		err = r.text.Execute(&b, d)
+	}
+	body = b.String()
+
+	return
+}
+
+// Note renders the response into a note replying to d.Ticket as d.Staff,
+// after checking its variables
+func (r *Response) Note(d Data) (note snappy.NewNote, err error) {
+	if err = r.Check(d.Vars); err != nil {
+		return
+	}
+
+	subject, body, err := r.execute(d)
+	if err != nil {
+		return note, fmt.Errorf("canned: %s: %v", r.Name, err)
+	}
+
+	switch r.Format {
+	case Text:
+		body = render.Plain(body)
+	case Markdown:
+		body = render.Markdown(body)
+	}
+
+	return snappy.NewNote{
+		Subject:     subject,
+		Message:     body,
+		MailboxID:   d.Ticket.MailboxID,
+		StaffID:     d.Staff.ID,
+		TicketNonce: d.Ticket.TicketNonce,
+	}, nil
+}
+
+// Send renders the response and replies with it to d.Ticket, returning
+// the note it created, see snappy.ReplyToTicket
+func (r *Response) Send(client *snappy.Snappy, d Data) (note snappy.Note, err error) {
+	reply, err := r.Note(d)
+	if err != nil {
+		return
+	}
+
+	return client.ReplyToTicket(d.Ticket, reply.Message, snappy.ReplyOptions{
+		Subject: reply.Subject,
+		StaffID: reply.StaffID,
+	})
+}
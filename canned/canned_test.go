@@ -0,0 +1,157 @@
+package canned
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/derekpitt/snappy"
+)
+
+var (
+	ticket = snappy.Ticket{
+		ID:             7,
+		MailboxID:      2,
+		DefaultSubject: "Refund please",
+		TicketNonce:    "abc",
+		Opener:         snappy.Contact{FirstName: "Sam", Address: "sam@example.com"},
+		Mailbox:        snappy.Mailbox{ID: 2, Display: "Support"},
+	}
+	staff = snappy.Employee{ID: 4, FirstName: "Alex", Signature: "<p>Alex<br>Support &amp; Billing</p>"}
+)
+
+func TestNote(t *testing.T) {
+	r, err := New("refund", Text, "Re: {{.Ticket.DefaultSubject}}",
+		"Hi {{.Opener.FirstName}},\nWe refunded {{.Vars.amount}}{{with .Vars.date}} on {{.}}{{end}}.\n{{.Signature}}\n",
+		[]string{"amount", "date?"})
+	if err != nil {
+		t.Fatalf("Expected no error in New(), got %v", err)
+	}
+
+	note, err := r.Note(NewData(ticket, staff, map[string]string{"amount": "$10"}))
+	if err != nil {
+		t.Fatalf("Expected no error in Note(), got %v", err)
+	}
+
+	expected := snappy.NewNote{
+		Subject:     "Re: Refund please",
+		Message:     "<p>Hi Sam,<br>We refunded $10.<br>Alex<br>Support &amp; Billing</p>",
+		MailboxID:   2,
+		StaffID:     4,
+		TicketNonce: "abc",
+	}
+	if reflect.DeepEqual(expected, note) == false {
+		t.Errorf("Expected %+v, got %+v", expected, note)
+	}
+}
+
+func TestNoteFormats(t *testing.T) {
+	md, err := New("md", Markdown, "", "Hi **{{.Opener.FirstName}}** from {{.Mailbox.Display}}", nil)
+	if err != nil {
+		t.Fatalf("Expected no error in New(), got %v", err)
+	}
+
+	note, _ := md.Note(NewData(ticket, staff, nil))
+	if note.Subject != "Refund please" || note.Message != "<p>Hi <strong>Sam</strong> from Support</p>" {
+		t.Errorf("Unexpected markdown note %q %q", note.Subject, note.Message)
+	}
+
+	text, err := New("txt", Text, "", "Hi {{.Vars.name}},\n\n{{.Signature}}", []string{"name"})
+	if err != nil {
+		t.Fatalf("Expected no error in New(), got %v", err)
+	}
+
+	note, _ = text.Note(NewData(ticket, staff, map[string]string{"name": "<Sam>"}))
+	if expected := "<p>Hi &lt;Sam&gt;,</p>\n<p>Alex<br>Support &amp; Billing</p>"; note.Message != expected {
+		t.Errorf("Expected %q, got %q", expected, note.Message)
+	}
+
+	html, err := New("html", HTML, "", "<p>Hi {{.Vars.name}}</p><p>{{br .Signature}}</p>", []string{"name"})
+	if err != nil {
+		t.Fatalf("Expected no error in New(), got %v", err)
+	}
+
+	note, _ = html.Note(NewData(ticket, staff, map[string]string{"name": "<Sam>"}))
+	if expected := "<p>Hi &lt;Sam&gt;</p><p>Alex<br>\nSupport &amp; Billing</p>"; note.Message != expected {
+		t.Errorf("Expected %q, got %q", expected, note.Message)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	cases := []struct {
+		format  Format
+		body    string
+		vars    []string
+		message string
+	}{
+		{Text, "", nil, "empty body"},
+		{Text, "{{.Vars.amount}}", nil, "uses .Vars.amount without declaring it"},
+		{Text, "{{if .Ticket.Unread}}{{.Vars.x}}{{end}}", []string{"y"}, "uses .Vars.x"},
+		{Text, "{{.Ticket.Nope}}", nil, "can't evaluate field Nope"},
+		{Text, "{{.Opener.FirstName", nil, "unclosed action"},
+		{"doc", "hi", nil, `unknown format "doc"`},
+	}
+
+	for _, c := range cases {
+		_, err := New("r", c.format, "", c.body, c.vars)
+		if err == nil || !strings.Contains(err.Error(), c.message) {
+			t.Errorf("%q: expected an error containing %q, got %v", c.body, c.message, err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	r, _ := New("r", Text, "", "{{.Vars.a}} {{.Vars.b}} {{.Vars.c}}", []string{"a", "b", "c?"})
+
+	err := r.Check(map[string]string{"a": " ", "d": "x", "e": "y"})
+	if err == nil || err.Error() != "canned: r: missing a, b; unknown d, e" {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if err := r.Check(map[string]string{"a": "1", "b": "2"}); err != nil {
+		t.Errorf("Expected no error in Check(), got %v", err)
+	}
+}
+
+func TestSend(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := snappy.WithAPIKey("apikey")
+	client.SetEndpointPrefix(server.URL)
+
+	var notes []snappy.Note
+	mux.HandleFunc("/ticket/7/notes", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(notes)
+	})
+
+	var sent snappy.NewNote
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &sent)
+		notes = append(notes, snappy.Note{ID: 8, CreatedByStaffID: sent.StaffID, Content: sent.Message})
+	})
+
+	r, _ := New("thanks", Text, "", "Thanks {{.Opener.FirstName}}!", nil)
+
+	if _, err := r.Send(client, NewData(ticket, staff, map[string]string{"oops": "x"})); err == nil {
+		t.Errorf("Expected unknown variables to stop the send")
+	}
+	if sent.Message != "" {
+		t.Errorf("Expected nothing to be sent, got %+v", sent)
+	}
+
+	note, err := r.Send(client, NewData(ticket, staff, nil))
+	if err != nil || note.ID != 8 {
+		t.Fatalf("Expected the new note and no error in Send(), got %+v, %v", note, err)
+	}
+	to := []snappy.NoteAddress{{Name: "Sam", Address: "sam@example.com"}}
+	if sent.Message != "<p>Thanks Sam!</p>" || sent.TicketNonce != "abc" || sent.StaffID != 4 || reflect.DeepEqual(to, sent.To) == false {
+		t.Errorf("Unexpected note sent %+v", sent)
+	}
+}
@@ -0,0 +1,158 @@
+package canned
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/derekpitt/snappy/internal/atomicfile"
+)
+
+// Library is a directory of responses, one file each, named by their file
+// name without its extension
+type Library struct {
+	Dir       string
+	responses map[string]*Response
+}
+
+// Parse reads a response from the contents of a file, see the package
+// documentation for how it is laid out
+func Parse(name string, format Format, content []byte) (*Response, error) {
+	text := strings.Replace(string(content), "\r\n", "\n", -1)
+
+	// the header is optional, a file can be just the body
+	header, body := "", text
+	firstKey := strings.SplitN(strings.SplitN(text, "\n", 2)[0], ":", 2)[0]
+	if k := strings.ToLower(strings.TrimSpace(firstKey)); k == "subject" || k == "vars" {
+		header, body = text, ""
+		if i := strings.Index(text, "\n\n"); i >= 0 {
+			header, body = text[:i], text[i+2:]
+		}
+	}
+
+	var subject string
+	var vars []string
+
+	var lines []string
+	if header != "" {
+		lines = strings.Split(header, "\n")
+	}
+
+	for n, line := range lines {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("canned: %s: line %d: expected \"key: value\", and a blank line before the body", name, n+1)
+		}
+
+		key, value := strings.ToLower(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+		switch key {
+		case "subject":
+			subject = value
+		case "vars":
+			for _, v := range strings.Split(value, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					vars = append(vars, v)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("canned: %s: line %d: unknown key %q, expected subject or vars", name, n+1, key)
+		}
+	}
+
+	return New(name, format, subject, strings.TrimSpace(body)+"\n", vars)
+}
+
+// Load reads every response in a directory. Files with other extensions
+// than .txt, .md and .html are skipped
+func Load(dir string) (*Library, error) {
+	l := &Library{Dir: dir, responses: map[string]*Response{}}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		ext := filepath.Ext(f.Name())
+		format := Format(strings.TrimPrefix(ext, "."))
+		if format != Text && format != Markdown && format != HTML {
+			continue
+		}
+
+		name := strings.TrimSuffix(f.Name(), ext)
+		if _, ok := l.responses[name]; ok {
+			return nil, fmt.Errorf("canned: %s: more than one file for the response", name)
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := Parse(name, format, content)
+		if err != nil {
+			return nil, err
+		}
+		l.responses[name] = r
+	}
+
+	return l, nil
+}
+
+// Get returns the response with a name
+func (l *Library) Get(name string) (*Response, error) {
+	r, ok := l.responses[name]
+	if !ok {
+		return nil, fmt.Errorf("canned: no response named %q", name)
+	}
+	return r, nil
+}
+
+// Responses returns the responses ordered by name
+func (l *Library) Responses() []*Response {
+	result := make([]*Response, 0, len(l.responses))
+	for _, r := range l.responses {
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Save writes a response to the library's directory, replacing any with
+// the same name
+func (l *Library) Save(r *Response) error {
+	var b bytes.Buffer
+	if r.Subject != "" {
+		fmt.Fprintf(&b, "subject: %s\n", r.Subject)
+	}
+	if len(r.Vars) > 0 {
+		fmt.Fprintf(&b, "vars: %s\n", strings.Join(r.Vars, ", "))
+	}
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString(r.Body)
+
+	if err := atomicfile.WriteFile(filepath.Join(l.Dir, r.Name+"."+string(r.Format)), b.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	// the old file goes once the new one is in place, so a failed save
+	// never loses the response
+	if old, ok := l.responses[r.Name]; ok && old.Format != r.Format {
+		if err := os.Remove(filepath.Join(l.Dir, old.Name+"."+string(old.Format))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	l.responses[r.Name] = r
+	return nil
+}
@@ -0,0 +1,120 @@
+package canned
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func tempDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "canned")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := tempDir(t, map[string]string{
+		"refund.txt":   "subject: Re: {{.Ticket.DefaultSubject}}\r\nvars: amount, date?\r\n\r\nWe refunded {{.Vars.amount}}.\r\n",
+		"thanks.md":    "Thanks **{{.Opener.FirstName}}**!\n",
+		"welcome.html": "Vars: name\n\n<p>Welcome {{.Vars.name}}</p>",
+		"notes.rtf":    "skipped",
+	})
+	defer os.RemoveAll(dir)
+
+	l, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Expected no error in Load(), got %v", err)
+	}
+
+	var names []string
+	for _, r := range l.Responses() {
+		names = append(names, r.Name+"."+string(r.Format))
+	}
+	if expected := []string{"refund.txt", "thanks.md", "welcome.html"}; reflect.DeepEqual(expected, names) == false {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	r, err := l.Get("refund")
+	if err != nil {
+		t.Fatalf("Expected no error in Get(), got %v", err)
+	}
+	if r.Subject != "Re: {{.Ticket.DefaultSubject}}" || reflect.DeepEqual([]string{"amount", "date?"}, r.Vars) == false || r.Body != "We refunded {{.Vars.amount}}.\n" {
+		t.Errorf("Unexpected response %+v", r)
+	}
+
+	if _, err := l.Get("nope"); err == nil {
+		t.Errorf("Expected an error getting a missing response")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := []struct {
+		files   map[string]string
+		message string
+	}{
+		{map[string]string{"a.txt": "subject: hi\nnot a header\n\nbody"}, `canned: a: line 2: expected "key: value"`},
+		{map[string]string{"a.txt": "subject: hi\nfrom: me\n\nbody"}, `line 2: unknown key "from"`},
+		{map[string]string{"a.txt": "hi", "a.md": "hi"}, "more than one file"},
+		{map[string]string{"a.txt": "{{.Vars.x}}"}, "uses .Vars.x without declaring it"},
+	}
+
+	for _, c := range cases {
+		dir := tempDir(t, c.files)
+
+		_, err := Load(dir)
+		if err == nil || !strings.Contains(err.Error(), c.message) {
+			t.Errorf("Expected an error containing %q, got %v", c.message, err)
+		}
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir := tempDir(t, map[string]string{"thanks.txt": "Thanks!"})
+	defer os.RemoveAll(dir)
+
+	l, _ := Load(dir)
+
+	r, _ := New("thanks", Markdown, "Re: {{.Ticket.DefaultSubject}}", "Thanks **{{.Vars.name}}**!\n", []string{"name"})
+	if err := l.Save(r); err != nil {
+		t.Fatalf("Expected no error in Save(), got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "thanks.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected the old format's file to be removed")
+	}
+
+	reloaded, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Expected no error in Load(), got %v", err)
+	}
+
+	got, _ := reloaded.Get("thanks")
+	if got.Format != Markdown || got.Subject != r.Subject || got.Body != r.Body || reflect.DeepEqual(r.Vars, got.Vars) == false {
+		t.Errorf("Expected %+v back, got %+v", r, got)
+	}
+
+	// a directory in the way of the new file fails the save
+	os.Mkdir(filepath.Join(dir, "thanks.html"), 0755)
+	html, _ := New("thanks", HTML, "", "<p>Thanks!</p>\n", nil)
+	if err := l.Save(html); err == nil {
+		t.Errorf("Expected an error saving over a directory")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "thanks.md")); err != nil {
+		t.Errorf("Expected a failed save to keep the old file, got %v", err)
+	}
+}
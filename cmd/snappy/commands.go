@@ -0,0 +1,619 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/assign"
+	"github.com/derekpitt/snappy/canned"
+	"github.com/derekpitt/snappy/format"
+	"github.com/derekpitt/snappy/render"
+	"github.com/derekpitt/snappy/rules"
+)
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"accounts":  {"", accountsCmd},
+		"staff":     {"[account]", staffCmd},
+		"mailboxes": {"[account]", mailboxesCmd},
+		"inbox":     {"[mailbox]", mailboxCmd((*snappy.Snappy).InboxAtMailbox)},
+		"waiting":   {"[mailbox]", mailboxCmd((*snappy.Snappy).WaitingAtMailbox)},
+		"yours":     {"[mailbox]", mailboxCmd((*snappy.Snappy).YoursAtMailbox)},
+		"ticket":    {"<ticket>", ticketCmd},
+		"notes":     {"[-text] <ticket>", notesCmd},
+		"search":    {"[-page n] [account] <query>", searchCmd},
+		"tag":       {"<ticket> [+tag|-tag]...", tagCmd},
+		"reply":     {"[-m message] [-markdown] [-staff id] [-private] [-since last_reply_at] <ticket>", replyCmd},
+		"wall":      {"[account]", wallCmd},
+		"download":  {"[-o file] <ticket> <attachment>", downloadCmd},
+		"triage":    {"[-staff id] [-dir dir] [mailbox]", triageCmd},
+		"rules":     {"[-dry-run] [-log file] [-state file] <rules.json> [mailbox]...", rulesCmd},
+		"canned":    {"[-dir dir] [-staff id] [-dry-run] [<response> <ticket> [name=value]...]", cannedCmd},
+		"schedule":  {"[-store file] [-tz zone] list [-all] | reply [-at when] [-m message] [-markdown] [-staff id] <ticket> | tag [-at when] <ticket> [+tag|-tag]... | snooze <ticket> <until> | cancel <job>... | run [-watch interval]", scheduleCmd},
+		"assign":    {"[-strategy round-robin|least-loaded] [-skills file] [-state file] [-on-shift] [-dry-run] [mailbox]", assignCmd},
+	}
+}
+
+// intArg parses a required integer argument
+func intArg(args []string, i int) (int, error) {
+	if len(args) <= i {
+		return 0, errUsage
+	}
+
+	n, err := strconv.Atoi(args[i])
+	if err != nil {
+		return 0, errUsage
+	}
+
+	return n, nil
+}
+
+// accountArg returns the account id given as the first argument, or the
+// default account if there isn't one. The remaining args are returned.
+func (e *env) accountArg(args []string, minRest int) (int, []string, error) {
+	if len(args) > minRest {
+		id, err := strconv.Atoi(args[0])
+		if err == nil {
+			return id, args[1:], nil
+		}
+	}
+
+	if e.accountID == 0 {
+		return 0, nil, fmt.Errorf("no account given, pass one or set -account")
+	}
+
+	return e.accountID, args, nil
+}
+
+// print writes v using the selected output format. defaultColumns are used
+// for tables and csv when no columns were asked for
+func (e *env) print(v interface{}, defaultColumns ...string) error {
+	opts := format.Options{
+		Columns: e.columns,
+		Width:   e.width,
+	}
+
+	if len(opts.Columns) == 0 && (e.output == "" || e.output == "table" || e.output == "csv") {
+		opts.Columns = defaultColumns
+	}
+
+	f, err := format.New(e.output, opts)
+	if err != nil {
+		return err
+	}
+
+	return f.Format(e.stdout, v)
+}
+
+func accountsCmd(e *env, args []string) error {
+	accounts, err := e.client.Accounts()
+	if err != nil {
+		return err
+	}
+
+	return e.print(accounts, "id", "organization", "domain")
+}
+
+func staffCmd(e *env, args []string) error {
+	accountID, _, err := e.accountArg(args, 0)
+	if err != nil {
+		return err
+	}
+
+	staff, err := e.client.Staff(accountID)
+	if err != nil {
+		return err
+	}
+
+	return e.print(staff, "id", "username", "first_name", "last_name", "email")
+}
+
+func mailboxesCmd(e *env, args []string) error {
+	accountID, _, err := e.accountArg(args, 0)
+	if err != nil {
+		return err
+	}
+
+	mailboxes, err := e.client.Mailboxes(accountID)
+	if err != nil {
+		return err
+	}
+
+	return e.print(mailboxes, "id", "display", "address")
+}
+
+func (e *env) printTickets(tickets []snappy.Ticket) error {
+	return e.print(tickets, "id", "status", "tags", "summary")
+}
+
+func mailboxCmd(list func(*snappy.Snappy, int) ([]snappy.Ticket, error)) func(*env, []string) error {
+	return func(e *env, args []string) error {
+		mailboxID := e.mailboxID
+		if len(args) > 0 || mailboxID == 0 {
+			var err error
+			if mailboxID, err = intArg(args, 0); err != nil {
+				return err
+			}
+		}
+
+		tickets, err := list(e.client, mailboxID)
+		if err != nil {
+			return err
+		}
+
+		return e.printTickets(tickets)
+	}
+}
+
+func ticketCmd(e *env, args []string) error {
+	ticketID, err := intArg(args, 0)
+	if err != nil {
+		return err
+	}
+
+	t, err := e.client.Ticket(ticketID)
+	if err != nil {
+		return err
+	}
+
+	return e.print(t, "id", "default_subject", "status", "mailbox_id", "opener.address", "tags", "last_reply_by", "summary")
+}
+
+func notesCmd(e *env, args []string) error {
+	fs := flag.NewFlagSet("notes", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	text := fs.Bool("text", false, "convert note content to plain text")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	ticketID, err := intArg(fs.Args(), 0)
+	if err != nil {
+		return err
+	}
+
+	notes, err := e.client.TicketNotes(ticketID)
+	if err != nil {
+		return err
+	}
+
+	if *text {
+		for i := range notes {
+			notes[i].Content = render.NoteText(notes[i])
+		}
+	}
+
+	return e.print(notes, "id", "creator.address", "scope", "content")
+}
+
+func searchCmd(e *env, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	page := fs.Int("page", 1, "page of results, starting at 1")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	accountID, rest, err := e.accountArg(fs.Args(), 1)
+	if err != nil {
+		return err
+	}
+
+	if len(rest) == 0 {
+		return errUsage
+	}
+
+	results, err := e.client.Search(accountID, strings.Join(rest, " "), *page)
+	if err != nil {
+		return err
+	}
+
+	if err := e.printTickets(results.Tickets); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stderr, "page %d, %d total\n", *page, results.Meta.Total)
+	return nil
+}
+
+// applyTagChanges adds tags prefixed with + (or nothing) and removes tags prefixed with -
+func applyTagChanges(tags []string, changes []string) []string {
+	result := append([]string{}, tags...)
+
+	for _, change := range changes {
+		switch {
+		case strings.HasPrefix(change, "-"):
+			tag := change[1:]
+			kept := result[:0]
+			for _, t := range result {
+				if t != tag {
+					kept = append(kept, t)
+				}
+			}
+			result = kept
+		default:
+			tag := strings.TrimPrefix(change, "+")
+			found := false
+			for _, t := range result {
+				if t == tag {
+					found = true
+					break
+				}
+			}
+			if !found {
+				result = append(result, tag)
+			}
+		}
+	}
+
+	return result
+}
+
+func tagCmd(e *env, args []string) error {
+	ticketID, err := intArg(args, 0)
+	if err != nil {
+		return err
+	}
+
+	t, err := e.client.Ticket(ticketID)
+	if err != nil {
+		return err
+	}
+
+	tags := applyTagChanges(t.Tags, args[1:])
+
+	if len(args) > 1 {
+		if err := e.client.UpdateTags(ticketID, tags...); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(e.stdout, strings.Join(tags, " "))
+	return nil
+}
+
+// message returns the message given with -m, or read from stdin when there
+// isn't one, converted from Markdown if asked
+func (e *env) message(message string, markdown bool) (string, error) {
+	if message == "" {
+		b, err := ioutil.ReadAll(e.stdin)
+		if err != nil {
+			return "", err
+		}
+		message = string(b)
+	}
+
+	if strings.TrimSpace(message) == "" {
+		return "", fmt.Errorf("empty message")
+	}
+
+	if markdown {
+		message = render.Markdown(message)
+	}
+
+	return message, nil
+}
+
+func replyCmd(e *env, args []string) error {
+	fs := flag.NewFlagSet("reply", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	message := fs.String("m", "", "message, read from stdin when empty")
+	markdown := fs.Bool("markdown", false, "convert the message from Markdown to HTML")
+	staffID := fs.Int("staff", 0, "staff id to send as")
+	private := fs.Bool("private", false, "post to the wall, linked to the ticket, instead of replying")
+	since := fs.Int("since", 0, "the ticket's last_reply_at when you read it, don't reply if it has newer notes")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	ticketID, err := intArg(fs.Args(), 0)
+	if err != nil {
+		return err
+	}
+
+	body, err := e.message(*message, *markdown)
+	if err != nil {
+		return err
+	}
+
+	t, err := e.client.Ticket(ticketID)
+	if err != nil {
+		return err
+	}
+
+	if *since != 0 {
+		seen := t
+		seen.LastReplyAt, seen.UpdatedAt = *since, ""
+		if err := e.client.CheckConflictWith(seen, t); err != nil {
+			return err
+		}
+	}
+
+	_, err = e.client.ReplyToTicket(t, body, snappy.ReplyOptions{
+		StaffID: *staffID,
+		Private: *private,
+	})
+	if err == snappy.ErrNoteNotFound {
+		return nil
+	}
+	return err
+}
+
+func wallCmd(e *env, args []string) error {
+	accountID, _, err := e.accountArg(args, 0)
+	if err != nil {
+		return err
+	}
+
+	posts, err := e.client.Wall(accountID)
+	if err != nil {
+		return err
+	}
+
+	return e.print(posts, "id", "staff_id", "like_count", "content_markdown")
+}
+
+func downloadCmd(e *env, args []string) error {
+	fs := flag.NewFlagSet("download", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	output := fs.String("o", "", "file to write to, stdout when empty")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	ticketID, err := intArg(fs.Args(), 0)
+	if err != nil {
+		return err
+	}
+
+	attachmentID, err := intArg(fs.Args(), 1)
+	if err != nil {
+		return err
+	}
+
+	rc, err := e.client.DownloadTicketAttachment(ticketID, attachmentID)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var w io.Writer = e.stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+func rulesCmd(e *env, args []string) error {
+	fs := flag.NewFlagSet("rules", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	dryRun := fs.Bool("dry-run", false, "show what would be done without doing it")
+	logPath := fs.String("log", "", "file to append the audit log to, as JSON lines")
+	statePath := fs.String("state", "", "file remembering the notes and wall posts already made, defaults to the log file with .state added")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if fs.NArg() == 0 {
+		return errUsage
+	}
+
+	ruleList, err := rules.LoadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	mailboxIDs := []int{}
+	for i := 1; i < fs.NArg(); i++ {
+		id, err := intArg(fs.Args(), i)
+		if err != nil {
+			return err
+		}
+		mailboxIDs = append(mailboxIDs, id)
+	}
+	if len(mailboxIDs) == 0 {
+		if e.mailboxID == 0 {
+			return fmt.Errorf("no mailbox given, pass one or set -mailbox")
+		}
+		mailboxIDs = append(mailboxIDs, e.mailboxID)
+	}
+
+	accountID, _, err := e.accountArg(nil, 0)
+	if err != nil {
+		return err
+	}
+
+	engine, err := rules.New(e.client, accountID, ruleList)
+	if err != nil {
+		return err
+	}
+	engine.DryRun = *dryRun
+	engine.StatePath = *statePath
+	if engine.StatePath == "" && *logPath != "" {
+		engine.StatePath = *logPath + ".state"
+	}
+
+	if *logPath != "" {
+		f, err := os.OpenFile(*logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		engine.Log = rules.NewJSONLog(f)
+	}
+
+	entries, err := engine.Poll(mailboxIDs...)
+	if err != nil {
+		return err
+	}
+
+	return e.print(entries, "ticket_id", "rule", "action", "detail", "error")
+}
+
+func assignCmd(e *env, args []string) error {
+	fs := flag.NewFlagSet("assign", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	strategy := fs.String("strategy", "least-loaded", "round-robin or least-loaded")
+	skills := fs.String("skills", "", `JSON file of the tags each username handles, e.g. {"sam": ["#billing"]}`)
+	statePath := fs.String("state", "", "file the rotation is kept in between runs")
+	onShift := fs.Bool("on-shift", false, "only assign to staff within working hours in their time zone")
+	dryRun := fs.Bool("dry-run", false, "show the assignments without making them")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	mailboxID := e.mailboxID
+	if fs.NArg() > 0 || mailboxID == 0 {
+		var err error
+		if mailboxID, err = intArg(fs.Args(), 0); err != nil {
+			return err
+		}
+	}
+
+	accountID, _, err := e.accountArg(nil, 0)
+	if err != nil {
+		return err
+	}
+
+	var s assign.Strategy
+	switch *strategy {
+	case "round-robin":
+		s = assign.RoundRobin{}
+	case "least-loaded":
+		s = assign.LeastLoaded{}
+	default:
+		return errUsage
+	}
+
+	if *skills != "" {
+		b, err := ioutil.ReadFile(*skills)
+		if err != nil {
+			return err
+		}
+
+		skilled := assign.Skills{Then: s}
+		if err := json.Unmarshal(b, &skilled.Skills); err != nil {
+			return fmt.Errorf("%s: %v", *skills, err)
+		}
+		s = skilled
+	}
+
+	a := assign.New(e.client, accountID, s)
+	a.StatePath = *statePath
+	a.DryRun = *dryRun
+
+	if *onShift {
+		if a.Staff, err = e.client.Staff(accountID); err != nil {
+			return err
+		}
+		a.Available = assign.OnShift(a.Staff, time.Now())
+	}
+
+	assignments, err := a.Run(mailboxID)
+	if err != nil {
+		return err
+	}
+
+	return e.print(assignments, "ticket_id", "username", "error")
+}
+
+func cannedCmd(e *env, args []string) error {
+	fs := flag.NewFlagSet("canned", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	dir := fs.String("dir", "canned", "directory of canned responses")
+	staffID := fs.Int("staff", 0, "staff id to send as, their signature is used")
+	dryRun := fs.Bool("dry-run", false, "print the reply instead of sending it")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	library, err := canned.Load(*dir)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return e.print(library.Responses(), "name", "format", "subject", "vars")
+	}
+
+	ticketID, err := intArg(fs.Args(), 1)
+	if err != nil {
+		return err
+	}
+
+	r, err := library.Get(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	vars := map[string]string{}
+	for _, arg := range fs.Args()[2:] {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return errUsage
+		}
+		vars[kv[0]] = kv[1]
+	}
+
+	t, err := e.client.Ticket(ticketID)
+	if err != nil {
+		return err
+	}
+
+	staff := snappy.Employee{ID: *staffID}
+	if *staffID != 0 {
+		accountID, _, err := e.accountArg(nil, 0)
+		if err != nil {
+			return err
+		}
+
+		employees, err := e.client.Staff(accountID)
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, s := range employees {
+			if s.ID == *staffID {
+				staff, found = s, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no staff member %d", *staffID)
+		}
+	}
+
+	d := canned.NewData(t, staff, vars)
+
+	if *dryRun {
+		note, err := r.Note(d)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "Subject: %s\n\n%s\n", note.Subject, strings.TrimRight(note.Message, "\n"))
+		return nil
+	}
+
+	_, err = r.Send(e.client, d)
+	if err == snappy.ErrNoteNotFound {
+		return nil
+	}
+	return err
+}
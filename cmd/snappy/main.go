@@ -0,0 +1,239 @@
+// Command snappy is a small command line front end for the Snappy API.
+//
+// Credentials are read from flags, from the environment or from a profile in
+// the config file (see snappy.Config), in that order of precedence:
+//
+//	SNAPPY_CONFIG                     config file path
+//	SNAPPY_PROFILE                    profile to use
+//	SNAPPY_API_KEY                    api key (preferred)
+//	SNAPPY_USERNAME, SNAPPY_PASSWORD  username and password
+//	SNAPPY_ACCOUNT                    default account id
+//	SNAPPY_MAILBOX                    default mailbox id
+//	SNAPPY_ENDPOINT                   api root, defaults to the public api
+//	SNAPPY_OUTPUT                     output format, see -output
+//	COLUMNS                           terminal width tables are truncated to
+//
+// Exit codes reflect the kind of error that happened:
+//
+//	0  success
+//	1  general failure
+//	2  bad usage
+//	3  unauthorized (401/403)
+//	4  not found (404)
+//	5  rate limited (429)
+//	6  server error (5xx)
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/format"
+)
+
+const (
+	exitOK = iota
+	exitFailure
+	exitUsage
+	exitUnauthorized
+	exitNotFound
+	exitRateLimited
+	exitServerError
+)
+
+// errUsage is returned by commands that were called with bad arguments
+var errUsage = errors.New("bad usage")
+
+// env holds everything a command needs to run
+type env struct {
+	client    *snappy.Snappy
+	accountID int
+	mailboxID int
+	output    string
+	columns   []string
+	width     int
+	stdin     io.Reader
+	stdout    io.Writer
+	stderr    io.Writer
+}
+
+type command struct {
+	usage string
+	run   func(e *env, args []string) error
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Getenv))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, getenv func(string) string) int {
+	fs := flag.NewFlagSet("snappy", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	configPath := fs.String("config", getenv("SNAPPY_CONFIG"), "config file, defaults to ~/.config/snappy/config.json")
+	profileName := fs.String("profile", getenv("SNAPPY_PROFILE"), "profile to use from the config file")
+
+	var flagProfile snappy.Profile
+	fs.StringVar(&flagProfile.APIKey, "key", "", "api key")
+	fs.StringVar(&flagProfile.Username, "user", "", "username, used when no api key is given")
+	fs.StringVar(&flagProfile.Password, "password", "", "password, used when no api key is given")
+	fs.StringVar(&flagProfile.Endpoint, "endpoint", "", "api root url")
+	fs.IntVar(&flagProfile.AccountID, "account", 0, "default account id")
+	fs.IntVar(&flagProfile.MailboxID, "mailbox", 0, "default mailbox id")
+	output := fs.String("output", getenv("SNAPPY_OUTPUT"), "output format: table, json, jsonl, csv or template=<go template>")
+	columns := fs.String("columns", "", "comma separated columns to show, e.g. id,opener.address")
+	width, _ := strconv.Atoi(getenv("COLUMNS"))
+	fs.IntVar(&width, "width", width, "truncate tables to this many characters, 0 for no limit")
+
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: snappy [flags] <command> [args]")
+		fmt.Fprintln(stderr, "\ncommands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(stderr, "  %s %s\n", name, commands[name].usage)
+		}
+		fmt.Fprintln(stderr, "\nflags:")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	name := fs.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "snappy: unknown command %q\n", name)
+		fs.Usage()
+		return exitUsage
+	}
+
+	if _, err := format.New(*output, format.Options{}); err != nil {
+		fmt.Fprintf(stderr, "snappy: %v\n", err)
+		return exitUsage
+	}
+
+	profile, err := loadProfile(*configPath, *profileName, flagProfile, getenv)
+	if err != nil {
+		fmt.Fprintf(stderr, "snappy: %v\n", err)
+		return exitUsage
+	}
+
+	client, err := profile.Client()
+	if err != nil {
+		fmt.Fprintln(stderr, "snappy: no credentials, set -key, SNAPPY_API_KEY or a profile")
+		return exitUsage
+	}
+
+	e := &env{
+		client:    client,
+		accountID: profile.AccountID,
+		mailboxID: profile.MailboxID,
+		output:    *output,
+		width:     width,
+		stdin:     stdin,
+		stdout:    stdout,
+		stderr:    stderr,
+	}
+
+	if *columns != "" {
+		e.columns = strings.Split(*columns, ",")
+	}
+
+	err = cmd.run(e, fs.Args()[1:])
+	if err == nil {
+		return exitOK
+	}
+
+	if err == errUsage {
+		fmt.Fprintf(stderr, "usage: snappy %s %s\n", name, cmd.usage)
+		return exitUsage
+	}
+
+	fmt.Fprintf(stderr, "snappy: %v\n", err)
+	return exitCode(err)
+}
+
+// loadProfile reads the named profile from the config file, applies the
+// environment on top of it and then anything given as flags
+func loadProfile(path, name string, flags snappy.Profile, getenv func(string) string) (snappy.Profile, error) {
+	if path == "" {
+		var err error
+		if path, err = snappy.DefaultConfigPath(); err != nil {
+			return snappy.Profile{}, err
+		}
+	}
+
+	config, err := snappy.LoadConfig(path)
+	if err != nil {
+		return snappy.Profile{}, err
+	}
+
+	p, err := config.Profile(name)
+	if err != nil {
+		return p, err
+	}
+
+	if p, err = p.WithEnv(getenv); err != nil {
+		return p, err
+	}
+
+	if flags.Username != "" {
+		p.Username = flags.Username
+		p.APIKey = ""
+	}
+
+	if flags.APIKey != "" {
+		p.APIKey = flags.APIKey
+	}
+
+	if flags.Password != "" {
+		p.Password = flags.Password
+	}
+
+	if flags.Endpoint != "" {
+		p.Endpoint = flags.Endpoint
+	}
+
+	if flags.AccountID != 0 {
+		p.AccountID = flags.AccountID
+	}
+
+	if flags.MailboxID != 0 {
+		p.MailboxID = flags.MailboxID
+	}
+
+	return p, nil
+}
+
+// exitCode maps an error returned by the api to an exit code
+func exitCode(err error) int {
+	switch {
+	case snappy.IsUnauthorized(err):
+		return exitUnauthorized
+	case snappy.IsNotFound(err):
+		return exitNotFound
+	case snappy.IsRateLimited(err):
+		return exitRateLimited
+	case snappy.IsServerError(err):
+		return exitServerError
+	}
+
+	return exitFailure
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	mux    *http.ServeMux
+	server *httptest.Server
+)
+
+func setup() {
+	mux = http.NewServeMux()
+	server = httptest.NewServer(mux)
+}
+
+func teardown() {
+	server.Close()
+}
+
+func testEnv(key string) string {
+	switch key {
+	case "SNAPPY_API_KEY":
+		return "apikey"
+	case "SNAPPY_ENDPOINT":
+		return server.URL
+	case "SNAPPY_CONFIG":
+		return "testdata/config.json"
+	}
+	return ""
+}
+
+func runCLI(stdin string, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, strings.NewReader(stdin), &out, &errOut, testEnv)
+	return code, out.String(), errOut.String()
+}
+
+func TestAccountsCommand(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/accounts", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":3,"organization":"Snappy Help","domain":"help.besnappy.com"}]`)
+	})
+
+	code, out, _ := runCLI("", "accounts")
+
+	if code != exitOK {
+		t.Errorf("expected exit code %d, got %d", exitOK, code)
+	}
+
+	if !strings.Contains(out, "Snappy Help") {
+		t.Errorf("expected organization in output, got %q", out)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	setup()
+	defer teardown()
+
+	status := 0
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+
+	cases := map[int]int{
+		http.StatusUnauthorized:        exitUnauthorized,
+		http.StatusForbidden:           exitUnauthorized,
+		http.StatusNotFound:            exitNotFound,
+		http.StatusTooManyRequests:     exitRateLimited,
+		http.StatusInternalServerError: exitServerError,
+		http.StatusBadRequest:          exitFailure,
+	}
+
+	for s, expected := range cases {
+		status = s
+		code, _, _ := runCLI("", "ticket", "1")
+		if code != expected {
+			t.Errorf("status %d: expected exit code %d, got %d", s, expected, code)
+		}
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	setup()
+	defer teardown()
+
+	if code, _, _ := runCLI(""); code != exitUsage {
+		t.Error("expected usage exit code with no command")
+	}
+
+	if code, _, _ := runCLI("", "nope"); code != exitUsage {
+		t.Error("expected usage exit code with an unknown command")
+	}
+
+	if code, _, _ := runCLI("", "ticket", "abc"); code != exitUsage {
+		t.Error("expected usage exit code with a bad ticket id")
+	}
+
+	if code, _, _ := runCLI("", "staff"); code != exitFailure {
+		t.Error("expected failure exit code without an account")
+	}
+}
+
+func TestTagCommand(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var got []string
+	mux.HandleFunc("/ticket/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":1,"tags":["#support","@test1"]}`)
+	})
+	mux.HandleFunc("/ticket/1/tags", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		values, _ := url.ParseQuery(string(b))
+		json.Unmarshal([]byte(values.Get("tags")), &got)
+	})
+
+	code, _, _ := runCLI("", "tag", "1", "+#billing", "-@test1")
+
+	if code != exitOK {
+		t.Errorf("expected exit code %d, got %d", exitOK, code)
+	}
+
+	expected := []string{"#support", "#billing"}
+	if reflect.DeepEqual(expected, got) == false {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestReplyCommand(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var got map[string]interface{}
+	mux.HandleFunc("/ticket/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":1,"mailbox_id":2,"nonce":"abc","default_subject":"Help"}`)
+	})
+	mux.HandleFunc("/ticket/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[]`)
+	})
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	})
+
+	code, _, _ := runCLI("thanks!", "reply", "1")
+
+	if code != exitOK {
+		t.Errorf("expected exit code %d, got %d", exitOK, code)
+	}
+
+	if got["id"] != "abc" || got["message"] != "thanks!" || got["mailbox_id"] != float64(2) {
+		t.Errorf("unexpected note %v", got)
+	}
+}
+
+func TestReplyMarkdown(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var got map[string]interface{}
+	mux.HandleFunc("/ticket/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":1,"mailbox_id":2,"nonce":"abc","default_subject":"Help"}`)
+	})
+	mux.HandleFunc("/ticket/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[]`)
+	})
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	})
+
+	code, _, _ := runCLI("", "reply", "-markdown", "-m", "**thanks** <b>", "1")
+
+	if code != exitOK {
+		t.Errorf("expected exit code %d, got %d", exitOK, code)
+	}
+
+	if got["message"] != "<p><strong>thanks</strong> &lt;b&gt;</p>" {
+		t.Errorf("unexpected message %v", got["message"])
+	}
+}
+
+func TestNotesText(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/ticket/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":3,"content":"<p>Hi &amp; hello</p>"}]`)
+	})
+
+	code, out, _ := runCLI("", "-output", "json", "-columns", "id,content", "notes", "-text", "1")
+
+	if code != exitOK {
+		t.Errorf("expected exit code %d, got %d", exitOK, code)
+	}
+
+	if !strings.Contains(out, `"content": "Hi \u0026 hello"`) {
+		t.Errorf("expected plain text content, got %q", out)
+	}
+}
+
+func TestSearchCommand(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/account/7/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("query") != "foo bar" || r.URL.Query().Get("page") != "2" {
+			t.Errorf("unexpected query %v", r.URL.Query())
+		}
+		fmt.Fprintf(w, `{"meta":{"total":1,"page":"2"},"data":[{"id":9,"summary":"found it"}]}`)
+	})
+
+	code, out, _ := runCLI("", "search", "-page", "2", "7", "foo", "bar")
+
+	if code != exitOK {
+		t.Errorf("expected exit code %d, got %d", exitOK, code)
+	}
+
+	if !strings.Contains(out, "found it") {
+		t.Errorf("expected summary in output, got %q", out)
+	}
+}
+
+func TestDownloadCommand(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/ticket/1/attachment/2/download", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hey now!")
+	})
+
+	code, out, _ := runCLI("", "download", "1", "2")
+
+	if code != exitOK || out != "hey now!" {
+		t.Errorf("expected attachment on stdout, got %d %q", code, out)
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/mailbox/1/inbox", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":1,"status":"new","summary":"one"},{"id":2,"status":"new","summary":"two"}]`)
+	})
+
+	_, out, _ := runCLI("", "-output", "jsonl", "-columns", "id", "inbox", "1")
+	if out != "{\"id\":1}\n{\"id\":2}\n" {
+		t.Errorf("unexpected jsonl output %q", out)
+	}
+
+	_, out, _ = runCLI("", "-output", "template={{.ID}}:{{.Summary}}", "inbox", "1")
+	if out != "1:one\n2:two\n" {
+		t.Errorf("unexpected template output %q", out)
+	}
+
+	_, out, _ = runCLI("", "-output", "csv", "inbox", "1")
+	if !strings.HasPrefix(out, "id,status,tags,summary\n") {
+		t.Errorf("unexpected csv output %q", out)
+	}
+
+	if code, _, _ := runCLI("", "-output", "yaml", "inbox", "1"); code != exitUsage {
+		t.Errorf("expected usage exit code for an unknown format, got %d", code)
+	}
+}
+
+func TestProfileDefaults(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/mailbox/12/yours", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":1,"summary":"from the profile mailbox"}]`)
+	})
+
+	code, out, _ := runCLI("", "-profile", "work", "yours")
+
+	if code != exitOK || !strings.Contains(out, "from the profile mailbox") {
+		t.Errorf("expected the profile mailbox to be used, got %d %q", code, out)
+	}
+
+	if code, _, _ := runCLI("", "-profile", "nope", "yours"); code != exitUsage {
+		t.Errorf("expected usage exit code for a missing profile, got %d", code)
+	}
+}
+
+func TestRulesCommand(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/mailbox/2/inbox", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":1,"summary":"Invoice please"},{"id":2,"summary":"Hello"}]`)
+	})
+	mux.HandleFunc("/ticket/1/tags", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected a dry run not to change tags")
+	})
+
+	code, out, _ := runCLI("", "-account", "3", "-output", "csv", "rules", "-dry-run", "testdata/rules.json", "2")
+
+	if code != exitOK {
+		t.Errorf("expected exit code %d, got %d", exitOK, code)
+	}
+
+	if expected := "ticket_id,rule,action,detail,error\n1,billing,add_tags,+#billing,\n"; out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestAssignCommand(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/account/3/staff", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":1,"username":"alex"},{"id":2,"username":"sam"}]`)
+	})
+	mux.HandleFunc("/mailbox/2/inbox", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":1},{"id":2},{"id":3,"tags":["@sam"]}]`)
+	})
+	mux.HandleFunc("/mailbox/2/tickets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[]`)
+	})
+
+	code, out, _ := runCLI("", "-account", "3", "-output", "csv", "assign", "-dry-run", "2")
+
+	if code != exitOK {
+		t.Errorf("expected exit code %d, got %d", exitOK, code)
+	}
+
+	if expected := "ticket_id,username,error\n1,alex,\n2,sam,\n"; out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestCannedCommand(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var got map[string]interface{}
+	mux.HandleFunc("/ticket/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":1,"mailbox_id":2,"nonce":"abc","default_subject":"Help","opener":{"first_name":"Sam"}}`)
+	})
+	mux.HandleFunc("/account/3/staff", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":4,"signature":"Alex"}]`)
+	})
+	mux.HandleFunc("/ticket/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[]`)
+	})
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	})
+
+	code, out, _ := runCLI("", "-output", "csv", "canned", "-dir", "testdata/canned")
+	if expected := "name,format,subject,vars\nrefund,txt,Re: {{.Ticket.DefaultSubject}},amount\nthanks,md,,\n"; code != exitOK || out != expected {
+		t.Errorf("expected %q, got %d %q", expected, code, out)
+	}
+
+	if code, _, _ := runCLI("", "canned", "-dir", "testdata/canned", "refund", "1"); code == exitOK {
+		t.Errorf("expected a missing variable to fail")
+	}
+
+	code, _, _ = runCLI("", "-account", "3", "canned", "-dir", "testdata/canned", "-staff", "4", "refund", "1", "amount=$10")
+	if code != exitOK {
+		t.Errorf("expected exit code %d, got %d", exitOK, code)
+	}
+
+	if got["id"] != "abc" || got["subject"] != "Re: Help" || got["message"] != "<p>Hi Sam, we refunded $10.</p>\n<p>Alex</p>" || got["staff_id"] != float64(4) {
+		t.Errorf("unexpected note %v", got)
+	}
+}
+
+func TestReplySince(t *testing.T) {
+	setup()
+	defer teardown()
+
+	fetched := 0
+	mux.HandleFunc("/ticket/1", func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		fmt.Fprintf(w, `{"id":1,"mailbox_id":2,"nonce":"abc","last_reply_at":200}`)
+	})
+	mux.HandleFunc("/ticket/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":2,"created_at":200,"created_by_staff_id":4}]`)
+	})
+	sent := 0
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		sent++
+	})
+
+	code, _, errOut := runCLI("", "reply", "-since", "100", "-m", "thanks!", "1")
+	if code == exitOK || !strings.Contains(errOut, "1 new note since it was read") || sent != 0 {
+		t.Errorf("expected the reply to be stopped, got %d %q", code, errOut)
+	}
+	if fetched != 1 {
+		t.Errorf("expected the ticket to be fetched once, got %d", fetched)
+	}
+
+	if code, _, _ := runCLI("", "reply", "-since", "200", "-m", "thanks!", "1"); code != exitOK || sent != 1 {
+		t.Errorf("expected the reply to be sent, got %d", code)
+	}
+}
+
+func TestScheduleCommand(t *testing.T) {
+	setup()
+	defer teardown()
+
+	dir, err := ioutil.TempDir("", "schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := filepath.Join(dir, "jobs.json")
+
+	mux.HandleFunc("/ticket/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":1,"mailbox_id":2,"nonce":"abc","default_subject":"Help","tags":["#support"]}`)
+	})
+	var gotTags []string
+	mux.HandleFunc("/ticket/1/tags", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		json.Unmarshal([]byte(r.PostForm.Get("tags")), &gotTags)
+	})
+	var got map[string]interface{}
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	})
+
+	schedule := func(args ...string) (int, string) {
+		code, out, errOut := runCLI("", append([]string{"-output", "csv", "schedule", "-store", store, "-tz", "UTC"}, args...)...)
+		if code != exitOK {
+			t.Errorf("expected exit code %d for %v, got %d: %s", exitOK, args, code, errOut)
+		}
+		return code, out
+	}
+
+	schedule("reply", "-at", "1h", "-m", "thanks!", "1")
+	schedule("tag", "-at", "2h", "1", "+#billing", "-#support")
+	schedule("snooze", "1", "3d")
+
+	if gotTags == nil || gotTags[1] != "#snoozed" {
+		t.Errorf("expected snoozing to tag the ticket now, got %v", gotTags)
+	}
+
+	_, out := schedule("cancel", "2")
+	if !strings.Contains(out, "2,1,") || !strings.Contains(out, ",cancelled,tags +#billing -#support,") {
+		t.Errorf("unexpected cancel output %q", out)
+	}
+
+	_, out = schedule("list")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || lines[0] != "id,ticket_id,due,state,job,error" || !strings.HasPrefix(lines[1], "1,1,") || !strings.HasSuffix(lines[1], `,pending,"note ""Help""",`) || !strings.HasSuffix(lines[2], ",pending,tags -#snoozed,") {
+		t.Errorf("unexpected list %q", out)
+	}
+
+	if _, out = schedule("list", "-all"); strings.Count(strings.TrimSpace(out), "\n") != 3 {
+		t.Errorf("expected every job with -all, got %q", out)
+	}
+
+	// nothing is due yet
+	if _, out = schedule("run"); out != "id,ticket_id,due,state,job,error\n" || got != nil {
+		t.Errorf("expected nothing to run, got %q %v", out, got)
+	}
+
+	if code, _, _ := runCLI("", "schedule", "-store", store, "reply", "-m", "hi", "1"); code != exitUsage {
+		t.Errorf("expected a reply without -at to be a usage error, got %d", code)
+	}
+
+	if code, _, _ := runCLI("", "schedule", "-store", store, "nope"); code != exitUsage {
+		t.Errorf("expected an unknown subcommand to be a usage error, got %d", code)
+	}
+
+	// without -tz due times are local
+	local := time.Local
+	time.Local = time.FixedZone("TEST", -5*60*60)
+	defer func() { time.Local = local }()
+
+	_, out, _ = runCLI("", "-output", "csv", "schedule", "-store", store, "tag", "-at", "2030-01-06 09:00", "1", "+#later")
+	if !strings.Contains(out, ",2030-01-06 09:00 TEST,") {
+		t.Errorf("expected the due time in local time, got %q", out)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/schedule"
+)
+
+// scheduledJob is how a job is listed
+type scheduledJob struct {
+	ID       int            `json:"id"`
+	TicketID int            `json:"ticket_id"`
+	Due      string         `json:"due"`
+	State    schedule.State `json:"state"`
+	Job      string         `json:"job"`
+	Attempts int            `json:"attempts"`
+	Error    string         `json:"error"`
+}
+
+// scheduleEnv is what the schedule subcommands share
+type scheduleEnv struct {
+	*env
+	scheduler *schedule.Scheduler
+	loc       *time.Location
+}
+
+func (s *scheduleEnv) print(jobs []schedule.Job) error {
+	rows := make([]scheduledJob, len(jobs))
+	for i, j := range jobs {
+		rows[i] = scheduledJob{
+			ID:       j.ID,
+			TicketID: j.TicketID,
+			Due:      j.Due.In(s.loc).Format("2006-01-02 15:04 MST"),
+			State:    j.State,
+			Job:      j.Summary(),
+			Attempts: j.Attempts,
+			Error:    j.Error,
+		}
+	}
+
+	return s.env.print(rows, "id", "ticket_id", "due", "state", "job", "error")
+}
+
+// when parses the due time given to a subcommand
+func (s *scheduleEnv) when(at string) (time.Time, error) {
+	if at == "" {
+		return time.Time{}, errUsage
+	}
+	return schedule.When(at, time.Now(), s.loc)
+}
+
+var scheduleCommands = map[string]func(s *scheduleEnv, args []string) error{
+	"list":   scheduleListCmd,
+	"reply":  scheduleReplyCmd,
+	"tag":    scheduleTagCmd,
+	"snooze": scheduleSnoozeCmd,
+	"cancel": scheduleCancelCmd,
+	"run":    scheduleRunCmd,
+}
+
+func scheduleCmd(e *env, args []string) error {
+	fs := flag.NewFlagSet("schedule", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	storePath := fs.String("store", "", "file the jobs are kept in, defaults to schedule.json next to the config file")
+	tz := fs.String("tz", "", "time zone for due times, e.g. America/New_York, defaults to local time")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	sub, ok := scheduleCommands[fs.Arg(0)]
+	if !ok {
+		return errUsage
+	}
+
+	// time.LoadLocation("") is UTC, not local time
+	loc := time.Local
+	if *tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(*tz); err != nil {
+			return err
+		}
+	}
+
+	path := *storePath
+	if path == "" {
+		config, err := snappy.DefaultConfigPath()
+		if err != nil {
+			return err
+		}
+
+		path = filepath.Join(filepath.Dir(config), "schedule.json")
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+	}
+
+	return sub(&scheduleEnv{
+		env:       e,
+		scheduler: schedule.New(e.client, schedule.NewStore(path)),
+		loc:       loc,
+	}, fs.Args()[1:])
+}
+
+func scheduleListCmd(s *scheduleEnv, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(s.stderr)
+	all := fs.Bool("all", false, "include jobs that are done, failed or cancelled")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return errUsage
+	}
+
+	list := s.scheduler.Store.Pending
+	if *all {
+		list = s.scheduler.Store.Jobs
+	}
+
+	jobs, err := list()
+	if err != nil {
+		return err
+	}
+
+	return s.print(jobs)
+}
+
+func scheduleReplyCmd(s *scheduleEnv, args []string) error {
+	fs := flag.NewFlagSet("reply", flag.ContinueOnError)
+	fs.SetOutput(s.stderr)
+	at := fs.String("at", "", "when to send it, e.g. \"mon 09:00\", \"2h\" or \"2014-01-06 09:00\"")
+	message := fs.String("m", "", "message, read from stdin when empty")
+	markdown := fs.Bool("markdown", false, "convert the message from Markdown to HTML")
+	staffID := fs.Int("staff", 0, "staff id to send as")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	ticketID, err := intArg(fs.Args(), 0)
+	if err != nil {
+		return err
+	}
+
+	due, err := s.when(*at)
+	if err != nil {
+		return err
+	}
+
+	body, err := s.message(*message, *markdown)
+	if err != nil {
+		return err
+	}
+
+	t, err := s.client.Ticket(ticketID)
+	if err != nil {
+		return err
+	}
+
+	j, err := schedule.Reply(t, body, snappy.ReplyOptions{StaffID: *staffID}, due)
+	if err != nil {
+		return err
+	}
+
+	if j, err = s.scheduler.Store.Add(j); err != nil {
+		return err
+	}
+
+	return s.print([]schedule.Job{j})
+}
+
+func scheduleTagCmd(s *scheduleEnv, args []string) error {
+	fs := flag.NewFlagSet("tag", flag.ContinueOnError)
+	fs.SetOutput(s.stderr)
+	at := fs.String("at", "", "when to change the tags")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	ticketID, err := intArg(fs.Args(), 0)
+	if err != nil {
+		return err
+	}
+
+	due, err := s.when(*at)
+	if err != nil {
+		return err
+	}
+
+	var add, remove []string
+	for _, change := range fs.Args()[1:] {
+		switch {
+		case strings.HasPrefix(change, "-"):
+			remove = append(remove, change[1:])
+		default:
+			add = append(add, strings.TrimPrefix(change, "+"))
+		}
+	}
+
+	j, err := s.scheduler.Store.Add(schedule.ChangeTags(ticketID, add, remove, due))
+	if err != nil {
+		return err
+	}
+
+	return s.print([]schedule.Job{j})
+}
+
+func scheduleSnoozeCmd(s *scheduleEnv, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	ticketID, err := intArg(args, 0)
+	if err != nil {
+		return err
+	}
+
+	until, err := s.when(args[1])
+	if err != nil {
+		return err
+	}
+
+	j, err := s.scheduler.Snooze(ticketID, until)
+	if err != nil {
+		return err
+	}
+
+	return s.print([]schedule.Job{j})
+}
+
+func scheduleCancelCmd(s *scheduleEnv, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	var cancelled []schedule.Job
+	for i := range args {
+		id, err := intArg(args, i)
+		if err != nil {
+			return err
+		}
+
+		j, err := s.scheduler.Store.Cancel(id)
+		if err != nil {
+			return err
+		}
+		cancelled = append(cancelled, j)
+	}
+
+	return s.print(cancelled)
+}
+
+func scheduleRunCmd(s *scheduleEnv, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(s.stderr)
+	watch := fs.Duration("watch", 0, "keep running due jobs at this interval until interrupted")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return errUsage
+	}
+
+	if *watch <= 0 {
+		ran, err := s.scheduler.Run()
+		if err != nil {
+			return err
+		}
+		return s.print(ran)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	stop := make(chan struct{})
+	go func() {
+		<-interrupt
+		close(stop)
+	}()
+
+	s.scheduler.Watch(*watch, stop, func(ran []schedule.Job, err error) {
+		if err != nil {
+			fmt.Fprintln(s.stderr, err)
+			return
+		}
+		if len(ran) > 0 {
+			s.print(ran)
+		}
+	})
+
+	return nil
+}
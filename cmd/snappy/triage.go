@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/derekpitt/snappy/triage"
+)
+
+// stty runs stty against the terminal on stdin
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func triageCmd(e *env, args []string) error {
+	fs := flag.NewFlagSet("triage", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	staffID := fs.Int("staff", 0, "staff id to reply as")
+	dir := fs.String("dir", "", "directory attachments are downloaded to")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	mailboxID := e.mailboxID
+	if fs.NArg() > 0 || mailboxID == 0 {
+		var err error
+		if mailboxID, err = intArg(fs.Args(), 0); err != nil {
+			return err
+		}
+	}
+
+	ui := triage.New(e.client, mailboxID, e.stdin, e.stdout)
+	ui.StaffID = *staffID
+	ui.DownloadDir = *dir
+
+	if tty, ok := e.stdin.(*os.File); ok {
+		saved, err := stty(tty, "-g")
+		if err != nil {
+			return fmt.Errorf("triage needs a terminal: %v", err)
+		}
+		defer stty(tty, saved)
+
+		if _, err := stty(tty, "raw", "-echo"); err != nil {
+			return err
+		}
+
+		if size, err := stty(tty, "size"); err == nil {
+			fmt.Sscan(size, &ui.Height, &ui.Width)
+		}
+	}
+
+	return ui.Run()
+}
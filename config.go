@@ -0,0 +1,194 @@
+package snappy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Profile holds the credentials and defaults for one Snappy login
+type Profile struct {
+	Name      string `json:"-"`
+	APIKey    string `json:"api_key,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	AccountID int    `json:"account_id,omitempty"`
+	MailboxID int    `json:"mailbox_id,omitempty"`
+}
+
+// Config holds named profiles. It is stored as JSON, e.g.
+//
+//	{
+//	  "default": "work",
+//	  "profiles": {
+//	    "work": {"api_key": "...", "account_id": 3, "mailbox_id": 12},
+//	    "side": {"username": "me@example.com", "password": "..."}
+//	  }
+//	}
+type Config struct {
+	Default  string             `json:"default,omitempty"`
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// ErrNoCredentials is returned when a profile has neither an api key nor a username
+var ErrNoCredentials = errors.New("snappy: profile has no api key or username")
+
+// DefaultConfigPath returns $SNAPPY_CONFIG if set, otherwise snappy/config.json
+// inside the user's config directory (~/.config on Linux)
+func DefaultConfigPath() (string, error) {
+	if path := os.Getenv("SNAPPY_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "snappy", "config.json"), nil
+}
+
+// LoadConfig reads a config file. A missing file is not an error, you just get
+// an empty config so environment variables can still be used
+func LoadConfig(path string) (config *Config, err error) {
+	config = &Config{}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	if err = json.NewDecoder(f).Decode(config); err != nil {
+		return nil, fmt.Errorf("snappy: reading %s: %v", path, err)
+	}
+
+	return
+}
+
+// Profile returns the named profile. An empty name picks the config's
+// default, and then a profile called "default". Asking for the default when
+// there are no profiles at all gives back an empty profile
+func (c *Config) Profile(name string) (Profile, error) {
+	explicit := name != ""
+
+	if name == "" {
+		name = c.Default
+	}
+
+	if name == "" {
+		name = "default"
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok && (explicit || c.Default != "") {
+		return Profile{}, fmt.Errorf("snappy: no profile named %q", name)
+	}
+
+	p.Name = name
+	return p, nil
+}
+
+// WithEnv returns a copy of the profile with any of SNAPPY_API_KEY,
+// SNAPPY_USERNAME, SNAPPY_PASSWORD, SNAPPY_ENDPOINT, SNAPPY_ACCOUNT and
+// SNAPPY_MAILBOX that are set taking precedence. Pass os.Getenv
+func (p Profile) WithEnv(getenv func(string) string) (Profile, error) {
+	if v := getenv("SNAPPY_USERNAME"); v != "" {
+		// a username in the environment beats an api key in the file
+		p.Username = v
+		p.APIKey = ""
+	}
+
+	if v := getenv("SNAPPY_API_KEY"); v != "" {
+		p.APIKey = v
+	}
+
+	if v := getenv("SNAPPY_PASSWORD"); v != "" {
+		p.Password = v
+	}
+
+	if v := getenv("SNAPPY_ENDPOINT"); v != "" {
+		p.Endpoint = v
+	}
+
+	for _, override := range []struct {
+		name string
+		dest *int
+	}{
+		{"SNAPPY_ACCOUNT", &p.AccountID},
+		{"SNAPPY_MAILBOX", &p.MailboxID},
+	} {
+		v := getenv(override.name)
+		if v == "" {
+			continue
+		}
+
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return p, fmt.Errorf("snappy: bad %s %q", override.name, v)
+		}
+
+		*override.dest = id
+	}
+
+	return p, nil
+}
+
+// Client creates a snappy client from the profile, preferring the api key
+func (p Profile) Client() (*Snappy, error) {
+	var s *Snappy
+
+	switch {
+	case p.APIKey != "":
+		s = WithAPIKey(p.APIKey)
+	case p.Username != "":
+		s = WithUsernameAndPassword(p.Username, p.Password)
+	default:
+		return nil, ErrNoCredentials
+	}
+
+	if p.Endpoint != "" {
+		s.SetEndpointPrefix(p.Endpoint)
+	}
+
+	return s, nil
+}
+
+// NewFromProfile creates a snappy client from a profile in the default config
+// file, with environment overrides applied. An empty name uses $SNAPPY_PROFILE
+// or the config's default profile
+func NewFromProfile(name string) (*Snappy, error) {
+	path, err := DefaultConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = os.Getenv("SNAPPY_PROFILE")
+	}
+
+	p, err := config.Profile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if p, err = p.WithEnv(os.Getenv); err != nil {
+		return nil, err
+	}
+
+	return p.Client()
+}
@@ -0,0 +1,134 @@
+package snappy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfig = `
+{
+    "default": "work",
+    "profiles": {
+        "work": {
+            "api_key": "workkey",
+            "endpoint": "http://localhost:1234/",
+            "account_id": 3,
+            "mailbox_id": 12
+        },
+        "side": {
+            "username": "me@test.com",
+            "password": "secret"
+        }
+    }
+}
+`
+
+func writeTestConfig(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "snappy")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "config.json")
+
+	if err := ioutil.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func envFrom(m map[string]string) func(string) string {
+	return func(key string) string {
+		return m[key]
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeTestConfig(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	config, err := LoadConfig(path)
+
+	if err != nil {
+		t.Fatalf("Expected no error in LoadConfig(): %v", err)
+	}
+
+	got, err := config.Profile("")
+
+	if err != nil {
+		t.Fatalf("Expected no error in Profile(): %v", err)
+	}
+
+	expected := Profile{
+		Name:      "work",
+		APIKey:    "workkey",
+		Endpoint:  "http://localhost:1234/",
+		AccountID: 3,
+		MailboxID: 12,
+	}
+
+	if reflect.DeepEqual(expected, got) == false {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	if _, err := config.Profile("nope"); err == nil {
+		t.Error("expected an error for a missing profile")
+	}
+
+	client, err := got.Client()
+
+	if err != nil {
+		t.Fatalf("Expected no error in Client(): %v", err)
+	}
+
+	if client.username != "workkey" || client.endpointPrefix != "http://localhost:1234" {
+		t.Errorf("unexpected client %+v", client)
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	config, err := LoadConfig(filepath.Join(os.TempDir(), "snappy-does-not-exist.json"))
+
+	if err != nil {
+		t.Fatalf("Expected no error for a missing file: %v", err)
+	}
+
+	p, err := config.Profile("")
+
+	if err != nil {
+		t.Fatalf("Expected no error for the default profile: %v", err)
+	}
+
+	if _, err := p.Client(); err != ErrNoCredentials {
+		t.Errorf("expected ErrNoCredentials, got %v", err)
+	}
+}
+
+func TestProfileWithEnv(t *testing.T) {
+	p := Profile{APIKey: "filekey", AccountID: 3}
+
+	got, err := p.WithEnv(envFrom(map[string]string{
+		"SNAPPY_USERNAME": "envuser",
+		"SNAPPY_PASSWORD": "envpass",
+		"SNAPPY_MAILBOX":  "7",
+	}))
+
+	if err != nil {
+		t.Fatalf("Expected no error in WithEnv(): %v", err)
+	}
+
+	expected := Profile{Username: "envuser", Password: "envpass", AccountID: 3, MailboxID: 7}
+
+	if reflect.DeepEqual(expected, got) == false {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	if _, err := p.WithEnv(envFrom(map[string]string{"SNAPPY_ACCOUNT": "abc"})); err == nil {
+		t.Error("expected an error for a bad account id")
+	}
+}
@@ -0,0 +1,106 @@
+package snappy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConflictError is returned instead of replying when a ticket has had notes
+// added since it was read, so two people don't answer the same customer
+type ConflictError struct {
+	// Ticket is the ticket as it is now
+	Ticket Ticket
+
+	// Notes are the notes added since the ticket was read, oldest first
+	Notes []Note
+}
+
+func (e *ConflictError) Error() string {
+	authors := []string{}
+	seen := map[string]bool{}
+	for _, n := range e.Notes {
+		author := noteAuthor(n)
+		if !seen[author] {
+			seen[author] = true
+			authors = append(authors, author)
+		}
+	}
+
+	plural := "s"
+	if len(e.Notes) == 1 {
+		plural = ""
+	}
+
+	return fmt.Sprintf("snappy: ticket %d has %d new note%s since it was read, from %s", e.Ticket.ID, len(e.Notes), plural, strings.Join(authors, ", "))
+}
+
+// noteAuthor describes who wrote a note
+func noteAuthor(n Note) string {
+	if n.CreatedByStaffID != 0 {
+		return fmt.Sprintf("staff %d", n.CreatedByStaffID)
+	}
+
+	name := strings.TrimSpace(n.Creator.FirstName + " " + n.Creator.LastName)
+	switch {
+	case name != "" && n.Creator.Address != "":
+		return fmt.Sprintf("%s <%s>", name, n.Creator.Address)
+	case n.Creator.Address != "":
+		return n.Creator.Address
+	case name != "":
+		return name
+	}
+	return "unknown"
+}
+
+// IsConflict reports whether err is a ConflictError
+func IsConflict(err error) bool {
+	_, ok := err.(*ConflictError)
+	return ok
+}
+
+// CheckConflict gets the ticket again and returns a ConflictError if notes
+// were added to it after seen, the ticket as the caller read it. A change to
+// the ticket without new notes, like new tags, isn't a conflict
+func (s *Snappy) CheckConflict(seen Ticket) error {
+	current, err := s.Ticket(seen.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.CheckConflictWith(seen, current)
+}
+
+// CheckConflictWith is CheckConflict for callers that already have the
+// ticket as it is now, current
+func (s *Snappy) CheckConflictWith(seen, current Ticket) error {
+	if current.LastReplyAt == seen.LastReplyAt && current.UpdatedAt == seen.UpdatedAt {
+		return nil
+	}
+
+	since := int64(seen.LastReplyAt)
+	if updated, err := time.Parse(TimeLayout, seen.UpdatedAt); err == nil && updated.Unix() > since {
+		since = updated.Unix()
+	}
+
+	notes, err := s.TicketNotes(seen.ID)
+	if err != nil {
+		return err
+	}
+
+	var added []Note
+	for _, n := range notes {
+		if int64(n.CreatedAt) > since {
+			added = append(added, n)
+		}
+	}
+
+	if len(added) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(added, func(i, j int) bool { return added[i].CreatedAt < added[j].CreatedAt })
+
+	return &ConflictError{Ticket: current, Notes: added}
+}
@@ -0,0 +1,72 @@
+package snappy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCheckConflict(t *testing.T) {
+	setup()
+	defer teardown()
+
+	current := `{"id":1,"mailbox_id":2,"nonce":"abc","last_reply_at":300,"updated_at":"1970-01-01 00:05:00"}`
+	mux.HandleFunc("/ticket/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, current)
+	})
+	mux.HandleFunc("/ticket/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"id":1,"created_at":100,"creator":{"first_name":"Test","last_name":"1","address":"test@test.com"}},
+			{"id":3,"created_at":300,"created_by_staff_id":4},
+			{"id":2,"created_at":250,"creator":{"first_name":"Test","last_name":"1","address":"test@test.com"}}
+		]`)
+	})
+
+	seen := Ticket{ID: 1, LastReplyAt: 100, UpdatedAt: "1970-01-01 00:03:20"}
+
+	err := client.CheckConflict(seen)
+	conflict, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatalf("Expected a ConflictError, got %v", err)
+	}
+
+	if len(conflict.Notes) != 2 || conflict.Notes[0].ID != 2 || conflict.Notes[1].ID != 3 || conflict.Ticket.LastReplyAt != 300 {
+		t.Errorf("Unexpected conflict %+v", conflict)
+	}
+
+	if expected := "snappy: ticket 1 has 2 new notes since it was read, from Test 1 <test@test.com>, staff 4"; err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+
+	// nothing changed
+	seen = Ticket{ID: 1, LastReplyAt: 300, UpdatedAt: "1970-01-01 00:05:00"}
+	if err := client.CheckConflict(seen); err != nil {
+		t.Errorf("Expected no conflict for an unchanged ticket, got %v", err)
+	}
+
+	// changed, like new tags, without new notes
+	current = `{"id":1,"last_reply_at":300,"updated_at":"1970-01-01 00:06:00"}`
+	if err := client.CheckConflict(seen); err != nil {
+		t.Errorf("Expected no conflict without new notes, got %v", err)
+	}
+}
+
+func TestReplyToTicketConflict(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/ticket/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1,"last_reply_at":200}`)
+	})
+	mux.HandleFunc("/ticket/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":2,"created_at":200,"created_by_staff_id":4}]`)
+	})
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no note to be created")
+	})
+
+	_, err := client.ReplyToTicket(replyTicket, "thanks!", ReplyOptions{CheckConflicts: true})
+	if !IsConflict(err) {
+		t.Errorf("Expected a ConflictError, got %v", err)
+	}
+}
@@ -0,0 +1,443 @@
+// Package email converts between Snappy tickets and standard email formats:
+// RFC 5322 messages (.eml files) and mbox mailboxes.
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+// Conversation is a ticket together with its notes
+type Conversation struct {
+	Ticket snappy.Ticket
+	Notes  []snappy.Note
+}
+
+// AttachmentFunc fetches the contents of a ticket attachment
+type AttachmentFunc func(ticketID, attachmentID int) (io.ReadCloser, error)
+
+// Converter turns conversations into email messages
+type Converter struct {
+	// Attachments fetches attachments to embed. When nil attachments are left out
+	Attachments AttachmentFunc
+}
+
+// NewConverter creates a Converter that embeds attachments downloaded with client
+func NewConverter(client *snappy.Snappy) *Converter {
+	return &Converter{
+		Attachments: client.DownloadTicketAttachment,
+	}
+}
+
+// Message is a single RFC 5322 message
+type Message struct {
+	Header textproto.MIMEHeader
+	Body   []byte
+
+	// From and Date are kept around for the mbox separator line
+	From string
+	Date time.Time
+}
+
+// headerOrder is the order headers are written in, anything else follows sorted
+var headerOrder = []string{
+	"Message-Id", "In-Reply-To", "References", "Date", "From", "To", "Subject",
+	"Mime-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// WriteTo writes the message with CRLF line endings, as RFC 5322 wants
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+
+	written := map[string]bool{}
+	writeHeader := func(key string) {
+		for _, v := range m.Header[key] {
+			fmt.Fprintf(&b, "%s: %s\r\n", displayKey(key), v)
+		}
+		written[key] = true
+	}
+
+	for _, key := range headerOrder {
+		writeHeader(key)
+	}
+
+	var rest []string
+	for key := range m.Header {
+		if !written[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	for _, key := range rest {
+		writeHeader(key)
+	}
+
+	b.WriteString("\r\n")
+	b.Write(m.Body)
+
+	return b.WriteTo(w)
+}
+
+// displayKey undoes the canonical casing of the headers that read oddly with it
+func displayKey(key string) string {
+	switch key {
+	case "Message-Id":
+		return "Message-ID"
+	case "Mime-Version":
+		return "MIME-Version"
+	}
+	return key
+}
+
+// messageID builds the Message-ID for a note, without the angle brackets
+func messageID(t snappy.Ticket, noteID int) string {
+	return fmt.Sprintf("note-%d.ticket-%d@%s", noteID, t.ID, domain(t))
+}
+
+// domain is the domain of the ticket's mailbox, used to make Message-IDs unique
+func domain(t snappy.Ticket) string {
+	for _, address := range []string{t.Mailbox.Address, t.Mailbox.CustomAddress} {
+		if i := strings.LastIndex(address, "@"); i >= 0 && i < len(address)-1 {
+			return address[i+1:]
+		}
+	}
+	return "snappy.invalid"
+}
+
+func contactAddress(c snappy.Contact) *mail.Address {
+	address := c.Address
+	if address == "" {
+		address = c.Value
+	}
+
+	if address == "" {
+		return nil
+	}
+
+	return &mail.Address{
+		Name:    strings.TrimSpace(c.FirstName + " " + c.LastName),
+		Address: address,
+	}
+}
+
+func mailboxAddress(t snappy.Ticket) *mail.Address {
+	address := t.Mailbox.CustomAddress
+	if address == "" {
+		address = t.Mailbox.Address
+	}
+
+	if address == "" {
+		return nil
+	}
+
+	return &mail.Address{Name: t.Mailbox.Display, Address: address}
+}
+
+func addressList(addresses []*mail.Address) string {
+	parts := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		parts = append(parts, a.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// recipients works out who a note went to. A customer writes to the mailbox,
+// staff write to everyone on the ticket other than themselves
+func recipients(t snappy.Ticket, n snappy.Note, from *mail.Address) []*mail.Address {
+	if n.CreatedByContactID != 0 {
+		if mb := mailboxAddress(t); mb != nil {
+			return []*mail.Address{mb}
+		}
+	}
+
+	var to []*mail.Address
+	seen := map[string]bool{}
+	if from != nil {
+		seen[strings.ToLower(from.Address)] = true
+	}
+
+	contacts := t.Contacts
+	if len(n.Contacts) > 0 {
+		contacts = n.Contacts
+	}
+	if len(contacts) == 0 {
+		contacts = []snappy.Contact{t.Opener}
+	}
+
+	for _, c := range contacts {
+		a := contactAddress(c)
+		if a == nil || seen[strings.ToLower(a.Address)] {
+			continue
+		}
+		seen[strings.ToLower(a.Address)] = true
+		to = append(to, a)
+	}
+
+	return to
+}
+
+// Messages converts a conversation into one message per note, in order,
+// threaded together with In-Reply-To and References
+func (c *Converter) Messages(conv Conversation) ([]*Message, error) {
+	notes := append([]snappy.Note{}, conv.Notes...)
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].CreatedAt < notes[j].CreatedAt
+	})
+
+	var messages []*Message
+	var references []string
+
+	for i, n := range notes {
+		m, err := c.message(conv.Ticket, n, i > 0, references)
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, m)
+		references = append(references, "<"+messageID(conv.Ticket, n.ID)+">")
+	}
+
+	return messages, nil
+}
+
+func (c *Converter) message(t snappy.Ticket, n snappy.Note, reply bool, references []string) (*Message, error) {
+	h := textproto.MIMEHeader{}
+
+	from := contactAddress(n.Creator)
+	if from == nil {
+		from = mailboxAddress(t)
+	}
+
+	subject := t.DefaultSubject
+	if reply && !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+
+	date := time.Unix(int64(n.CreatedAt), 0).UTC()
+
+	h.Set("Message-Id", "<"+messageID(t, n.ID)+">")
+	if len(references) > 0 {
+		h.Set("In-Reply-To", references[len(references)-1])
+		h.Set("References", strings.Join(references, " "))
+	}
+	h.Set("Date", date.Format(time.RFC1123Z))
+	if from != nil {
+		h.Set("From", from.String())
+	}
+	if to := recipients(t, n, from); len(to) > 0 {
+		h.Set("To", addressList(to))
+	}
+	h.Set("Subject", mime.QEncoding.Encode("utf-8", subject))
+	h.Set("Mime-Version", "1.0")
+	h.Set("X-Snappy-Ticket", fmt.Sprint(t.ID))
+	h.Set("X-Snappy-Note", fmt.Sprint(n.ID))
+	if n.Scope != "" {
+		h.Set("X-Snappy-Scope", n.Scope)
+	}
+
+	var body bytes.Buffer
+	attachments := n.Attachments
+	if c.Attachments == nil {
+		attachments = nil
+	}
+
+	if len(attachments) == 0 {
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+		if err := writeQuotedPrintable(&body, n.Content); err != nil {
+			return nil, err
+		}
+	} else {
+		mw := multipart.NewWriter(&body)
+		h.Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"text/html; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(part, n.Content); err != nil {
+			return nil, err
+		}
+
+		for _, doc := range attachments {
+			if err := c.writeAttachment(mw, t.ID, doc); err != nil {
+				return nil, fmt.Errorf("email: attachment %d of ticket %d: %v", doc.ID, t.ID, err)
+			}
+		}
+
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &Message{
+		Header: h,
+		Body:   body.Bytes(),
+		Date:   date,
+	}
+	if from != nil {
+		m.From = from.Address
+	}
+
+	return m, nil
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qw, s); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+func (c *Converter) writeAttachment(mw *multipart.Writer, ticketID int, doc snappy.Document) error {
+	rc, err := c.Attachments(ticketID, doc.ID)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+
+	contentType := doc.Type
+	if contentType == "" || !strings.Contains(contentType, "/") {
+		contentType = mime.TypeByExtension(filepath.Ext(doc.Filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"name": doc.Filename})},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": doc.Filename})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(part, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = io.WriteString(part, encoded+"\r\n")
+	return err
+}
+
+// MboxWriter writes messages to an mbox file using the mboxrd flavour, where
+// body lines starting with "From " (after any number of ">") gain another ">"
+type MboxWriter struct {
+	w io.Writer
+}
+
+// NewMboxWriter creates a MboxWriter
+func NewMboxWriter(w io.Writer) *MboxWriter {
+	return &MboxWriter{w: w}
+}
+
+// Write adds a message to the mbox
+func (mw *MboxWriter) Write(m *Message) error {
+	var raw bytes.Buffer
+	if _, err := m.WriteTo(&raw); err != nil {
+		return err
+	}
+
+	from := m.From
+	if from == "" {
+		from = "MAILER-DAEMON"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From %s %s\n", from, m.Date.UTC().Format(time.ANSIC))
+
+	text := strings.Replace(raw.String(), "\r\n", "\n", -1)
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			b.WriteString(">")
+		}
+		b.WriteString(line)
+	}
+
+	if !strings.HasSuffix(text, "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	_, err := b.WriteTo(mw.w)
+	return err
+}
+
+// WriteMailboxes writes one <mailbox id>.mbox file per mailbox into dir
+func (c *Converter) WriteMailboxes(dir string, conversations []Conversation) error {
+	byMailbox := map[int][]Conversation{}
+	var ids []int
+
+	for _, conv := range conversations {
+		id := conv.Ticket.MailboxID
+		if _, ok := byMailbox[id]; !ok {
+			ids = append(ids, id)
+		}
+		byMailbox[id] = append(byMailbox[id], conv)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := c.writeMailbox(filepath.Join(dir, fmt.Sprintf("%d.mbox", id)), byMailbox[id]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Converter) writeMailbox(path string, conversations []Conversation) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	mw := NewMboxWriter(f)
+	for _, conv := range conversations {
+		messages, err := c.Messages(conv)
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		for _, m := range messages {
+			if err := mw.Write(m); err != nil {
+				f.Close()
+				return err
+			}
+		}
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,188 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/derekpitt/snappy"
+)
+
+var conversation = Conversation{
+	Ticket: snappy.Ticket{
+		ID:             1,
+		MailboxID:      7,
+		DefaultSubject: "Printer on fire",
+		Mailbox: snappy.Mailbox{
+			Display: "Support",
+			Address: "help@test.besnappy.com",
+		},
+		Contacts: []snappy.Contact{
+			snappy.Contact{FirstName: "Test", LastName: "1", Address: "test1@test.com"},
+		},
+	},
+	Notes: []snappy.Note{
+		snappy.Note{
+			ID:               6,
+			CreatedByStaffID: 3,
+			CreatedAt:        1387831100,
+			Content:          "<p>Have you tried water?</p>\nFrom the desk of support",
+			Creator:          snappy.Contact{FirstName: "Staff", Address: "staff@test.com"},
+			Attachments: []snappy.Document{
+				snappy.Document{ID: 9, Filename: "manual.txt"},
+			},
+		},
+		snappy.Note{
+			ID:                 5,
+			CreatedByContactID: 2,
+			CreatedAt:          1387831051,
+			Content:            "<p>Help, my printer is on fire</p>",
+			Creator:            snappy.Contact{FirstName: "Test", LastName: "1", Address: "test1@test.com"},
+		},
+	},
+}
+
+func testConverter() *Converter {
+	return &Converter{
+		Attachments: func(ticketID, attachmentID int) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("read the manual")), nil
+		},
+	}
+}
+
+func parse(t *testing.T, m *Message) *mail.Message {
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("Expected no error in WriteTo(): %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(&b)
+	if err != nil {
+		t.Fatalf("Expected a parseable message: %v", err)
+	}
+
+	return parsed
+}
+
+func TestMessagesThreading(t *testing.T) {
+	messages, err := testConverter().Messages(conversation)
+
+	if err != nil {
+		t.Fatalf("Expected no error in Messages(): %v", err)
+	}
+
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+
+	first := parse(t, messages[0])
+	second := parse(t, messages[1])
+
+	if got := first.Header.Get("Message-ID"); got != "<note-5.ticket-1@test.besnappy.com>" {
+		t.Errorf("unexpected Message-ID %q", got)
+	}
+
+	if got := first.Header.Get("To"); got != `"Support" <help@test.besnappy.com>` {
+		t.Errorf("expected the customer to write to the mailbox, got %q", got)
+	}
+
+	if got := first.Header.Get("Subject"); got != "Printer on fire" {
+		t.Errorf("unexpected Subject %q", got)
+	}
+
+	if got := second.Header.Get("In-Reply-To"); got != first.Header.Get("Message-ID") {
+		t.Errorf("expected the reply to point at the first message, got %q", got)
+	}
+
+	if got := second.Header.Get("Subject"); got != "Re: Printer on fire" {
+		t.Errorf("unexpected reply Subject %q", got)
+	}
+
+	if got := second.Header.Get("To"); got != `"Test 1" <test1@test.com>` {
+		t.Errorf("expected staff to write to the contacts, got %q", got)
+	}
+
+	date, err := second.Header.Date()
+	if err != nil || date.Unix() != 1387831100 {
+		t.Errorf("unexpected Date %v %v", date, err)
+	}
+}
+
+func TestMessageAttachments(t *testing.T) {
+	messages, _ := testConverter().Messages(conversation)
+	parsed := parse(t, messages[1])
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("expected multipart/mixed, got %q %v", mediaType, err)
+	}
+
+	r := multipart.NewReader(parsed.Body, params["boundary"])
+
+	html, err := r.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(html); !strings.Contains(string(b), "Have you tried water?") {
+		t.Errorf("expected the note content in the first part, got %q", b)
+	}
+
+	attachment, err := r.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attachment.FileName() != "manual.txt" {
+		t.Errorf("unexpected attachment name %q", attachment.FileName())
+	}
+}
+
+func TestMessagesWithoutAttachments(t *testing.T) {
+	messages, _ := (&Converter{}).Messages(conversation)
+	parsed := parse(t, messages[1])
+
+	if got := parsed.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("expected a single html part, got %q", got)
+	}
+}
+
+func TestWriteMailboxes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := testConverter().WriteMailboxes(dir, []Conversation{conversation}); err != nil {
+		t.Fatalf("Expected no error in WriteMailboxes(): %v", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "7.mbox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mbox := string(b)
+
+	if !strings.HasPrefix(mbox, "From test1@test.com Mon Dec 23 20:37:31 2013\n") {
+		t.Errorf("unexpected separator line in %q", mbox[:60])
+	}
+
+	if strings.Count(mbox, "\nFrom ") != 1 {
+		t.Errorf("expected exactly one more separator line, got %d", strings.Count(mbox, "\nFrom "))
+	}
+
+	if !strings.Contains(mbox, "\n>From the desk of support") {
+		t.Error("expected body lines starting with From to be escaped")
+	}
+
+	if strings.Contains(mbox, "\r\n") {
+		t.Error("expected mbox to use plain newlines")
+	}
+}
@@ -0,0 +1,431 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/render"
+)
+
+// Importer turns email messages into notes. The first message of a thread
+// starts a new ticket, and the Importer remembers the nonce the server
+// returns for it. Later messages whose References or In-Reply-To name a
+// message already imported are added to that ticket. An Importer only
+// remembers the messages it imported itself, so importing the same messages
+// twice starts new tickets.
+//
+// The Snappy API has no way to upload attachments, so they are listed in the
+// report but not sent.
+type Importer struct {
+	Client    *snappy.Snappy
+	MailboxID int
+
+	// DryRun builds the notes and the report without sending anything
+	DryRun bool
+
+	// tickets maps the Message-IDs imported to the nonces of their tickets,
+	// which are empty in a dry run
+	tickets map[string]string
+}
+
+// ImportResult describes what happened to a single message
+type ImportResult struct {
+	MessageID string
+	Subject   string
+
+	// Nonce is the ticket's nonce, which isn't known for new tickets in a dry
+	// run. Reply is set when the message was added to a ticket it started
+	Nonce string
+	Reply bool
+	Note  snappy.NewNote
+
+	// Attachments holds the file names of attachments that were not uploaded
+	Attachments []string
+	Err         error
+}
+
+// Report collects the results of an import
+type Report struct {
+	Results  []ImportResult
+	Imported int
+	Failed   int
+	DryRun   bool
+}
+
+// WriteTo writes a human readable summary of the report
+func (r Report) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+
+	verb := "imported"
+	if r.DryRun {
+		verb = "would import"
+	}
+
+	for _, res := range r.Results {
+		kind := "new ticket"
+		if res.Reply {
+			kind = "reply"
+		}
+
+		if res.Err != nil {
+			fmt.Fprintf(&b, "FAILED  %s %q: %v\n", res.MessageID, res.Subject, res.Err)
+			continue
+		}
+
+		if res.Nonce != "" {
+			kind += ", nonce " + res.Nonce
+		}
+
+		fmt.Fprintf(&b, "%-7s %s %q (%s)\n", "OK", res.MessageID, res.Subject, kind)
+		for _, a := range res.Attachments {
+			fmt.Fprintf(&b, "        attachment not uploaded: %s\n", a)
+		}
+	}
+
+	fmt.Fprintf(&b, "%s %d messages, %d failed\n", verb, r.Imported, r.Failed)
+	return b.WriteTo(w)
+}
+
+// ImportMessage imports a single RFC 822 message
+func (im *Importer) ImportMessage(r io.Reader) (res ImportResult, err error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return res, err
+	}
+
+	note, attachments, err := im.noteFromMessage(msg)
+
+	ids := threadIDs(msg.Header)
+	for _, id := range ids[1:] {
+		if nonce, ok := im.tickets[id]; ok {
+			note.TicketNonce, res.Reply = nonce, true
+			break
+		}
+	}
+
+	res.MessageID = ids[0]
+	res.Subject = note.Subject
+	res.Nonce = note.TicketNonce
+	res.Note = note
+	res.Attachments = attachments
+
+	if err != nil {
+		return res, err
+	}
+
+	// a dry run still catches notes the API would turn down
+	if im.DryRun {
+		if err = note.Validate(); err == nil {
+			im.remember(ids, "")
+		}
+		return res, err
+	}
+
+	if res.Nonce, err = im.Client.CreateNoteNonce(note); err != nil {
+		return res, err
+	}
+
+	im.remember(ids, res.Nonce)
+	return res, nil
+}
+
+// remember records the ticket of a message, and of the messages in its
+// thread that weren't imported, so replies to any of them find it
+func (im *Importer) remember(ids []string, nonce string) {
+	if im.tickets == nil {
+		im.tickets = map[string]string{}
+	}
+
+	for _, id := range ids {
+		if _, ok := im.tickets[id]; !ok && id != "" {
+			im.tickets[id] = nonce
+		}
+	}
+}
+
+// ImportMbox imports every message in an mbox file. A message that fails is
+// recorded in the report and the import carries on; the error returned is
+// only for problems reading the mbox itself
+func (im *Importer) ImportMbox(r io.Reader) (report Report, err error) {
+	report.DryRun = im.DryRun
+	mr := NewMboxReader(r)
+
+	for {
+		raw, err := mr.Next()
+		if err == io.EOF {
+			return report, nil
+		}
+
+		if err != nil {
+			return report, err
+		}
+
+		res, err := im.ImportMessage(bytes.NewReader(raw))
+		res.Err = err
+		if err != nil {
+			report.Failed++
+		} else {
+			report.Imported++
+		}
+
+		report.Results = append(report.Results, res)
+	}
+}
+
+// threadIDs returns the message's own Message-ID followed by the ones it
+// replies to, nearest first
+func threadIDs(h mail.Header) []string {
+	ids := []string{strings.Trim(h.Get("Message-Id"), "<> ")}
+
+	for _, id := range strings.Fields(h.Get("In-Reply-To")) {
+		ids = append(ids, strings.Trim(id, "<>"))
+	}
+
+	refs := strings.Fields(h.Get("References"))
+	for i := len(refs) - 1; i >= 0; i-- {
+		ids = append(ids, strings.Trim(refs[i], "<>"))
+	}
+
+	return ids
+}
+
+func noteAddresses(h mail.Header, key string) ([]snappy.NoteAddress, error) {
+	if h.Get(key) == "" {
+		return nil, nil
+	}
+
+	list, err := h.AddressList(key)
+	if err != nil {
+		return nil, fmt.Errorf("email: bad %s header: %v", key, err)
+	}
+
+	addresses := make([]snappy.NoteAddress, len(list))
+	for i, a := range list {
+		addresses[i] = snappy.NoteAddress{Name: a.Name, Address: a.Address}
+	}
+	return addresses, nil
+}
+
+func (im *Importer) noteFromMessage(msg *mail.Message) (note snappy.NewNote, attachments []string, err error) {
+	dec := new(mime.WordDecoder)
+	subject, decodeErr := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if decodeErr != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	note = snappy.NewNote{
+		Subject:   subject,
+		MailboxID: im.MailboxID,
+	}
+
+	if note.From, err = noteAddresses(msg.Header, "From"); err != nil {
+		return
+	}
+
+	if note.To, err = noteAddresses(msg.Header, "To"); err != nil {
+		return
+	}
+
+	body := &body{}
+	if err = body.read(msg.Header, msg.Body); err != nil {
+		return
+	}
+
+	switch {
+	case body.html != "":
+		note.Message = body.html
+	default:
+		note.Message = render.Plain(body.text)
+	}
+
+	return note, body.attachments, nil
+}
+
+// body collects the interesting parts of a MIME message
+type body struct {
+	html        string
+	text        string
+	attachments []string
+}
+
+// header is implemented by both mail.Header and textproto.MIMEHeader
+type header interface {
+	Get(key string) string
+}
+
+func (b *body) read(h header, r io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := b.read(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+
+	if disposition == "attachment" || (filename != "" && !strings.HasPrefix(mediaType, "text/")) {
+		if filename == "" {
+			filename = "unnamed"
+		}
+		b.attachments = append(b.attachments, filename)
+		return nil
+	}
+
+	data, err := ioutil.ReadAll(decodeTransfer(h.Get("Content-Transfer-Encoding"), r))
+	if err != nil {
+		return err
+	}
+
+	text := decodeCharset(params["charset"], data)
+
+	switch mediaType {
+	case "text/html":
+		if b.html == "" {
+			b.html = text
+		}
+	case "text/plain":
+		if b.text == "" {
+			b.text = text
+		}
+	}
+
+	return nil
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &stripSpace{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// stripSpace drops the line breaks base64 bodies are wrapped with
+type stripSpace struct {
+	r io.Reader
+}
+
+func (s *stripSpace) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	j := 0
+	for _, c := range p[:n] {
+		if c != '\r' && c != '\n' && c != ' ' && c != '\t' {
+			p[j] = c
+			j++
+		}
+	}
+	return j, err
+}
+
+// windows1252 holds the characters windows-1252 puts at 0x80 to 0x9F, where
+// ISO-8859-1 has control characters. The five bytes it leaves undefined are
+// kept as they are
+var windows1252 = [32]rune{
+	'\u20ac', '\u0081', '\u201a', '\u0192', '\u201e', '\u2026', '\u2020', '\u2021',
+	'\u02c6', '\u2030', '\u0160', '\u2039', '\u0152', '\u008d', '\u017d', '\u008f',
+	'\u0090', '\u2018', '\u2019', '\u201c', '\u201d', '\u2022', '\u2013', '\u2014',
+	'\u02dc', '\u2122', '\u0161', '\u203a', '\u0153', '\u009d', '\u017e', '\u0178',
+}
+
+// decodeCharset handles the charsets that can be decoded with the standard
+// library. Anything else is passed through as is
+func decodeCharset(charset string, data []byte) string {
+	charset = strings.ToLower(charset)
+
+	switch charset {
+	case "iso-8859-1", "latin1", "windows-1252", "cp1252":
+		windows := charset == "windows-1252" || charset == "cp1252"
+
+		runes := make([]rune, len(data))
+		for i, c := range data {
+			runes[i] = rune(c)
+			if windows && c >= 0x80 && c <= 0x9f {
+				runes[i] = windows1252[c-0x80]
+			}
+		}
+		return string(runes)
+	}
+	return string(data)
+}
+
+// MboxReader splits an mbox file into messages, undoing mboxrd quoting
+type MboxReader struct {
+	r       *bufio.Reader
+	started bool
+}
+
+// NewMboxReader creates a MboxReader
+func NewMboxReader(r io.Reader) *MboxReader {
+	return &MboxReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next raw message, or io.EOF when there are no more
+func (mr *MboxReader) Next() ([]byte, error) {
+	var msg bytes.Buffer
+
+	for {
+		line, err := mr.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		switch {
+		case strings.HasPrefix(line, "From "):
+			// the separator line starts the next message
+			if mr.started {
+				return trimSeparator(msg.Bytes()), nil
+			}
+			mr.started = true
+		case mr.started:
+			if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+				line = line[1:]
+			}
+			msg.WriteString(line)
+		}
+
+		if err == io.EOF {
+			if msg.Len() == 0 {
+				return nil, io.EOF
+			}
+			return trimSeparator(msg.Bytes()), nil
+		}
+	}
+}
+
+// trimSeparator drops the blank line that separates messages in an mbox
+func trimSeparator(b []byte) []byte {
+	if bytes.HasSuffix(b, []byte("\n\n")) {
+		return b[:len(b)-1]
+	}
+	return b
+}
@@ -0,0 +1,193 @@
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/derekpitt/snappy"
+)
+
+const testMbox = `From test1@test.com Mon Dec 23 20:37:31 2013
+Message-ID: <root@test.com>
+From: "Test 1" <test1@test.com>
+To: help@test.besnappy.com
+Subject: =?utf-8?q?Printer_=C3=A9_fire?=
+Content-Type: text/plain; charset=utf-8
+
+Help, my printer is on fire.
+>From what I can tell <it's> bad.
+
+From staff@test.com Mon Dec 23 20:40:00 2013
+Message-ID: <reply@test.com>
+In-Reply-To: <root@test.com>
+References: <root@test.com>
+From: Staff <staff@test.com>
+To: "Test 1" <test1@test.com>
+Subject: Re: Printer on fire
+Content-Type: multipart/mixed; boundary=XYZ
+
+--XYZ
+Content-Type: multipart/alternative; boundary=ALT
+
+--ALT
+Content-Type: text/plain
+
+plain version
+--ALT
+Content-Type: text/html; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+<p>Have you tried =3Dwater?</p>
+--ALT--
+--XYZ
+Content-Type: application/pdf; name=manual.pdf
+Content-Disposition: attachment; filename=manual.pdf
+Content-Transfer-Encoding: base64
+
+aGV5IG5vdyE=
+--XYZ--
+
+From broken@test.com Mon Dec 23 20:41:00 2013
+From: not an address <<<
+Subject: broken
+
+nope
+`
+
+func TestImportMboxDryRun(t *testing.T) {
+	im := &Importer{MailboxID: 7, DryRun: true}
+
+	report, err := im.ImportMbox(strings.NewReader(testMbox))
+
+	if err != nil {
+		t.Fatalf("Expected no error in ImportMbox(): %v", err)
+	}
+
+	if len(report.Results) != 3 || report.Imported != 2 || report.Failed != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	first, second := report.Results[0], report.Results[1]
+
+	expected := snappy.NewNote{
+		Subject:   "Printer é fire",
+		Message:   "<p>Help, my printer is on fire.<br>From what I can tell &lt;it&#39;s&gt; bad.</p>",
+		MailboxID: 7,
+		From:      []snappy.NoteAddress{{Name: "Test 1", Address: "test1@test.com"}},
+		To:        []snappy.NoteAddress{{Address: "help@test.besnappy.com"}},
+	}
+
+	if reflect.DeepEqual(expected, first.Note) == false {
+		t.Errorf("expected %+v, got %+v", expected, first.Note)
+	}
+
+	if first.Reply || !second.Reply {
+		t.Error("expected only the second message to be a reply")
+	}
+
+	if first.Nonce != "" || second.Nonce != "" {
+		t.Errorf("expected no nonces before the server made the ticket, got %q and %q", first.Nonce, second.Nonce)
+	}
+
+	if second.Note.Message != "<p>Have you tried =water?</p>" {
+		t.Errorf("expected the html part to be preferred, got %q", second.Note.Message)
+	}
+
+	if reflect.DeepEqual([]string{"manual.pdf"}, second.Attachments) == false {
+		t.Errorf("expected the attachment to be reported, got %v", second.Attachments)
+	}
+
+	var out bytes.Buffer
+	report.WriteTo(&out)
+
+	if !strings.Contains(out.String(), "would import 2 messages, 1 failed") {
+		t.Errorf("unexpected report output %q", out.String())
+	}
+}
+
+func TestImportSendsNotes(t *testing.T) {
+	var got []snappy.NewNote
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var note snappy.NewNote
+		json.NewDecoder(r.Body).Decode(&note)
+		got = append(got, note)
+
+		if note.TicketNonce == "" {
+			fmt.Fprintf(w, "%q", "ticket1")
+		}
+	}))
+	defer server.Close()
+
+	client := snappy.WithAPIKey("apikey")
+	client.SetEndpointPrefix(server.URL)
+
+	im := &Importer{Client: client, MailboxID: 7}
+	report, err := im.ImportMbox(strings.NewReader(testMbox))
+
+	if err != nil {
+		t.Fatalf("Expected no error in ImportMbox(): %v", err)
+	}
+
+	if len(got) != 2 || report.Imported != 2 {
+		t.Fatalf("expected 2 notes to be sent, got %d", len(got))
+	}
+
+	if got[0].TicketNonce != "" || got[1].TicketNonce != "ticket1" {
+		t.Errorf("expected the reply to be sent to the ticket the first message made, got %q and %q", got[0].TicketNonce, got[1].TicketNonce)
+	}
+
+	if report.Results[0].Nonce != "ticket1" || report.Results[1].Nonce != "ticket1" {
+		t.Errorf("expected the nonce in the report, got %+v", report.Results)
+	}
+}
+
+func TestMboxRoundTrip(t *testing.T) {
+	var b bytes.Buffer
+	mw := NewMboxWriter(&b)
+
+	messages, _ := (&Converter{}).Messages(conversation)
+	for _, m := range messages {
+		mw.Write(m)
+	}
+
+	im := &Importer{MailboxID: 7, DryRun: true}
+	report, err := im.ImportMbox(&b)
+
+	if err != nil || report.Imported != 2 {
+		t.Fatalf("expected to import our own mbox, got %+v %v", report, err)
+	}
+
+	if !strings.Contains(report.Results[1].Note.Message, "\nFrom the desk of support") {
+		t.Errorf("expected the From line to be unescaped, got %q", report.Results[1].Note.Message)
+	}
+
+	if report.Results[0].Reply || !report.Results[1].Reply {
+		t.Error("expected exported threads to import as one ticket")
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	cases := []struct {
+		charset  string
+		data     []byte
+		expected string
+	}{
+		{"windows-1252", []byte("\x93caf\xe9\x94 \x80 5\x85"), "\u201ccaf\u00e9\u201d \u20ac 5\u2026"},
+		{"Windows-1252", []byte("\x81\x9f"), "\u0081\u0178"},
+		{"iso-8859-1", []byte("caf\xe9 \x80"), "caf\u00e9 \u0080"},
+		{"utf-8", []byte("caf\xc3\xa9"), "caf\u00e9"},
+	}
+
+	for _, c := range cases {
+		if got := decodeCharset(c.charset, c.data); got != c.expected {
+			t.Errorf("%s %q: expected %q, got %q", c.charset, c.data, c.expected, got)
+		}
+	}
+}
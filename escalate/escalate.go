@@ -0,0 +1,482 @@
+// Package escalate chases tickets that have been waiting on staff too long.
+// An Escalator looks through the waiting tickets of mailboxes for ones the
+// customer replied to last, and as the wait passes each Tier's threshold it
+// tags the ticket, posts to the wall, or notifies someone, e.g.
+//
+//	escalate.New(client, accountID, []escalate.Tier{
+//		{Name: "stale", After: 4 * time.Hour, Tags: []string{"#stale"}},
+//		{Name: "wall", After: 8 * time.Hour, Wall: "{{.Mention}} ticket {{.Ticket.ID}} has waited {{.Wait}}"},
+//		{Name: "manager", After: 24 * time.Hour, Notify: "Ticket {{.Ticket.ID}} has waited a day"},
+//	})
+//
+// The tiers that fired are remembered per ticket, and forgotten once staff
+// reply or the ticket leaves the waiting listing, so each tier fires once
+// per wait.
+package escalate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/calendar"
+	"github.com/derekpitt/snappy/internal/atomicfile"
+	"github.com/derekpitt/snappy/notify"
+)
+
+// Tier is a step of escalation. Message templates are executed with Data
+type Tier struct {
+	Name string
+
+	// After is how long the customer has to have been waiting
+	After time.Duration
+
+	// Tags are added to the ticket
+	Tags []string
+
+	// Wall is posted to the wall, linked to the ticket
+	Wall string
+
+	// Notify is the body of a message sent through the Escalator's Notifier
+	Notify string
+}
+
+// Data is what tier messages are executed with
+type Data struct {
+	Ticket snappy.Ticket
+	Tier   string
+	Wait   time.Duration
+
+	// Assignee is the username of the staff member the ticket is assigned to
+	// and Mention is "@" and that, both are empty when it is unassigned
+	Assignee string
+	Mention  string
+}
+
+// Validate checks that a tier does something and its templates parse
+func (t Tier) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("escalate: a tier needs a name")
+	}
+
+	if t.After <= 0 {
+		return fmt.Errorf("escalate: %s: no threshold", t.Name)
+	}
+
+	if len(t.Tags) == 0 && strings.TrimSpace(t.Wall) == "" && strings.TrimSpace(t.Notify) == "" {
+		return fmt.Errorf("escalate: %s: no tags, wall post or notification", t.Name)
+	}
+
+	for _, message := range []string{t.Wall, t.Notify} {
+		if _, err := template.New("").Parse(message); err != nil {
+			return fmt.Errorf("escalate: %s: %v", t.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func execute(message string, d Data) (string, error) {
+	tmpl, err := template.New("").Parse(message)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// TicketState is what is remembered about a waiting ticket
+type TicketState struct {
+	// Since is when the customer started waiting, as a unix time. Replies
+	// from the customer while they wait don't move it
+	Since int64 `json:"since"`
+
+	// Done holds the "tier/action" keys already carried out
+	Done map[string]bool `json:"done"`
+
+	// MailboxID is the mailbox the ticket was seen waiting in
+	MailboxID int `json:"mailbox_id"`
+
+	// LastReplyAt and FirstStaffReplyAt are the ticket's when last seen, a
+	// change means someone replied since
+	LastReplyAt       int64  `json:"last_reply_at"`
+	FirstStaffReplyAt string `json:"first_staff_reply_at"`
+}
+
+// State is what an Escalator remembers between runs
+type State struct {
+	Tickets map[int]*TicketState `json:"tickets"`
+}
+
+// LoadState reads a State from a file. A missing file is an empty State
+func LoadState(path string) (s *State, err error) {
+	s = &State{Tickets: map[int]*TicketState{}}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("escalate: %s: %v", path, err)
+	}
+
+	if s.Tickets == nil {
+		s.Tickets = map[int]*TicketState{}
+	}
+
+	return
+}
+
+// Save writes a State to a file, through a temporary file renamed into place
+func (s *State) Save(path string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(path, b, 0644)
+}
+
+// Event records an escalation action
+type Event struct {
+	Time     time.Time `json:"time"`
+	TicketID int       `json:"ticket_id"`
+	Tier     string    `json:"tier"`
+	Action   string    `json:"action"`
+	Detail   string    `json:"detail"`
+	DryRun   bool      `json:"dry_run"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Escalator escalates waiting tickets through tiers
+type Escalator struct {
+	Client    *snappy.Snappy
+	AccountID int
+	Tiers     []Tier
+
+	// Notifier sends the Notify messages of tiers, to a manager say
+	Notifier notify.Notifier
+
+	// Calendar makes waits count business hours only when set
+	Calendar *calendar.Calendar
+
+	// State is loaded from StatePath when nil, and saved there after every
+	// run when StatePath is set
+	State     *State
+	StatePath string
+
+	// DryRun records what would be done without doing it or changing State
+	DryRun bool
+
+	// Now is time.Now unless set
+	Now func() time.Time
+}
+
+// New creates an Escalator, checking the tiers first
+func New(client *snappy.Snappy, accountID int, tiers []Tier) (*Escalator, error) {
+	names := map[string]bool{}
+	for _, t := range tiers {
+		if err := t.Validate(); err != nil {
+			return nil, err
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("escalate: %s: the name is used twice", t.Name)
+		}
+		names[t.Name] = true
+	}
+
+	sorted := append([]Tier{}, tiers...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].After < sorted[j].After })
+
+	return &Escalator{
+		Client:    client,
+		AccountID: accountID,
+		Tiers:     sorted,
+	}, nil
+}
+
+func (e *Escalator) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
+
+func (e *Escalator) wait(since, now time.Time) time.Duration {
+	if e.Calendar != nil {
+		return e.Calendar.Duration(since, now)
+	}
+	return now.Sub(since)
+}
+
+// assignee returns the username a ticket is assigned to
+func assignee(t snappy.Ticket) string {
+	for _, tag := range t.Tags {
+		if strings.HasPrefix(tag, "@") {
+			return tag[1:]
+		}
+	}
+	return ""
+}
+
+// Run escalates the waiting tickets of mailboxes once. It is meant to be
+// called every few minutes, see Watch. Actions that fail are returned with
+// their error and tried again next run
+func (e *Escalator) Run(mailboxIDs ...int) (events []Event, err error) {
+	if e.State == nil {
+		e.State = &State{Tickets: map[int]*TicketState{}}
+		if e.StatePath != "" {
+			if e.State, err = LoadState(e.StatePath); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	state := e.State
+	if e.DryRun {
+		state = &State{Tickets: map[int]*TicketState{}}
+		for id, ts := range e.State.Tickets {
+			copied := *ts
+			copied.Done = map[string]bool{}
+			for k, v := range ts.Done {
+				copied.Done[k] = v
+			}
+			state.Tickets[id] = &copied
+		}
+	}
+
+	now := e.now()
+	waiting := map[int]bool{}
+	walked := map[int]bool{}
+
+	// a mailbox that fails part way isn't counted as walked, so what is
+	// known about its tickets is kept, and what was done so far is saved
+	for _, id := range mailboxIDs {
+		var walkedEvents []Event
+		walkedEvents, err = e.walk(id, state, waiting, now)
+		events = append(events, walkedEvents...)
+		if err != nil {
+			break
+		}
+		walked[id] = true
+	}
+
+	// staff replied to, or closed, the tickets that stopped waiting. Tickets
+	// of mailboxes not walked this run are left alone
+	for id, ts := range state.Tickets {
+		if !waiting[id] && (walked[ts.MailboxID] || ts.MailboxID == 0) {
+			delete(state.Tickets, id)
+		}
+	}
+
+	if e.StatePath != "" && !e.DryRun {
+		if saveErr := state.Save(e.StatePath); err == nil {
+			err = saveErr
+		}
+	}
+
+	return
+}
+
+// walk escalates the waiting tickets of one mailbox, marking them in waiting
+func (e *Escalator) walk(mailboxID int, state *State, waiting map[int]bool, now time.Time) (events []Event, err error) {
+	tickets, err := e.Client.WaitingAtMailbox(mailboxID)
+	if err != nil {
+		return nil, fmt.Errorf("escalate: waiting tickets of mailbox %d: %v", mailboxID, err)
+	}
+
+	for _, t := range tickets {
+		if t.LastReplyBy != "customer" {
+			continue
+		}
+		waiting[t.ID] = true
+
+		ts := state.Tickets[t.ID]
+		if ts != nil {
+			replied, err := e.staffReplied(t, ts)
+			if err != nil {
+				return events, err
+			}
+			if replied {
+				ts = nil
+			}
+		}
+
+		if ts == nil {
+			ts = &TicketState{Since: int64(t.LastReplyAt), Done: map[string]bool{}}
+			state.Tickets[t.ID] = ts
+		}
+		ts.MailboxID = mailboxID
+		ts.LastReplyAt = int64(t.LastReplyAt)
+		ts.FirstStaffReplyAt = t.FirstStaffReplyAt
+
+		events = append(events, e.escalate(t, ts, now)...)
+	}
+
+	return
+}
+
+// staffReplied tells whether staff replied to a waiting ticket since it was
+// last seen, even though the customer has replied again since. The notes
+// are only fetched when the ticket's last reply moved
+func (e *Escalator) staffReplied(t snappy.Ticket, ts *TicketState) (bool, error) {
+	if ts.LastReplyAt == 0 {
+		// kept before the replies were remembered
+		return false, nil
+	}
+
+	if t.FirstStaffReplyAt != ts.FirstStaffReplyAt {
+		return true, nil
+	}
+
+	if int64(t.LastReplyAt) == ts.LastReplyAt {
+		return false, nil
+	}
+
+	notes, err := e.Client.TicketNotes(t.ID)
+	if err != nil {
+		return false, fmt.Errorf("escalate: notes for ticket %d: %v", t.ID, err)
+	}
+
+	for _, n := range notes {
+		if n.CreatedByStaffID != 0 && int64(n.CreatedAt) > ts.LastReplyAt {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (e *Escalator) escalate(t snappy.Ticket, ts *TicketState, now time.Time) (events []Event) {
+	wait := e.wait(time.Unix(ts.Since, 0), now)
+
+	d := Data{
+		Ticket:   t,
+		Wait:     wait,
+		Assignee: assignee(t),
+	}
+	if d.Assignee != "" {
+		d.Mention = "@" + d.Assignee
+	}
+
+	record := func(tier, action, detail string, err error) {
+		event := Event{Time: now, TicketID: t.ID, Tier: tier, Action: action, Detail: detail, DryRun: e.DryRun}
+		if err != nil {
+			event.Error = err.Error()
+		} else {
+			ts.Done[tier+"/"+action] = true
+		}
+		events = append(events, event)
+	}
+
+	tags := append([]string{}, t.Tags...)
+
+	for _, tier := range e.Tiers {
+		if wait < tier.After {
+			break
+		}
+		d.Tier = tier.Name
+
+		if len(tier.Tags) > 0 && !ts.Done[tier.Name+"/tags"] {
+			var err error
+			if added := addTags(tags, tier.Tags); len(added) > len(tags) && !e.DryRun {
+				if err = e.Client.UpdateTags(t.ID, added...); err == nil {
+					tags = added
+				}
+			}
+			record(tier.Name, "tags", "+"+strings.Join(tier.Tags, " +"), err)
+		}
+
+		if tier.Wall != "" && !ts.Done[tier.Name+"/wall"] {
+			message, err := execute(tier.Wall, d)
+			if err == nil && !e.DryRun {
+				err = e.Client.CreateWallPost(e.AccountID, snappy.NewWallPost{
+					Content:  message,
+					Type:     "post",
+					TicketID: t.ID,
+				})
+			}
+			record(tier.Name, "wall", message, err)
+		}
+
+		if tier.Notify != "" && !ts.Done[tier.Name+"/notify"] {
+			message, err := execute(tier.Notify, d)
+			if err == nil && !e.DryRun {
+				if e.Notifier == nil {
+					err = fmt.Errorf("no notifier")
+				} else {
+					err = e.Notifier.Notify(notify.Message{
+						Subject: fmt.Sprintf("Ticket %d escalated (%s): %s", t.ID, tier.Name, t.DefaultSubject),
+						Body:    message,
+						Time:    now,
+						Event:   "escalation",
+						Ticket:  &t,
+					})
+				}
+			}
+			record(tier.Name, "notify", message, err)
+		}
+	}
+
+	return
+}
+
+// addTags returns tags with the missing ones of add added
+func addTags(tags, add []string) []string {
+	result := append([]string{}, tags...)
+	for _, tag := range add {
+		found := false
+		for _, t := range result {
+			if strings.EqualFold(t, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// Watch calls Run every interval until stop is closed, passing what each
+// run did to handle. Errors don't stop it, the next run tries again
+func (e *Escalator) Watch(interval time.Duration, stop <-chan struct{}, handle func([]Event, error), mailboxIDs ...int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		events, err := e.Run(mailboxIDs...)
+		if handle != nil {
+			handle(events, err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
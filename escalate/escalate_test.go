@@ -0,0 +1,345 @@
+package escalate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/notify"
+)
+
+var (
+	mux    *http.ServeMux
+	server *httptest.Server
+	client *snappy.Snappy
+)
+
+func setup() {
+	mux = http.NewServeMux()
+	server = httptest.NewServer(mux)
+
+	client = snappy.WithAPIKey("apikey")
+	client.SetEndpointPrefix(server.URL)
+}
+
+func teardown() {
+	server.Close()
+}
+
+var start = time.Date(2014, 1, 2, 8, 0, 0, 0, time.UTC)
+
+type notifier struct {
+	sent []notify.Message
+	err  error
+}
+
+func (n *notifier) Notify(m notify.Message) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, m)
+	return nil
+}
+
+func testTiers() []Tier {
+	return []Tier{
+		{Name: "manager", After: 24 * time.Hour, Notify: "Ticket {{.Ticket.ID}} has waited {{.Wait}}"},
+		{Name: "stale", After: 4 * time.Hour, Tags: []string{"#stale"}},
+		{Name: "wall", After: 8 * time.Hour, Wall: "{{.Mention}} ticket {{.Ticket.ID}} needs a reply"},
+	}
+}
+
+// server state for one waiting ticket
+type waiting struct {
+	lastReplyBy string
+	lastReplyAt time.Time
+	tags        []string
+	posts       []snappy.NewWallPost
+
+	// staffNoteAt is when staff last replied, when set
+	staffNoteAt time.Time
+}
+
+func (w *waiting) handle() {
+	mux.HandleFunc("/mailbox/2/tickets", func(rw http.ResponseWriter, r *http.Request) {
+		tags, _ := json.Marshal(w.tags)
+		fmt.Fprintf(rw, `[{"id":7,"default_subject":"Help","last_reply_by":%q,"last_reply_at":%d,"tags":%s}]`, w.lastReplyBy, w.lastReplyAt.Unix(), tags)
+	})
+	mux.HandleFunc("/ticket/7/tags", func(rw http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		json.Unmarshal([]byte(r.PostForm.Get("tags")), &w.tags)
+	})
+	mux.HandleFunc("/ticket/7/notes", func(rw http.ResponseWriter, r *http.Request) {
+		if w.staffNoteAt.IsZero() {
+			fmt.Fprint(rw, `[]`)
+			return
+		}
+		fmt.Fprintf(rw, `[{"id":1,"created_by_staff_id":4,"created_at":%d}]`, w.staffNoteAt.Unix())
+	})
+	mux.HandleFunc("/account/1/wall", func(rw http.ResponseWriter, r *http.Request) {
+		var p snappy.NewWallPost
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &p)
+		w.posts = append(w.posts, p)
+	})
+}
+
+func actions(events []Event) (result []string) {
+	for _, e := range events {
+		result = append(result, e.Tier+"/"+e.Action)
+	}
+	return
+}
+
+func TestRun(t *testing.T) {
+	setup()
+	defer teardown()
+
+	w := &waiting{lastReplyBy: "customer", lastReplyAt: start, tags: []string{"@sam"}}
+	w.handle()
+
+	e, err := New(client, 1, testTiers())
+	if err != nil {
+		t.Fatalf("Expected no error in New(), got %v", err)
+	}
+
+	n := &notifier{}
+	e.Notifier = n
+	now := start.Add(9 * time.Hour)
+	e.Now = func() time.Time { return now }
+
+	events, err := e.Run(2)
+	if err != nil {
+		t.Fatalf("Expected no error in Run(), got %v", err)
+	}
+
+	if expected := []string{"stale/tags", "wall/wall"}; reflect.DeepEqual(expected, actions(events)) == false {
+		t.Errorf("Expected %v, got %v", expected, actions(events))
+	}
+
+	if expected := []string{"@sam", "#stale"}; reflect.DeepEqual(expected, w.tags) == false {
+		t.Errorf("Expected tags %v, got %v", expected, w.tags)
+	}
+
+	if len(w.posts) != 1 || w.posts[0].Content != "@sam ticket 7 needs a reply" || w.posts[0].TicketID != 7 {
+		t.Errorf("Unexpected wall posts %+v", w.posts)
+	}
+
+	// nothing fires twice, even when the customer replies again
+	w.lastReplyAt = start.Add(2 * time.Hour)
+	if events, _ := e.Run(2); len(events) != 0 {
+		t.Errorf("Expected no events running again, got %v", actions(events))
+	}
+
+	now = start.Add(25 * time.Hour)
+	events, _ = e.Run(2)
+	if expected := []string{"manager/notify"}; reflect.DeepEqual(expected, actions(events)) == false {
+		t.Errorf("Expected %v, got %v", expected, actions(events))
+	}
+	if len(n.sent) != 1 || n.sent[0].Body != "Ticket 7 has waited 25h0m0s" || n.sent[0].Subject != "Ticket 7 escalated (manager): Help" || n.sent[0].Ticket.ID != 7 {
+		t.Errorf("Unexpected notifications %+v", n.sent)
+	}
+
+	// a staff reply resets the ticket
+	w.lastReplyBy = "staff"
+	e.Run(2)
+	if len(e.State.Tickets) != 0 {
+		t.Errorf("Expected a staff reply to reset the ticket, got %+v", e.State.Tickets)
+	}
+
+	w.lastReplyBy, w.lastReplyAt = "customer", now
+	now = now.Add(5 * time.Hour)
+	events, _ = e.Run(2)
+	if expected := []string{"stale/tags"}; reflect.DeepEqual(expected, actions(events)) == false {
+		t.Errorf("Expected the tiers to start over, got %v", actions(events))
+	}
+
+	// a staff reply the customer answered before the next run also resets it
+	w.tags = []string{"@sam"}
+	w.staffNoteAt = now.Add(time.Minute)
+	w.lastReplyAt = now.Add(time.Hour)
+	now = now.Add(6 * time.Hour)
+	events, _ = e.Run(2)
+	if expected := []string{"stale/tags"}; reflect.DeepEqual(expected, actions(events)) == false {
+		t.Errorf("Expected the tiers to start over, got %v", actions(events))
+	}
+	if since := e.State.Tickets[7].Since; since != w.lastReplyAt.Unix() {
+		t.Errorf("Expected the wait to start at the customer's reply, got %d", since)
+	}
+}
+
+func TestRunOtherMailboxes(t *testing.T) {
+	setup()
+	defer teardown()
+
+	w := &waiting{lastReplyBy: "customer", lastReplyAt: start}
+	w.handle()
+	mux.HandleFunc("/mailbox/3/tickets", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `[]`)
+	})
+
+	e, _ := New(client, 1, testTiers())
+	e.Now = func() time.Time { return start.Add(5 * time.Hour) }
+
+	e.Run(2)
+	if len(e.State.Tickets) != 1 {
+		t.Fatalf("Expected ticket 7 to be remembered, got %+v", e.State.Tickets)
+	}
+
+	// a run over another mailbox keeps what it knows about mailbox 2
+	e.Run(3)
+	if len(e.State.Tickets) != 1 {
+		t.Errorf("Expected ticket 7 to be kept, got %+v", e.State.Tickets)
+	}
+}
+
+func TestRunRetriesFailures(t *testing.T) {
+	setup()
+	defer teardown()
+
+	w := &waiting{lastReplyBy: "customer", lastReplyAt: start}
+	w.handle()
+
+	e, _ := New(client, 1, testTiers()[:1])
+	n := &notifier{err: errors.New("mail server down")}
+	e.Notifier = n
+	e.Now = func() time.Time { return start.Add(48 * time.Hour) }
+
+	events, err := e.Run(2)
+	if err != nil {
+		t.Fatalf("Expected no error in Run(), got %v", err)
+	}
+	if len(events) != 1 || events[0].Error != "mail server down" {
+		t.Errorf("Expected a failed notification, got %+v", events)
+	}
+
+	n.err = nil
+	events, _ = e.Run(2)
+	if len(events) != 1 || events[0].Error != "" || len(n.sent) != 1 {
+		t.Errorf("Expected the notification to be retried, got %+v", events)
+	}
+}
+
+func TestRunDryRunAndState(t *testing.T) {
+	setup()
+	defer teardown()
+
+	w := &waiting{lastReplyBy: "customer", lastReplyAt: start}
+	w.handle()
+
+	dir, err := ioutil.TempDir("", "escalate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e, _ := New(client, 1, testTiers()[1:])
+	e.StatePath = filepath.Join(dir, "state.json")
+	e.Now = func() time.Time { return start.Add(5 * time.Hour) }
+	e.DryRun = true
+
+	events, _ := e.Run(2)
+	if len(events) != 1 || !events[0].DryRun || len(w.tags) != 0 {
+		t.Errorf("Expected a dry run to only record, got %+v and tags %v", events, w.tags)
+	}
+	if _, err := os.Stat(e.StatePath); !os.IsNotExist(err) {
+		t.Errorf("Expected a dry run not to save state")
+	}
+
+	e.DryRun = false
+	e.Run(2)
+
+	// a new Escalator, as after a restart, knows the tags were added
+	restarted, _ := New(client, 1, testTiers()[1:])
+	restarted.StatePath = e.StatePath
+	restarted.Now = e.Now
+	if events, _ := restarted.Run(2); len(events) != 0 {
+		t.Errorf("Expected nothing to fire after a restart, got %v", actions(events))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := [][]Tier{
+		{{After: time.Hour, Tags: []string{"#a"}}},
+		{{Name: "no threshold", Tags: []string{"#a"}}},
+		{{Name: "nothing", After: time.Hour}},
+		{{Name: "template", After: time.Hour, Wall: "{{.Nope"}},
+		{{Name: "twice", After: time.Hour, Tags: []string{"#a"}}, {Name: "twice", After: 2 * time.Hour, Tags: []string{"#b"}}},
+	}
+
+	for _, tiers := range bad {
+		if _, err := New(client, 1, tiers); err == nil {
+			t.Errorf("Expected an error for %+v", tiers)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	setup()
+	defer teardown()
+
+	w := &waiting{lastReplyBy: "customer", lastReplyAt: start}
+	w.handle()
+
+	e, _ := New(client, 1, testTiers()[1:2])
+	e.Now = func() time.Time { return start.Add(5 * time.Hour) }
+
+	stop := make(chan struct{})
+	runs := 0
+	e.Watch(time.Millisecond, stop, func(events []Event, err error) {
+		runs++
+		if runs == 3 {
+			close(stop)
+		}
+	}, 2)
+
+	if runs != 3 {
+		t.Errorf("Expected 3 runs, got %d", runs)
+	}
+}
+
+func TestRunSavesWhenAMailboxFails(t *testing.T) {
+	setup()
+	defer teardown()
+
+	w := &waiting{lastReplyBy: "customer", lastReplyAt: start}
+	w.handle()
+	mux.HandleFunc("/mailbox/3/tickets", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	})
+
+	dir, err := ioutil.TempDir("", "escalate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e, _ := New(client, 1, testTiers()[1:])
+	e.StatePath = filepath.Join(dir, "state.json")
+	e.Now = func() time.Time { return start.Add(5 * time.Hour) }
+
+	events, err := e.Run(2, 3)
+	if err == nil {
+		t.Fatal("Expected an error from the second mailbox")
+	}
+	if expected := []string{"stale/tags"}; reflect.DeepEqual(expected, actions(events)) == false {
+		t.Errorf("Expected %v, got %v", expected, actions(events))
+	}
+
+	// the next run knows the tags were added
+	restarted, _ := New(client, 1, testTiers()[1:])
+	restarted.StatePath = e.StatePath
+	restarted.Now = e.Now
+	if events, _ := restarted.Run(2); len(events) != 0 {
+		t.Errorf("Expected nothing to fire again, got %v", actions(events))
+	}
+}
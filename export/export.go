@@ -0,0 +1,325 @@
+// Package export writes an account's support history to disk for safe keeping.
+//
+// An export directory looks like:
+//
+//	tickets.jsonl                 one Record (a ticket and its notes) per line
+//	attachments/<ticket>/<id>-<filename>
+//	attachments/manifest.jsonl    one ManifestEntry per downloaded attachment
+//
+// A ticket's line is only written once its notes and attachments are on disk,
+// so tickets.jsonl doubles as the checkpoint: running an export again into the
+// same directory skips every ticket already in it and carries on from there.
+package export
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/derekpitt/snappy"
+)
+
+const (
+	ticketsFile    = "tickets.jsonl"
+	attachmentsDir = "attachments"
+	manifestFile   = "manifest.jsonl"
+)
+
+// Record is one line of tickets.jsonl
+type Record struct {
+	snappy.Ticket
+	Notes []snappy.Note `json:"notes"`
+}
+
+// ManifestEntry describes one downloaded attachment
+type ManifestEntry struct {
+	TicketID     int    `json:"ticket_id"`
+	NoteID       int    `json:"note_id"`
+	AttachmentID int    `json:"attachment_id"`
+	Filename     string `json:"filename"`
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256"`
+
+	// Path is relative to the export directory
+	Path string `json:"path"`
+}
+
+// Stats counts what an export did
+type Stats struct {
+	Tickets     int
+	Skipped     int
+	Attachments int
+}
+
+// Exporter walks an account and writes every ticket it can find to Dir
+type Exporter struct {
+	Client    *snappy.Snappy
+	AccountID int
+	Dir       string
+
+	// Queries are passed to SearchAll on top of walking the mailboxes. The
+	// mailbox listings only hold open tickets, so closed tickets are only
+	// exported when a query finds them
+	Queries []string
+
+	// SkipAttachments leaves attachments out of the export
+	SkipAttachments bool
+
+	// Progress, if set, is called after each ticket is written
+	Progress func(ticketID int)
+}
+
+// New creates an Exporter for an account
+func New(client *snappy.Snappy, accountID int, dir string) *Exporter {
+	return &Exporter{
+		Client:    client,
+		AccountID: accountID,
+		Dir:       dir,
+	}
+}
+
+// Run exports every ticket not already in the export directory
+func (e *Exporter) Run() (stats Stats, err error) {
+	if err = os.MkdirAll(filepath.Join(e.Dir, attachmentsDir), 0755); err != nil {
+		return
+	}
+
+	done, err := e.resume()
+	if err != nil {
+		return
+	}
+
+	manifest, err := e.loadManifest()
+	if err != nil {
+		return
+	}
+
+	tickets, err := e.tickets()
+	if err != nil {
+		return
+	}
+
+	out, err := os.OpenFile(filepath.Join(e.Dir, ticketsFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer out.Close()
+
+	mf, err := os.OpenFile(filepath.Join(e.Dir, attachmentsDir, manifestFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer mf.Close()
+
+	enc := json.NewEncoder(out)
+	manifestEnc := json.NewEncoder(mf)
+
+	for _, ticket := range tickets {
+		if done[ticket.ID] {
+			stats.Skipped++
+			continue
+		}
+
+		record := Record{Ticket: ticket}
+
+		if record.Notes, err = e.Client.TicketNotes(ticket.ID); err != nil {
+			return stats, fmt.Errorf("export: notes for ticket %d: %v", ticket.ID, err)
+		}
+
+		if !e.SkipAttachments {
+			for _, note := range record.Notes {
+				for _, doc := range note.Attachments {
+					if _, ok := manifest[doc.ID]; ok {
+						continue
+					}
+
+					entry, err := e.download(ticket.ID, note.ID, doc)
+					if err != nil {
+						return stats, fmt.Errorf("export: attachment %d of ticket %d: %v", doc.ID, ticket.ID, err)
+					}
+
+					if err := manifestEnc.Encode(entry); err != nil {
+						return stats, err
+					}
+
+					manifest[doc.ID] = entry
+					stats.Attachments++
+				}
+			}
+		}
+
+		if err = enc.Encode(record); err != nil {
+			return
+		}
+
+		done[ticket.ID] = true
+		stats.Tickets++
+
+		if e.Progress != nil {
+			e.Progress(ticket.ID)
+		}
+	}
+
+	return
+}
+
+// tickets lists every ticket in the account's mailboxes and search queries, without duplicates
+func (e *Exporter) tickets() ([]snappy.Ticket, error) {
+	var all []snappy.Ticket
+	seen := map[int]bool{}
+
+	add := func(tickets []snappy.Ticket) {
+		for _, t := range tickets {
+			if !seen[t.ID] {
+				seen[t.ID] = true
+				all = append(all, t)
+			}
+		}
+	}
+
+	mailboxes, err := e.Client.Mailboxes(e.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range mailboxes {
+		tickets, err := e.Client.MailboxTickets(m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("export: mailbox %d: %v", m.ID, err)
+		}
+		add(tickets)
+	}
+
+	for _, q := range e.Queries {
+		tickets, err := e.Client.SearchAll(e.AccountID, q)
+		if err != nil {
+			return nil, fmt.Errorf("export: search %q: %v", q, err)
+		}
+		add(tickets)
+	}
+
+	return all, nil
+}
+
+// resume reads the ids already in tickets.jsonl
+func (e *Exporter) resume() (map[int]bool, error) {
+	done := map[int]bool{}
+
+	err := readJSONL(filepath.Join(e.Dir, ticketsFile), func(line []byte) error {
+		var record struct {
+			ID int `json:"id"`
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+
+		done[record.ID] = true
+		return nil
+	})
+
+	return done, err
+}
+
+// loadManifest reads the attachments already downloaded. Anything after a
+// broken entry is downloaded again
+func (e *Exporter) loadManifest() (map[int]ManifestEntry, error) {
+	manifest := map[int]ManifestEntry{}
+
+	err := readJSONL(filepath.Join(e.Dir, attachmentsDir, manifestFile), func(line []byte) error {
+		var entry ManifestEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+
+		manifest[entry.AttachmentID] = entry
+		return nil
+	})
+
+	return manifest, err
+}
+
+// readJSONL calls each with the lines of the file at path, if it exists. The
+// file is cut off at the first line each fails on, like a partly written
+// last line from an export that was killed mid write, so new lines start on
+// a line of their own
+func readJSONL(path string, each func(line []byte) error) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var good int64
+	r := bufio.NewReader(f)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if each(line) != nil {
+			break
+		}
+		good += int64(len(line))
+	}
+
+	if info, err := f.Stat(); err == nil && info.Size() != good {
+		return os.Truncate(path, good)
+	}
+
+	return nil
+}
+
+func (e *Exporter) download(ticketID, noteID int, doc snappy.Document) (entry ManifestEntry, err error) {
+	rel := filepath.Join(attachmentsDir, strconv.Itoa(ticketID), fmt.Sprintf("%d-%s", doc.ID, filepath.Base(doc.Filename)))
+	path := filepath.Join(e.Dir, rel)
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+
+	rc, err := e.Client.DownloadTicketAttachment(ticketID, doc.ID)
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), rc)
+	if err != nil {
+		f.Close()
+		return
+	}
+
+	if err = f.Close(); err != nil {
+		return
+	}
+
+	return ManifestEntry{
+		TicketID:     ticketID,
+		NoteID:       noteID,
+		AttachmentID: doc.ID,
+		Filename:     doc.Filename,
+		Size:         size,
+		SHA256:       hex.EncodeToString(h.Sum(nil)),
+		Path:         filepath.ToSlash(rel),
+	}, nil
+}
@@ -0,0 +1,194 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/derekpitt/snappy"
+)
+
+var (
+	mux    *http.ServeMux
+	server *httptest.Server
+	client *snappy.Snappy
+)
+
+func setup() {
+	mux = http.NewServeMux()
+	server = httptest.NewServer(mux)
+
+	client = snappy.WithAPIKey("apikey")
+	client.SetEndpointPrefix(server.URL)
+}
+
+func teardown() {
+	server.Close()
+}
+
+func readRecords(t *testing.T, dir string) []Record {
+	f, err := os.Open(filepath.Join(dir, ticketsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []Record
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var r Record
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			t.Fatalf("Expected every line to be a record: %v", err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestExportResumes(t *testing.T) {
+	setup()
+	defer teardown()
+
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mux.HandleFunc("/account/1/mailboxes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":10}]`)
+	})
+	mux.HandleFunc("/mailbox/10/inbox", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":1,"summary":"one"}]`)
+	})
+	mux.HandleFunc("/mailbox/10/tickets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":1,"summary":"one"},{"id":2,"summary":"two"}]`)
+	})
+	mux.HandleFunc("/mailbox/10/yours", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[]`)
+	})
+	mux.HandleFunc("/account/1/search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"meta":{"total":1,"page":"1"},"data":[{"id":3,"summary":"closed"}]}`)
+	})
+
+	notesRequests := map[string]int{}
+	mux.HandleFunc("/ticket/", func(w http.ResponseWriter, r *http.Request) {
+		notesRequests[r.URL.Path]++
+
+		switch r.URL.Path {
+		case "/ticket/1/notes":
+			fmt.Fprintf(w, `[{"id":11,"content":"hi","attachments":[{"id":100,"filename":"a.txt"}]}]`)
+		case "/ticket/1/attachment/100/download":
+			fmt.Fprintf(w, "attachment")
+		case "/ticket/2/notes":
+			// fail the first time around, as if the export was interrupted
+			if notesRequests[r.URL.Path] == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(w, `[{"id":21,"content":"hello"}]`)
+		case "/ticket/3/notes":
+			fmt.Fprintf(w, `[]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	e := New(client, 1, dir)
+	e.Queries = []string{"status:closed"}
+
+	if _, err := e.Run(); err == nil {
+		t.Fatal("expected the first run to fail")
+	}
+
+	if records := readRecords(t, dir); len(records) != 1 || records[0].ID != 1 {
+		t.Fatalf("expected only ticket 1 after the first run, got %v", records)
+	}
+
+	stats, err := e.Run()
+	if err != nil {
+		t.Fatalf("Expected no error in Run(): %v", err)
+	}
+
+	if stats.Tickets != 2 || stats.Skipped != 1 || stats.Attachments != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	records := readRecords(t, dir)
+	if len(records) != 3 || records[1].ID != 2 || records[2].ID != 3 {
+		t.Fatalf("expected tickets 1, 2 and 3, got %v", records)
+	}
+
+	if records[1].Notes[0].Content != "hello" {
+		t.Errorf("expected notes to be embedded, got %v", records[1].Notes)
+	}
+
+	if notesRequests["/ticket/1/notes"] != 1 || notesRequests["/ticket/1/attachment/100/download"] != 1 {
+		t.Errorf("expected ticket 1 to be exported once, got %v", notesRequests)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "attachments", "1", "100-a.txt"))
+	if err != nil || string(b) != "attachment" {
+		t.Errorf("expected the attachment on disk, got %q %v", b, err)
+	}
+
+	manifest, err := e.loadManifest()
+	if err != nil || manifest[100].Path != "attachments/1/100-a.txt" || manifest[100].Size != 10 {
+		t.Errorf("unexpected manifest %v %v", manifest, err)
+	}
+}
+
+func TestResumeTruncatesPartialLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ticketsFile)
+	ioutil.WriteFile(path, []byte("{\"id\":1}\n{\"id\":2,\"sum"), 0644)
+
+	done, err := New(nil, 1, dir).resume()
+	if err != nil {
+		t.Fatalf("Expected no error in resume(): %v", err)
+	}
+
+	if !done[1] || done[2] {
+		t.Errorf("expected only ticket 1 to be done, got %v", done)
+	}
+
+	if b, _ := ioutil.ReadFile(path); string(b) != "{\"id\":1}\n" {
+		t.Errorf("expected the partial line to be cut off, got %q", b)
+	}
+}
+
+func TestLoadManifestTruncatesPartialLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, attachmentsDir), 0755)
+	path := filepath.Join(dir, attachmentsDir, manifestFile)
+	ioutil.WriteFile(path, []byte("{\"attachment_id\":100}\n{\"attachment_id\":101,\"pa"), 0644)
+
+	manifest, err := New(nil, 1, dir).loadManifest()
+	if err != nil {
+		t.Fatalf("Expected no error in loadManifest(): %v", err)
+	}
+
+	if _, ok := manifest[100]; !ok || len(manifest) != 1 {
+		t.Errorf("expected only attachment 100 in the manifest, got %v", manifest)
+	}
+
+	if b, _ := ioutil.ReadFile(path); string(b) != "{\"attachment_id\":100}\n" {
+		t.Errorf("expected the partial line to be cut off, got %q", b)
+	}
+}
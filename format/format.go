@@ -0,0 +1,394 @@
+// Package format renders the snappy resource types (or any slice of structs)
+// as tables, JSON, JSON lines, CSV or Go templates.
+//
+// Columns are named after the json tags of the struct fields, and nested
+// fields can be reached with a dotted path, e.g. "opener.address".
+package format
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"unicode/utf8"
+)
+
+// Formatter writes a value, either a single struct or a slice of them
+type Formatter interface {
+	Format(w io.Writer, v interface{}) error
+}
+
+// Options controls which columns are shown and how wide a table can be
+type Options struct {
+	// Columns to show. When empty every top level field is used
+	Columns []string
+
+	// Width is the terminal width tables are truncated to. 0 means no limit
+	Width int
+}
+
+// New returns a Formatter for spec, which is one of table, json, jsonl, csv
+// or template=<go template>
+func New(spec string, opts Options) (Formatter, error) {
+	if strings.HasPrefix(spec, "template=") {
+		t, err := template.New("output").Parse(strings.TrimPrefix(spec, "template="))
+		if err != nil {
+			return nil, err
+		}
+		return templateFormatter{t}, nil
+	}
+
+	switch spec {
+	case "", "table":
+		return tableFormatter{opts}, nil
+	case "json":
+		return jsonFormatter{opts: opts}, nil
+	case "jsonl":
+		return jsonFormatter{opts: opts, lines: true}, nil
+	case "csv":
+		return csvFormatter{opts}, nil
+	}
+
+	return nil, fmt.Errorf("unknown output format %q", spec)
+}
+
+// rows turns v into a list of values, reporting whether v was a slice
+func rows(v interface{}) ([]reflect.Value, bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []reflect.Value{rv}, false
+	}
+
+	result := make([]reflect.Value, rv.Len())
+	for i := range result {
+		result[i] = rv.Index(i)
+	}
+	return result, true
+}
+
+// fieldName returns the json name of a struct field, or "" if it is skipped
+func fieldName(f reflect.StructField) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+
+	tag := strings.Split(f.Tag.Get("json"), ",")[0]
+	switch tag {
+	case "-":
+		return ""
+	case "":
+		return strings.ToLower(f.Name)
+	}
+	return tag
+}
+
+// defaultColumns lists the top level fields of a struct type
+func defaultColumns(t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return []string{"value"}
+	}
+
+	var columns []string
+	for i := 0; i < t.NumField(); i++ {
+		if name := fieldName(t.Field(i)); name != "" {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+func (o Options) columns(v interface{}) []string {
+	if len(o.Columns) > 0 {
+		return o.Columns
+	}
+	return defaultColumns(reflect.TypeOf(v))
+}
+
+// lookup follows a dotted column path through v
+func lookup(v reflect.Value, path string) (reflect.Value, bool) {
+	for _, part := range strings.Split(path, ".") {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+
+		if v.Kind() != reflect.Struct {
+			if path == "value" {
+				return v, true
+			}
+			return reflect.Value{}, false
+		}
+
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if strings.EqualFold(fieldName(v.Type().Field(i)), part) {
+				v = v.Field(i)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return reflect.Value{}, false
+		}
+	}
+
+	return v, true
+}
+
+// cell renders a single value as text
+func cell(v reflect.Value, ok bool) string {
+	if !ok || !v.IsValid() {
+		return ""
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = cell(v.Index(i), true)
+		}
+		return strings.Join(parts, ",")
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return ""
+		}
+		return cell(v.Elem(), true)
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+func record(v reflect.Value, columns []string) []string {
+	result := make([]string, len(columns))
+	for i, c := range columns {
+		result[i] = cell(lookup(v, c))
+	}
+	return result
+}
+
+type tableFormatter struct {
+	opts Options
+}
+
+func (f tableFormatter) Format(w io.Writer, v interface{}) error {
+	columns := f.opts.columns(v)
+	values, isSlice := rows(v)
+
+	var table [][]string
+	if isSlice {
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = strings.ToUpper(c)
+		}
+		table = append(table, header)
+		for _, row := range values {
+			table = append(table, record(row, columns))
+		}
+	} else {
+		// a single value reads better as a list of name/value pairs
+		for i, c := range record(values[0], columns) {
+			table = append(table, []string{columns[i], c})
+		}
+	}
+
+	for _, row := range table {
+		for i := range row {
+			row[i] = strings.Join(strings.Fields(row[i]), " ")
+		}
+	}
+
+	fit(table, f.opts.Width)
+
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	for _, row := range table {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, line := range strings.SplitAfter(b.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		if _, err := io.WriteString(w, strings.TrimRight(line, " \n")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fit shrinks the widest columns of table until a row fits into width
+func fit(table [][]string, width int) {
+	if width <= 0 || len(table) == 0 {
+		return
+	}
+
+	const padding, minWidth = 2, 6
+
+	widths := make([]int, len(table[0]))
+	for _, row := range table {
+		for i, c := range row {
+			if n := utf8.RuneCountInString(c); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	total := func() int {
+		sum := 0
+		for _, n := range widths {
+			sum += n + padding
+		}
+		return sum - padding
+	}
+
+	for total() > width {
+		widest := 0
+		for i, n := range widths {
+			if n > widths[widest] {
+				widest = i
+			}
+		}
+
+		if widths[widest] <= minWidth {
+			break
+		}
+
+		widths[widest]--
+	}
+
+	for _, row := range table {
+		for i, c := range row {
+			row[i] = truncate(c, widths[i])
+		}
+	}
+}
+
+// truncate shortens s to n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+type jsonFormatter struct {
+	opts  Options
+	lines bool
+}
+
+// selected narrows v down to the chosen columns, if any were chosen
+func (f jsonFormatter) selected(v reflect.Value) interface{} {
+	if len(f.opts.Columns) == 0 {
+		return v.Interface()
+	}
+
+	m := make(map[string]interface{}, len(f.opts.Columns))
+	for _, c := range f.opts.Columns {
+		if fv, ok := lookup(v, c); ok {
+			m[c] = fv.Interface()
+		}
+	}
+	return m
+}
+
+func (f jsonFormatter) Format(w io.Writer, v interface{}) error {
+	values, isSlice := rows(v)
+
+	if f.lines {
+		enc := json.NewEncoder(w)
+		for _, row := range values {
+			if err := enc.Encode(f.selected(row)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var out interface{}
+	if isSlice {
+		list := make([]interface{}, len(values))
+		for i, row := range values {
+			list[i] = f.selected(row)
+		}
+		out = list
+	} else {
+		out = f.selected(values[0])
+	}
+
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+type csvFormatter struct {
+	opts Options
+}
+
+func (f csvFormatter) Format(w io.Writer, v interface{}) error {
+	columns := f.opts.columns(v)
+	values, _ := rows(v)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	for _, row := range values {
+		if err := cw.Write(record(row, columns)); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+type templateFormatter struct {
+	t *template.Template
+}
+
+func (f templateFormatter) Format(w io.Writer, v interface{}) error {
+	values, _ := rows(v)
+
+	for _, row := range values {
+		var b strings.Builder
+		if err := f.t.Execute(&b, row.Interface()); err != nil {
+			return err
+		}
+
+		out := b.String()
+		if !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+
+		if _, err := io.WriteString(w, out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
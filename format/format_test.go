@@ -0,0 +1,125 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/derekpitt/snappy"
+)
+
+var tickets = []snappy.Ticket{
+	snappy.Ticket{
+		ID:      1,
+		Status:  "waiting",
+		Summary: "Printer is on fire",
+		Tags:    []string{"#support", "@test1"},
+		Opener:  snappy.Contact{Address: "test1@test.com"},
+	},
+	snappy.Ticket{
+		ID:      2,
+		Status:  "new",
+		Summary: "Hello, \"world\"",
+	},
+}
+
+func format(t *testing.T, spec string, opts Options, v interface{}) string {
+	f, err := New(spec, opts)
+
+	if err != nil {
+		t.Fatalf("Expected no error in New(%q): %v", spec, err)
+	}
+
+	var b bytes.Buffer
+	if err := f.Format(&b, v); err != nil {
+		t.Fatalf("Expected no error in Format(): %v", err)
+	}
+
+	return b.String()
+}
+
+func TestTable(t *testing.T) {
+	got := format(t, "table", Options{Columns: []string{"id", "tags", "opener.address"}}, tickets)
+
+	expected := "ID  TAGS             OPENER.ADDRESS\n" +
+		"1   #support,@test1  test1@test.com\n" +
+		"2\n"
+
+	if got != expected {
+		t.Errorf("expected\n%q\ngot\n%q", expected, got)
+	}
+}
+
+func TestTableSingleValue(t *testing.T) {
+	got := format(t, "table", Options{Columns: []string{"id", "status"}}, tickets[0])
+
+	expected := "id      1\nstatus  waiting\n"
+
+	if got != expected {
+		t.Errorf("expected\n%q\ngot\n%q", expected, got)
+	}
+}
+
+func TestTableWidth(t *testing.T) {
+	got := format(t, "table", Options{Columns: []string{"id", "summary"}, Width: 14}, tickets)
+
+	for _, line := range strings.Split(strings.TrimSpace(got), "\n") {
+		if n := len([]rune(line)); n > 14 {
+			t.Errorf("expected lines of at most 14 runes, got %d in %q", n, line)
+		}
+	}
+
+	if !strings.Contains(got, "…") {
+		t.Errorf("expected a truncated cell, got %q", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	got := format(t, "json", Options{}, tickets)
+
+	var decoded []snappy.Ticket
+	if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+		t.Fatalf("Expected no error decoding json: %v", err)
+	}
+
+	if len(decoded) != 2 || decoded[0].Summary != "Printer is on fire" {
+		t.Errorf("unexpected tickets %v", decoded)
+	}
+}
+
+func TestJSONLWithColumns(t *testing.T) {
+	got := format(t, "jsonl", Options{Columns: []string{"id", "status"}}, tickets)
+
+	expected := "{\"id\":1,\"status\":\"waiting\"}\n{\"id\":2,\"status\":\"new\"}\n"
+
+	if got != expected {
+		t.Errorf("expected\n%q\ngot\n%q", expected, got)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	got := format(t, "csv", Options{Columns: []string{"id", "summary"}}, tickets)
+
+	expected := "id,summary\n1,Printer is on fire\n2,\"Hello, \"\"world\"\"\"\n"
+
+	if got != expected {
+		t.Errorf("expected\n%q\ngot\n%q", expected, got)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	got := format(t, "template={{.ID}} {{.Summary}}", Options{}, tickets)
+
+	expected := "1 Printer is on fire\n2 Hello, \"world\"\n"
+
+	if got != expected {
+		t.Errorf("expected\n%q\ngot\n%q", expected, got)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := New("yaml", Options{}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
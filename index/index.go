@@ -0,0 +1,499 @@
+// Package index is an offline full text index over tickets and their notes.
+//
+// Queries are made of space separated clauses that must all match:
+//
+//	printer            a word in any field
+//	"on fire"          a phrase
+//	print*             a prefix
+//	printr~            a word spelled roughly like this (one or two edits away)
+//	subject:printer    a word in one field
+//	-tag:#spam         a clause that must not match
+//
+// The fields are subject, summary, tag, contact (names and addresses),
+// note (note content with the HTML stripped) and status. Anything else
+// before a colon is searched for as words, so 10:30 and URLs work.
+package index
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/internal/atomicfile"
+	"github.com/derekpitt/snappy/mirror"
+	"github.com/derekpitt/snappy/render"
+)
+
+// fields and how much a match in each counts towards a result's score
+var fieldWeights = map[string]float64{
+	"subject": 3,
+	"tag":     3,
+	"summary": 2,
+	"contact": 2,
+	"status":  1,
+	"note":    1,
+}
+
+// Result is a ticket that matched a query
+type Result struct {
+	TicketID int
+	Score    float64
+}
+
+// Index maps terms to the tickets they appear in
+type Index struct {
+	// postings is field -> term -> ticket id -> positions
+	postings map[string]map[string]map[int][]int
+
+	// terms remembers the terms of each ticket so it can be removed
+	terms map[int]map[string][]string
+}
+
+// New creates an empty index
+func New() *Index {
+	return &Index{
+		postings: map[string]map[string]map[int][]int{},
+		terms:    map[int]map[string][]string{},
+	}
+}
+
+// Build indexes every ticket of an account in a mirror store
+func Build(store mirror.Store, accountID int) (*Index, error) {
+	tickets, err := store.Tickets(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	ix := New()
+	for _, t := range tickets {
+		notes, err := store.Notes(t.ID)
+		if err != nil {
+			return nil, err
+		}
+		ix.Add(t, notes)
+	}
+
+	return ix, nil
+}
+
+// Len returns the number of tickets in the index
+func (ix *Index) Len() int {
+	return len(ix.terms)
+}
+
+// tokenize lowercases s and splits it into words
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ticketFields returns the terms of each field of a ticket
+func ticketFields(t snappy.Ticket, notes []snappy.Note) map[string][]string {
+	fields := map[string][]string{
+		"subject": tokenize(t.DefaultSubject),
+		"summary": tokenize(t.Summary),
+		"status":  tokenize(t.Status),
+	}
+
+	// tags are indexed whole, so tag:#billing is exact, and as words so a
+	// plain "billing" finds them too
+	for _, tag := range t.Tags {
+		fields["tag"] = append(fields["tag"], strings.ToLower(tag))
+		fields["tag"] = append(fields["tag"], tokenize(tag)...)
+	}
+
+	// each contact and note is followed by a gap, so a phrase can't run
+	// from one into the next
+	contacts := append([]snappy.Contact{t.Opener}, t.Contacts...)
+	for _, c := range contacts {
+		fields["contact"] = append(fields["contact"], tokenize(strings.Join([]string{c.FirstName, c.LastName, c.Address, c.Value}, " "))...)
+		fields["contact"] = append(fields["contact"], gap)
+	}
+
+	for _, n := range notes {
+		fields["note"] = append(fields["note"], tokenize(render.NoteText(n))...)
+		fields["note"] = append(fields["note"], gap)
+		fields["contact"] = append(fields["contact"], tokenize(strings.Join([]string{n.Creator.FirstName, n.Creator.LastName, n.Creator.Address}, " "))...)
+		fields["contact"] = append(fields["contact"], gap)
+	}
+
+	return fields
+}
+
+// gap takes up a position between terms without being indexed
+const gap = ""
+
+// Add indexes a ticket and its notes, replacing anything indexed for it before
+func (ix *Index) Add(t snappy.Ticket, notes []snappy.Note) {
+	ix.Remove(t.ID)
+
+	ix.insert(t.ID, ticketFields(t, notes))
+}
+
+// insert adds the postings for a ticket's terms
+func (ix *Index) insert(id int, fields map[string][]string) {
+	ix.terms[id] = fields
+
+	for field, terms := range fields {
+		if ix.postings[field] == nil {
+			ix.postings[field] = map[string]map[int][]int{}
+		}
+
+		for pos, term := range terms {
+			if term == gap {
+				continue
+			}
+
+			docs := ix.postings[field][term]
+			if docs == nil {
+				docs = map[int][]int{}
+				ix.postings[field][term] = docs
+			}
+			docs[id] = append(docs[id], pos)
+		}
+	}
+}
+
+// Remove drops a ticket from the index
+func (ix *Index) Remove(ticketID int) {
+	for field, terms := range ix.terms[ticketID] {
+		for _, term := range terms {
+			if term == gap {
+				continue
+			}
+
+			docs := ix.postings[field][term]
+			delete(docs, ticketID)
+			if len(docs) == 0 {
+				delete(ix.postings[field], term)
+			}
+		}
+	}
+
+	delete(ix.terms, ticketID)
+}
+
+type clause struct {
+	negate bool
+	field  string
+	terms  []string
+	prefix bool
+	fuzzy  bool
+}
+
+// parse splits a query into clauses
+func parse(query string) ([]clause, error) {
+	var clauses []clause
+	s := strings.TrimSpace(query)
+
+	for s != "" {
+		c := clause{}
+
+		if strings.HasPrefix(s, "-") {
+			c.negate = true
+			s = s[1:]
+		}
+
+		// an unknown field is part of the term, like in a URL or 10:30
+		if i := strings.IndexAny(s, ": \""); i > 0 && s[i] == ':' {
+			field := strings.ToLower(s[:i])
+			if _, ok := fieldWeights[field]; ok {
+				c.field = field
+				s = s[i+1:]
+			}
+		}
+
+		var value string
+		if strings.HasPrefix(s, "\"") {
+			end := strings.Index(s[1:], "\"")
+			if end < 0 {
+				return nil, fmt.Errorf("index: unterminated phrase in %q", query)
+			}
+			value, s = s[1:end+1], s[end+2:]
+		} else {
+			end := strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+
+			switch {
+			case strings.HasSuffix(value, "*"):
+				c.prefix = true
+				value = strings.TrimSuffix(value, "*")
+			case strings.HasSuffix(value, "~"):
+				c.fuzzy = true
+				value = strings.TrimSuffix(value, "~")
+			}
+		}
+
+		if c.field == "tag" {
+			c.terms = []string{strings.ToLower(value)}
+		} else {
+			c.terms = tokenize(value)
+		}
+
+		if len(c.terms) == 0 {
+			return nil, fmt.Errorf("index: empty clause in %q", query)
+		}
+
+		if len(c.terms) > 1 && (c.prefix || c.fuzzy) {
+			return nil, fmt.Errorf("index: %q can't be both a phrase and a prefix or fuzzy match", value)
+		}
+
+		clauses = append(clauses, c)
+		s = strings.TrimSpace(s)
+	}
+
+	return clauses, nil
+}
+
+// matchingTerms lists the terms of a field that a single word clause matches
+func (ix *Index) matchingTerms(field string, c clause) []string {
+	word := c.terms[0]
+
+	if !c.prefix && !c.fuzzy {
+		if _, ok := ix.postings[field][word]; ok {
+			return []string{word}
+		}
+		return nil
+	}
+
+	maxDistance := 1
+	if len([]rune(word)) >= 6 {
+		maxDistance = 2
+	}
+
+	var terms []string
+	for term := range ix.postings[field] {
+		if c.prefix && strings.HasPrefix(term, word) {
+			terms = append(terms, term)
+		}
+		if c.fuzzy && distance(term, word, maxDistance) <= maxDistance {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// match scores every ticket a clause matches
+func (ix *Index) match(c clause) map[int]float64 {
+	scores := map[int]float64{}
+
+	fields := []string{c.field}
+	if c.field == "" {
+		fields = fields[:0]
+		for field := range fieldWeights {
+			fields = append(fields, field)
+		}
+	}
+
+	for _, field := range fields {
+		weight := fieldWeights[field]
+
+		if len(c.terms) == 1 {
+			for _, term := range ix.matchingTerms(field, c) {
+				for id, positions := range ix.postings[field][term] {
+					scores[id] += weight * float64(len(positions))
+				}
+			}
+			continue
+		}
+
+		for id, positions := range ix.postings[field][c.terms[0]] {
+			if n := ix.phraseCount(field, id, positions, c.terms[1:]); n > 0 {
+				scores[id] += weight * float64(n) * float64(len(c.terms))
+			}
+		}
+	}
+
+	return scores
+}
+
+// phraseCount counts how often rest directly follows one of the starting positions
+func (ix *Index) phraseCount(field string, id int, starts []int, rest []string) int {
+	count := 0
+
+	for _, start := range starts {
+		found := true
+		for i, term := range rest {
+			if !contains(ix.postings[field][term][id], start+i+1) {
+				found = false
+				break
+			}
+		}
+		if found {
+			count++
+		}
+	}
+
+	return count
+}
+
+func contains(positions []int, pos int) bool {
+	i := sort.SearchInts(positions, pos)
+	return i < len(positions) && positions[i] == pos
+}
+
+// Search returns the tickets matching query, best matches first
+func (ix *Index) Search(query string) ([]Result, error) {
+	clauses, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var scores map[int]float64
+
+	// positive clauses narrow the results down, starting with everything
+	// when a query only has negative clauses
+	for _, c := range clauses {
+		if c.negate {
+			continue
+		}
+
+		matched := ix.match(c)
+		if scores == nil {
+			scores = matched
+			continue
+		}
+
+		for id := range scores {
+			if s, ok := matched[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	if scores == nil {
+		scores = map[int]float64{}
+		for id := range ix.terms {
+			scores[id] = 0
+		}
+	}
+
+	for _, c := range clauses {
+		if c.negate {
+			for id := range ix.match(c) {
+				delete(scores, id)
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, Result{TicketID: id, Score: score})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].TicketID < results[j].TicketID
+	})
+
+	return results, nil
+}
+
+// distance is the Levenshtein distance between a and b, giving up once it
+// is known to be more than max
+func distance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return max + 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		best := cur[0]
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+			if cur[j] < best {
+				best = cur[j]
+			}
+		}
+
+		if best > max {
+			return max + 1
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// snapshot is the on disk form of an index
+type snapshot struct {
+	Terms map[int]map[string][]string
+}
+
+// Save writes the index to w. Only the terms of each ticket are written, the
+// postings are rebuilt on Load
+func (ix *Index) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(snapshot{Terms: ix.terms})
+}
+
+// Load reads an index written by Save
+func Load(r io.Reader) (*Index, error) {
+	var s snapshot
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+
+	ix := New()
+	for id, fields := range s.Terms {
+		ix.insert(id, fields)
+	}
+
+	return ix, nil
+}
+
+// SaveFile writes the index to a file, replacing it whole so a crash leaves
+// the last index in place
+func (ix *Index) SaveFile(path string) error {
+	var b bytes.Buffer
+	if err := ix.Save(&b); err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(path, b.Bytes(), 0644)
+}
+
+// LoadFile reads an index from a file written by SaveFile
+func LoadFile(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
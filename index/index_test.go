@@ -0,0 +1,187 @@
+package index
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/mirror"
+)
+
+func testIndex() *Index {
+	ix := New()
+
+	ix.Add(snappy.Ticket{
+		ID:             1,
+		Status:         "waiting",
+		DefaultSubject: "Printer on fire",
+		Summary:        "The office printer is on fire again",
+		Tags:           []string{"#support", "@test1"},
+		Opener:         snappy.Contact{FirstName: "Test", LastName: "One", Address: "test1@test.com"},
+	}, []snappy.Note{
+		snappy.Note{Content: "<p>Please send help &amp; water by 10:30, see https://example.com/fire</p><style>p { color: red }</style>"},
+	})
+
+	ix.Add(snappy.Ticket{
+		ID:             2,
+		Status:         "new",
+		DefaultSubject: "Billing question",
+		Summary:        "Why was I charged twice?",
+		Tags:           []string{"#billing"},
+		Opener:         snappy.Contact{FirstName: "Other", Address: "other@example.com"},
+	}, []snappy.Note{
+		snappy.Note{Content: "The printer invoice is wrong"},
+	})
+
+	return ix
+}
+
+func ids(results []Result) []int {
+	got := []int{}
+	for _, r := range results {
+		got = append(got, r.TicketID)
+	}
+	return got
+}
+
+func TestSearch(t *testing.T) {
+	ix := testIndex()
+
+	cases := map[string][]int{
+		"printer":                  {1, 2},
+		"subject:printer":          {1},
+		`"on fire"`:                {1},
+		`"fire on"`:                {},
+		"bill*":                    {2},
+		"printr~":                  {1, 2},
+		"tag:#billing":             {2},
+		"-tag:#billing":            {1},
+		"contact:test1@test.com":   {1},
+		"note:water":               {1},
+		"note:color":               {},
+		"printer -note:invoice":    {1},
+		"status:new":               {2},
+		"help water":               {1},
+		"help billing":             {},
+		"10:30":                    {1},
+		"https://example.com/fire": {1},
+		"nope:field":               {},
+	}
+
+	for query, expected := range cases {
+		results, err := ix.Search(query)
+
+		if err != nil {
+			t.Errorf("%q: Expected no error in Search(): %v", query, err)
+			continue
+		}
+
+		if got := ids(results); reflect.DeepEqual(expected, got) == false {
+			t.Errorf("%q: expected %v, got %v", query, expected, got)
+		}
+	}
+}
+
+func TestSearchRanksSubjectHigher(t *testing.T) {
+	results, _ := testIndex().Search("printer")
+
+	if results[0].TicketID != 1 || results[0].Score <= results[1].Score {
+		t.Errorf("expected the subject match to rank first, got %v", results)
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	ix := testIndex()
+
+	for query, expected := range map[string]string{
+		`"unterminated`: "unterminated phrase",
+		`two-words*`:    "can't be both a phrase and a prefix",
+		`two.words~`:    "can't be both a phrase and a prefix or fuzzy",
+		`"two words" *`: "empty clause",
+	} {
+		if _, err := ix.Search(query); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected an error with %q, got %v", query, expected, err)
+		}
+	}
+}
+
+func TestSearchPhraseInOneNote(t *testing.T) {
+	ix := New()
+	ix.Add(snappy.Ticket{
+		ID:       1,
+		Opener:   snappy.Contact{FirstName: "Sam", LastName: "Lee"},
+		Contacts: []snappy.Contact{{FirstName: "Jordan", LastName: "Park"}},
+	}, []snappy.Note{
+		{Content: "the printer is on"},
+		{Content: "fire alarm"},
+	})
+
+	for query, expected := range map[string][]int{
+		`"on fire"`:             {},
+		`"printer is on"`:       {1},
+		`"lee jordan"`:          {},
+		`contact:"sam lee"`:     {1},
+		`contact:"jordan park"`: {1},
+	} {
+		if results, _ := ix.Search(query); reflect.DeepEqual(expected, ids(results)) == false {
+			t.Errorf("%q: expected %v, got %v", query, expected, ids(results))
+		}
+	}
+}
+
+func TestAddReplacesAndRemove(t *testing.T) {
+	ix := testIndex()
+
+	ix.Add(snappy.Ticket{ID: 1, DefaultSubject: "Scanner jammed"}, nil)
+
+	if results, _ := ix.Search("subject:printer"); len(results) != 0 {
+		t.Errorf("expected the old subject to be gone, got %v", results)
+	}
+
+	ix.Remove(2)
+
+	if results, _ := ix.Search("printer"); len(results) != 0 {
+		t.Errorf("expected no printers left, got %v", results)
+	}
+
+	if ix.Len() != 1 {
+		t.Errorf("expected 1 ticket, got %d", ix.Len())
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	var b bytes.Buffer
+
+	if err := testIndex().Save(&b); err != nil {
+		t.Fatalf("Expected no error in Save(): %v", err)
+	}
+
+	ix, err := Load(&b)
+	if err != nil {
+		t.Fatalf("Expected no error in Load(): %v", err)
+	}
+
+	results, _ := ix.Search(`"on fire" tag:@test1`)
+	if reflect.DeepEqual([]int{1}, ids(results)) == false {
+		t.Errorf("expected the loaded index to search the same, got %v", results)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	store := mirror.NewMemoryStore()
+	store.PutTicket(snappy.Ticket{ID: 1, AccountID: 1, Summary: "from the mirror"})
+	store.PutNotes(1, []snappy.Note{snappy.Note{Content: "synced note"}})
+	store.PutTicket(snappy.Ticket{ID: 2, AccountID: 2, Summary: "another account"})
+
+	ix, err := Build(store, 1)
+	if err != nil {
+		t.Fatalf("Expected no error in Build(): %v", err)
+	}
+
+	results, _ := ix.Search("synced mirror")
+	if reflect.DeepEqual([]int{1}, ids(results)) == false || ix.Len() != 1 {
+		t.Errorf("expected only the account's ticket, got %v", results)
+	}
+}
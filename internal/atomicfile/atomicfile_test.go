@@ -0,0 +1,48 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFile(path, []byte(content), 0640); err != nil {
+			t.Fatalf("Expected no error in WriteFile(), got %v", err)
+		}
+
+		if b, _ := ioutil.ReadFile(path); string(b) != content {
+			t.Errorf("Expected %q, got %q", content, b)
+		}
+	}
+
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0640 {
+		t.Errorf("Expected a new file to get 0640, got %v", info.Mode())
+	}
+
+	// the file it replaces keeps its permissions
+	os.Chmod(path, 0600)
+	if err := WriteFile(path, []byte("third"), 0644); err != nil {
+		t.Fatalf("Expected no error in WriteFile(), got %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the permissions to be kept, got %v", info.Mode())
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected no temporary files left behind, got %d files", len(files))
+	}
+
+	if err := WriteFile(filepath.Join(dir, "missing", "state.json"), nil, 0644); err == nil {
+		t.Error("Expected an error writing into a missing directory")
+	}
+}
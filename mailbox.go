@@ -6,7 +6,7 @@ import (
 
 // Mailbox holds information about a mailbox attached to an account
 type Mailbox struct {
-	ID             int    `json"id"`
+	ID             int    `json:"id"`
 	AccountID      int    `json:"account_id"`
 	Type           string `json:"type"`
 	Address        string `json:"address"`
@@ -44,3 +44,29 @@ func (s *Snappy) InboxAtMailbox(mailboxID int) (tickets []Ticket, err error) {
 func (s *Snappy) YoursAtMailbox(mailboxID int) (tickets []Ticket, err error) {
 	return s.ticketsAtMailboxEndpoint(mailboxID, "yours")
 }
+
+// MailboxTickets gets the tickets in a mailbox's inbox, waiting and yours
+// lists, in that order, with each ticket only once
+func (s *Snappy) MailboxTickets(mailboxID int) (tickets []Ticket, err error) {
+	seen := map[int]bool{}
+
+	for _, list := range []func(int) ([]Ticket, error){
+		s.InboxAtMailbox,
+		s.WaitingAtMailbox,
+		s.YoursAtMailbox,
+	} {
+		listed, err := list(mailboxID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range listed {
+			if !seen[t.ID] {
+				seen[t.ID] = true
+				tickets = append(tickets, t)
+			}
+		}
+	}
+
+	return
+}
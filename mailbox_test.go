@@ -3,6 +3,7 @@ package snappy
 import (
 	"fmt"
 	"net/http"
+	"reflect"
 	"testing"
 )
 
@@ -306,3 +307,32 @@ func TestYoursAtMailbox(t *testing.T) {
 	}
 
 }
+
+func TestMailboxTickets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/mailbox/1/inbox", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":1},{"id":2}]`)
+	})
+	mux.HandleFunc("/mailbox/1/tickets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":3},{"id":2}]`)
+	})
+	mux.HandleFunc("/mailbox/1/yours", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":3},{"id":4}]`)
+	})
+
+	got, err := client.MailboxTickets(1)
+	if err != nil {
+		t.Fatalf("Expected no error in MailboxTickets(), got %v", err)
+	}
+
+	var ids []int
+	for _, ticket := range got {
+		ids = append(ids, ticket.ID)
+	}
+
+	if expected := []int{1, 2, 3, 4}; reflect.DeepEqual(expected, ids) == false {
+		t.Errorf("Expected %v, got %v", expected, ids)
+	}
+}
@@ -0,0 +1,294 @@
+// Package mirror keeps a local copy of Snappy data so tools can query it
+// without hitting the API on every refresh.
+package mirror
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/internal/atomicfile"
+)
+
+// SyncState is what a Syncer remembers about an account between runs
+type SyncState struct {
+	LastSync time.Time `json:"last_sync"`
+
+	// Listed holds the ids of the tickets that were in a mailbox listing
+	// last time, so tickets that drop out of them can be refreshed
+	Listed []int `json:"listed"`
+}
+
+// Store is where synced data is written to and read back from
+type Store interface {
+	PutAccount(a snappy.Account) error
+	PutStaff(accountID int, e snappy.Employee) error
+	PutMailbox(m snappy.Mailbox) error
+	PutContact(c snappy.Contact) error
+	PutTicket(t snappy.Ticket) error
+	PutNotes(ticketID int, notes []snappy.Note) error
+	PutState(accountID int, s SyncState) error
+
+	Accounts() ([]snappy.Account, error)
+	Staff(accountID int) ([]snappy.Employee, error)
+	Mailboxes(accountID int) ([]snappy.Mailbox, error)
+	Contacts(accountID int) ([]snappy.Contact, error)
+	Tickets(accountID int) ([]snappy.Ticket, error)
+	Ticket(ticketID int) (t snappy.Ticket, ok bool, err error)
+	Notes(ticketID int) ([]snappy.Note, error)
+	State(accountID int) (SyncState, error)
+
+	// Flush makes sure everything written so far is persisted
+	Flush() error
+}
+
+type data struct {
+	Accounts  map[int]snappy.Account          `json:"accounts"`
+	Staff     map[int]map[int]snappy.Employee `json:"staff"`
+	Mailboxes map[int]snappy.Mailbox          `json:"mailboxes"`
+	Contacts  map[int]snappy.Contact          `json:"contacts"`
+	Tickets   map[int]snappy.Ticket           `json:"tickets"`
+	Notes     map[int][]snappy.Note           `json:"notes"`
+	States    map[int]SyncState               `json:"states"`
+}
+
+func (d *data) init() {
+	if d.Accounts == nil {
+		d.Accounts = map[int]snappy.Account{}
+	}
+	if d.Staff == nil {
+		d.Staff = map[int]map[int]snappy.Employee{}
+	}
+	if d.Mailboxes == nil {
+		d.Mailboxes = map[int]snappy.Mailbox{}
+	}
+	if d.Contacts == nil {
+		d.Contacts = map[int]snappy.Contact{}
+	}
+	if d.Tickets == nil {
+		d.Tickets = map[int]snappy.Ticket{}
+	}
+	if d.Notes == nil {
+		d.Notes = map[int][]snappy.Note{}
+	}
+	if d.States == nil {
+		d.States = map[int]SyncState{}
+	}
+}
+
+// MemoryStore keeps everything in memory. It is safe for concurrent use
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data data
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{}
+	s.data.init()
+	return s
+}
+
+// PutAccount stores an account
+func (s *MemoryStore) PutAccount(a snappy.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Accounts[a.ID] = a
+	return nil
+}
+
+// PutStaff stores an employee of an account
+func (s *MemoryStore) PutStaff(accountID int, e snappy.Employee) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Staff[accountID] == nil {
+		s.data.Staff[accountID] = map[int]snappy.Employee{}
+	}
+	s.data.Staff[accountID][e.ID] = e
+	return nil
+}
+
+// PutMailbox stores a mailbox
+func (s *MemoryStore) PutMailbox(m snappy.Mailbox) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Mailboxes[m.ID] = m
+	return nil
+}
+
+// PutContact stores a contact
+func (s *MemoryStore) PutContact(c snappy.Contact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Contacts[c.ID] = c
+	return nil
+}
+
+// PutTicket stores a ticket
+func (s *MemoryStore) PutTicket(t snappy.Ticket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Tickets[t.ID] = t
+	return nil
+}
+
+// PutNotes replaces the notes of a ticket
+func (s *MemoryStore) PutNotes(ticketID int, notes []snappy.Note) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Notes[ticketID] = notes
+	return nil
+}
+
+// PutState stores the sync state of an account
+func (s *MemoryStore) PutState(accountID int, state SyncState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.States[accountID] = state
+	return nil
+}
+
+// Accounts returns every stored account, ordered by id
+func (s *MemoryStore) Accounts() ([]snappy.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	accounts := make([]snappy.Account, 0, len(s.data.Accounts))
+	for _, a := range s.data.Accounts {
+		accounts = append(accounts, a)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return accounts, nil
+}
+
+// Staff returns the stored staff of an account, ordered by id
+func (s *MemoryStore) Staff(accountID int) ([]snappy.Employee, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	staff := make([]snappy.Employee, 0, len(s.data.Staff[accountID]))
+	for _, e := range s.data.Staff[accountID] {
+		staff = append(staff, e)
+	}
+	sort.Slice(staff, func(i, j int) bool { return staff[i].ID < staff[j].ID })
+	return staff, nil
+}
+
+// Mailboxes returns the stored mailboxes of an account, ordered by id
+func (s *MemoryStore) Mailboxes(accountID int) ([]snappy.Mailbox, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var mailboxes []snappy.Mailbox
+	for _, m := range s.data.Mailboxes {
+		if m.AccountID == accountID {
+			mailboxes = append(mailboxes, m)
+		}
+	}
+	sort.Slice(mailboxes, func(i, j int) bool { return mailboxes[i].ID < mailboxes[j].ID })
+	return mailboxes, nil
+}
+
+// Contacts returns the stored contacts of an account, ordered by id
+func (s *MemoryStore) Contacts(accountID int) ([]snappy.Contact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var contacts []snappy.Contact
+	for _, c := range s.data.Contacts {
+		if c.AccountID == accountID {
+			contacts = append(contacts, c)
+		}
+	}
+	sort.Slice(contacts, func(i, j int) bool { return contacts[i].ID < contacts[j].ID })
+	return contacts, nil
+}
+
+// Tickets returns the stored tickets of an account, ordered by id
+func (s *MemoryStore) Tickets(accountID int) ([]snappy.Ticket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tickets []snappy.Ticket
+	for _, t := range s.data.Tickets {
+		if t.AccountID == accountID {
+			tickets = append(tickets, t)
+		}
+	}
+	sort.Slice(tickets, func(i, j int) bool { return tickets[i].ID < tickets[j].ID })
+	return tickets, nil
+}
+
+// Ticket returns a stored ticket
+func (s *MemoryStore) Ticket(ticketID int) (snappy.Ticket, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.data.Tickets[ticketID]
+	return t, ok, nil
+}
+
+// Notes returns the stored notes of a ticket
+func (s *MemoryStore) Notes(ticketID int) ([]snappy.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Notes[ticketID], nil
+}
+
+// State returns the sync state of an account
+func (s *MemoryStore) State(accountID int) (SyncState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.States[accountID], nil
+}
+
+// Flush does nothing, there is nowhere to persist to
+func (s *MemoryStore) Flush() error {
+	return nil
+}
+
+// FileStore is a MemoryStore that is loaded from and flushed to a JSON file
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// OpenFileStore loads a FileStore from path. A missing file gives an empty store
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		MemoryStore: &MemoryStore{},
+		path:        path,
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(b, &s.data); err != nil {
+			return nil, err
+		}
+	}
+
+	s.data.init()
+	return s, nil
+}
+
+// Flush writes the store to its file. It writes a temporary file first and
+// renames it into place so a crash never leaves a half written store behind
+func (s *FileStore) Flush() error {
+	s.mu.RLock()
+	b, err := json.Marshal(&s.data)
+	s.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(s.path, b, 0644)
+}
@@ -0,0 +1,83 @@
+package mirror
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "mirror.json")
+
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error in OpenFileStore(): %v", err)
+	}
+
+	state := SyncState{LastSync: time.Date(2013, 12, 23, 20, 37, 33, 0, time.UTC), Listed: []int{2}}
+
+	store.PutAccount(snappy.Account{ID: 1, Organization: "Snappy Help"})
+	store.PutStaff(1, snappy.Employee{ID: 5, UserName: "test1"})
+	store.PutMailbox(snappy.Mailbox{ID: 3, AccountID: 1})
+	store.PutContact(snappy.Contact{ID: 4, AccountID: 1, Address: "test@test.com"})
+	store.PutTicket(snappy.Ticket{ID: 2, AccountID: 1, Summary: "Summary"})
+	store.PutTicket(snappy.Ticket{ID: 9, AccountID: 8})
+	store.PutNotes(2, []snappy.Note{snappy.Note{ID: 6, Content: "hi"}})
+	store.PutState(1, state)
+
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Expected no error in Flush(): %v", err)
+	}
+
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error reopening the store: %v", err)
+	}
+
+	accounts, _ := reopened.Accounts()
+	staff, _ := reopened.Staff(1)
+	mailboxes, _ := reopened.Mailboxes(1)
+	contacts, _ := reopened.Contacts(1)
+	tickets, _ := reopened.Tickets(1)
+	notes, _ := reopened.Notes(2)
+	gotState, _ := reopened.State(1)
+
+	if len(accounts) != 1 || accounts[0].Organization != "Snappy Help" {
+		t.Errorf("unexpected accounts %v", accounts)
+	}
+
+	if len(staff) != 1 || staff[0].UserName != "test1" {
+		t.Errorf("unexpected staff %v", staff)
+	}
+
+	if len(mailboxes) != 1 || len(contacts) != 1 {
+		t.Errorf("unexpected mailboxes %v or contacts %v", mailboxes, contacts)
+	}
+
+	if len(tickets) != 1 || tickets[0].Summary != "Summary" {
+		t.Errorf("expected only the account's ticket, got %v", tickets)
+	}
+
+	if len(notes) != 1 || notes[0].Content != "hi" {
+		t.Errorf("unexpected notes %v", notes)
+	}
+
+	if reflect.DeepEqual(state, gotState) == false {
+		t.Errorf("expected state %v, got %v", state, gotState)
+	}
+
+	if _, ok, _ := reopened.Ticket(42); ok {
+		t.Error("expected a missing ticket to not be found")
+	}
+}
@@ -0,0 +1,200 @@
+package mirror
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+// Stats counts what a sync did
+type Stats struct {
+	Tickets   int
+	Unchanged int
+	Refreshed int
+	Contacts  int
+}
+
+// Syncer copies an account into a Store. Tickets are found through the
+// mailbox listings (and optionally searches); a ticket's notes are only
+// fetched again when its UpdatedAt has changed since the last sync.
+type Syncer struct {
+	Client *snappy.Snappy
+	Store  Store
+
+	// Queries are passed to SearchAll on top of the mailbox listings, to pick
+	// up tickets that are no longer open
+	Queries []string
+
+	// Now is used to stamp SyncState.LastSync, time.Now unless set
+	Now func() time.Time
+}
+
+// NewSyncer creates a Syncer
+func NewSyncer(client *snappy.Snappy, store Store) *Syncer {
+	return &Syncer{
+		Client: client,
+		Store:  store,
+	}
+}
+
+// SyncAccounts stores every account the client can see
+func (s *Syncer) SyncAccounts() ([]snappy.Account, error) {
+	accounts, err := s.Client.Accounts()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range accounts {
+		if err := s.Store.PutAccount(a); err != nil {
+			return nil, err
+		}
+	}
+
+	return accounts, s.Store.Flush()
+}
+
+// Sync brings the store up to date with an account
+func (s *Syncer) Sync(accountID int) (stats Stats, err error) {
+	staff, err := s.Client.Staff(accountID)
+	if err != nil {
+		return stats, fmt.Errorf("mirror: staff: %v", err)
+	}
+
+	for _, e := range staff {
+		if err = s.Store.PutStaff(accountID, e); err != nil {
+			return
+		}
+	}
+
+	mailboxes, err := s.Client.Mailboxes(accountID)
+	if err != nil {
+		return stats, fmt.Errorf("mirror: mailboxes: %v", err)
+	}
+
+	var listed []int
+	seen := map[int]bool{}
+
+	for _, m := range mailboxes {
+		if err = s.Store.PutMailbox(m); err != nil {
+			return
+		}
+
+		tickets, err := s.Client.MailboxTickets(m.ID)
+		if err != nil {
+			return stats, fmt.Errorf("mirror: mailbox %d: %v", m.ID, err)
+		}
+
+		for _, t := range tickets {
+			if seen[t.ID] {
+				continue
+			}
+			seen[t.ID] = true
+			listed = append(listed, t.ID)
+
+			if err := s.syncTicket(t, &stats); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	for _, q := range s.Queries {
+		tickets, err := s.Client.SearchAll(accountID, q)
+		if err != nil {
+			return stats, fmt.Errorf("mirror: search %q: %v", q, err)
+		}
+
+		for _, t := range tickets {
+			if seen[t.ID] {
+				continue
+			}
+			seen[t.ID] = true
+
+			if err := s.syncTicket(t, &stats); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	state, err := s.Store.State(accountID)
+	if err != nil {
+		return
+	}
+
+	// tickets that dropped out of the listings have changed status, so they
+	// are fetched on their own to pick that up
+	for _, id := range state.Listed {
+		if seen[id] {
+			continue
+		}
+
+		t, err := s.Client.Ticket(id)
+		if snappy.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return stats, fmt.Errorf("mirror: ticket %d: %v", id, err)
+		}
+
+		if err := s.syncTicket(t, &stats); err != nil {
+			return stats, err
+		}
+		stats.Refreshed++
+	}
+
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+
+	if err = s.Store.PutState(accountID, SyncState{LastSync: now(), Listed: listed}); err != nil {
+		return
+	}
+
+	return stats, s.Store.Flush()
+}
+
+func (s *Syncer) syncTicket(t snappy.Ticket, stats *Stats) error {
+	stored, ok, err := s.Store.Ticket(t.ID)
+	if err != nil {
+		return err
+	}
+
+	if ok && stored.UpdatedAt == t.UpdatedAt {
+		stats.Unchanged++
+		return nil
+	}
+
+	notes, err := s.Client.TicketNotes(t.ID)
+	if err != nil {
+		return fmt.Errorf("mirror: notes for ticket %d: %v", t.ID, err)
+	}
+
+	contacts := append([]snappy.Contact{t.Opener}, t.Contacts...)
+	for _, n := range notes {
+		contacts = append(contacts, n.Creator)
+		contacts = append(contacts, n.Contacts...)
+	}
+
+	for _, c := range contacts {
+		if c.ID == 0 {
+			continue
+		}
+		if err := s.Store.PutContact(c); err != nil {
+			return err
+		}
+		stats.Contacts++
+	}
+
+	if err := s.Store.PutNotes(t.ID, notes); err != nil {
+		return err
+	}
+
+	// the ticket goes last so an interrupted sync fetches the notes again
+	if err := s.Store.PutTicket(t); err != nil {
+		return err
+	}
+
+	stats.Tickets++
+	return nil
+}
@@ -0,0 +1,116 @@
+package mirror
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+var (
+	mux    *http.ServeMux
+	server *httptest.Server
+	client *snappy.Snappy
+)
+
+func setup() {
+	mux = http.NewServeMux()
+	server = httptest.NewServer(mux)
+
+	client = snappy.WithAPIKey("apikey")
+	client.SetEndpointPrefix(server.URL)
+}
+
+func teardown() {
+	server.Close()
+}
+
+func TestIncrementalSync(t *testing.T) {
+	setup()
+	defer teardown()
+
+	inbox := `[
+		{"id":1,"account_id":1,"status":"new","updated_at":"2013-12-23 20:37:33","opener":{"id":4,"account_id":1}},
+		{"id":2,"account_id":1,"status":"new","updated_at":"2013-12-23 20:37:33"}
+	]`
+	notesFetched := map[string]int{}
+
+	mux.HandleFunc("/account/1/staff", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":5,"username":"test1"}]`)
+	})
+	mux.HandleFunc("/account/1/mailboxes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":3,"account_id":1}]`)
+	})
+	mux.HandleFunc("/mailbox/3/inbox", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, inbox)
+	})
+	mux.HandleFunc("/mailbox/3/tickets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[]`)
+	})
+	mux.HandleFunc("/mailbox/3/yours", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[]`)
+	})
+	mux.HandleFunc("/ticket/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":2,"account_id":1,"status":"closed","updated_at":"2013-12-24 10:00:00"}`)
+	})
+	mux.HandleFunc("/ticket/", func(w http.ResponseWriter, r *http.Request) {
+		notesFetched[r.URL.Path]++
+		fmt.Fprintf(w, `[{"id":10,"content":"hi","creator":{"id":7,"account_id":1}}]`)
+	})
+
+	store := NewMemoryStore()
+	syncer := NewSyncer(client, store)
+	syncer.Now = func() time.Time { return time.Date(2013, 12, 24, 0, 0, 0, 0, time.UTC) }
+
+	stats, err := syncer.Sync(1)
+	if err != nil {
+		t.Fatalf("Expected no error in Sync(): %v", err)
+	}
+
+	if stats.Tickets != 2 || stats.Unchanged != 0 {
+		t.Errorf("unexpected first sync stats %+v", stats)
+	}
+
+	contacts, _ := store.Contacts(1)
+	if len(contacts) != 2 {
+		t.Errorf("expected the opener and note creator to be stored, got %v", contacts)
+	}
+
+	// ticket 1 is updated and ticket 2 is closed, so it leaves the inbox
+	inbox = `[{"id":1,"account_id":1,"status":"waiting","updated_at":"2013-12-24 09:00:00"}]`
+
+	stats, err = syncer.Sync(1)
+	if err != nil {
+		t.Fatalf("Expected no error in Sync(): %v", err)
+	}
+
+	if stats.Tickets != 2 || stats.Refreshed != 1 {
+		t.Errorf("unexpected second sync stats %+v", stats)
+	}
+
+	closed, _, _ := store.Ticket(2)
+	if closed.Status != "closed" {
+		t.Errorf("expected ticket 2 to be refreshed, got %+v", closed)
+	}
+
+	stats, err = syncer.Sync(1)
+	if err != nil {
+		t.Fatalf("Expected no error in Sync(): %v", err)
+	}
+
+	if stats.Tickets != 0 || stats.Unchanged != 1 {
+		t.Errorf("expected nothing to change on the third sync, got %+v", stats)
+	}
+
+	if notesFetched["/ticket/1/notes"] != 2 {
+		t.Errorf("expected notes for ticket 1 to be fetched twice, got %d", notesFetched["/ticket/1/notes"])
+	}
+
+	state, _ := store.State(1)
+	if !state.LastSync.Equal(syncer.Now()) || len(state.Listed) != 1 {
+		t.Errorf("unexpected sync state %+v", state)
+	}
+}
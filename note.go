@@ -1,5 +1,11 @@
 package snappy
 
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+)
+
 // NoteAddress holds information about a Name and an Email address
 type NoteAddress struct {
 	Name    string `json:"name"`
@@ -18,12 +24,48 @@ type NewNote struct {
 	TicketNonce string        `json:"id,omitempty"`
 }
 
-// CreateNote will create a note using NewNote
+// CreateNote will create a note using NewNote, after checking it with Validate
 func (s *Snappy) CreateNote(newNote NewNote) (err error) {
+	_, err = s.CreateNoteNonce(newNote)
+	return
+}
+
+// CreateNoteNonce creates a note like CreateNote and returns the nonce of the
+// ticket it was added to. A NewNote without a TicketNonce starts a new
+// ticket, and the nonce is how later notes are added to it
+func (s *Snappy) CreateNoteNonce(newNote NewNote) (nonce string, err error) {
+	if err = newNote.Validate(); err != nil {
+		return
+	}
+
 	up := urlAndParams{
 		url: "/note",
 	}
 
-	_, err = s.postAsJSON(up, newNote)
+	rc, err := s.postAsJSON(up, newNote)
+
+	if err != nil {
+		return
+	}
+
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return
+	}
+
+	// the nonce comes back as a JSON string or as plain text
+	nonce = strings.TrimSpace(string(b))
+	if strings.HasPrefix(nonce, `"`) {
+		if err = json.Unmarshal([]byte(nonce), &nonce); err != nil {
+			return "", err
+		}
+	}
+
+	if nonce == "" {
+		nonce = newNote.TicketNonce
+	}
+
 	return
 }
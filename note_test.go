@@ -57,3 +57,27 @@ func TestCreateNote(t *testing.T) {
 	}
 
 }
+
+func TestCreateNoteNonce(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		var n NewNote
+		json.NewDecoder(r.Body).Decode(&n)
+
+		if n.TicketNonce == "" {
+			w.Write([]byte(`"abc123"` + "\n"))
+		}
+	})
+
+	nonce, err := client.CreateNoteNonce(NewNote{Subject: "help", Message: "hi", MailboxID: 1, To: []NoteAddress{{Address: "test@test.com"}}})
+	if err != nil || nonce != "abc123" {
+		t.Errorf("Expected the new ticket's nonce, got %q, %v", nonce, err)
+	}
+
+	nonce, err = client.CreateNoteNonce(NewNote{Subject: "help", Message: "hi", MailboxID: 1, TicketNonce: "def456"})
+	if err != nil || nonce != "def456" {
+		t.Errorf("Expected the ticket's own nonce, got %q, %v", nonce, err)
+	}
+}
@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// File appends messages to a file as JSON lines. It is safe for
+// concurrent use
+type File struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewFile creates a File appending to path
+func NewFile(path string) *File {
+	return &File{Path: path}
+}
+
+// Notify appends m to the file, creating it if needed
+func (f *File) Notify(m Message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(b, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
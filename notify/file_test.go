@@ -0,0 +1,31 @@
+package notify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := NewFile(filepath.Join(dir, "notifications.jsonl"))
+
+	for _, subject := range []string{"one", "two"} {
+		if err := f.Notify(Message{Subject: subject}); err != nil {
+			t.Fatalf("Expected no error in Notify(), got %v", err)
+		}
+	}
+
+	b, _ := ioutil.ReadFile(f.Path)
+	expected := `{"subject":"one","body":"","time":"0001-01-01T00:00:00Z"}` + "\n" +
+		`{"subject":"two","body":"","time":"0001-01-01T00:00:00Z"}` + "\n"
+	if string(b) != expected {
+		t.Errorf("Expected %q, got %q", expected, b)
+	}
+}
@@ -0,0 +1,246 @@
+// Package notify tells people about things that happen to tickets. A
+// Notifier delivers a Message; there are Notifiers for email over SMTP,
+// JSON webhooks and append-only files, and wrappers to send to several at
+// once (Multi) and to retry with backoff (Retry). Messages can be rendered
+// from ticket, note and wall post data with a Template.
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/render"
+)
+
+// Message is a notification
+type Message struct {
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	Time    time.Time `json:"time"`
+
+	// Event says what happened, e.g. "escalation"
+	Event string `json:"event,omitempty"`
+
+	// What the message is about, when it is about something
+	Ticket   *snappy.Ticket   `json:"ticket,omitempty"`
+	Note     *snappy.Note     `json:"note,omitempty"`
+	WallPost *snappy.WallPost `json:"wall_post,omitempty"`
+}
+
+// Notifier delivers messages
+type Notifier interface {
+	Notify(m Message) error
+}
+
+// NotifierFunc turns a function into a Notifier
+type NotifierFunc func(m Message) error
+
+// Notify calls f
+func (f NotifierFunc) Notify(m Message) error {
+	return f(m)
+}
+
+// Data is what templates are executed with
+type Data struct {
+	Event    string
+	Ticket   snappy.Ticket
+	Note     snappy.Note
+	WallPost snappy.WallPost
+
+	// Fields are anything else the sender wants to pass along
+	Fields map[string]interface{}
+}
+
+// Template renders messages. Subject and body are text/templates executed
+// with Data, which can use the function text to turn HTML, like note
+// content, into plain text:
+//
+//	{{.Ticket.DefaultSubject}} got a reply: {{text .Note.Content}}
+type Template struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+var funcs = template.FuncMap{
+	"text": render.Text,
+}
+
+// NewTemplate parses the subject and body of a template
+func NewTemplate(subject, body string) (*Template, error) {
+	s, err := template.New("subject").Funcs(funcs).Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("notify: subject: %v", err)
+	}
+
+	b, err := template.New("body").Funcs(funcs).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("notify: body: %v", err)
+	}
+
+	return &Template{subject: s, body: b}, nil
+}
+
+// Render executes the template with d. The message is about whichever of
+// the ticket, note and wall post of d are set
+func (t *Template) Render(d Data) (m Message, err error) {
+	var b bytes.Buffer
+
+	if err = t.subject.Execute(&b, d); err != nil {
+		return
+	}
+	// a subject is a single line
+	m.Subject = strings.Join(strings.Fields(b.String()), " ")
+
+	b.Reset()
+	if err = t.body.Execute(&b, d); err != nil {
+		return
+	}
+	m.Body = b.String()
+
+	m.Event = d.Event
+	if d.Ticket.ID != 0 {
+		m.Ticket = &d.Ticket
+	}
+	if d.Note.ID != 0 {
+		m.Note = &d.Note
+	}
+	if d.WallPost.ID != 0 {
+		m.WallPost = &d.WallPost
+	}
+
+	return
+}
+
+// Multi sends every message to each of its Notifiers, even when some fail
+type Multi []Notifier
+
+// Notify sends m to each Notifier, returning a *MultiError with those that
+// failed
+func (ms Multi) Notify(m Message) error {
+	var failed MultiError
+	for _, n := range ms {
+		if err := n.Notify(m); err != nil {
+			failed.Failed = append(failed.Failed, n)
+			failed.Errors = append(failed.Errors, err)
+		}
+	}
+
+	if len(failed.Errors) > 0 {
+		return &failed
+	}
+	return nil
+}
+
+// MultiError is the Notifiers in a Multi that failed, and their errors. It
+// is permanent when all of its errors are, and Retry only tries Failed again
+type MultiError struct {
+	Failed Multi
+	Errors []error
+}
+
+func (e *MultiError) Error() string {
+	var errs []string
+	for _, err := range e.Errors {
+		errs = append(errs, err.Error())
+	}
+	return strings.Join(errs, "; ")
+}
+
+type permanent struct {
+	err error
+}
+
+func (p permanent) Error() string {
+	return p.err.Error()
+}
+
+// Permanent marks an error that trying again won't fix, so Retry gives up
+// on it straight away
+func Permanent(err error) error {
+	return permanent{err}
+}
+
+// IsPermanent reports whether err was marked with Permanent, or is a
+// *MultiError of only permanent errors
+func IsPermanent(err error) bool {
+	if multi, ok := err.(*MultiError); ok {
+		for _, err := range multi.Errors {
+			if !IsPermanent(err) {
+				return false
+			}
+		}
+		return len(multi.Errors) > 0
+	}
+
+	_, ok := err.(permanent)
+	return ok
+}
+
+// Retry tries a Notifier again when it fails, waiting longer each time
+type Retry struct {
+	Notifier Notifier
+
+	// Attempts is how many times to try in all, 3 when 0
+	Attempts int
+
+	// Backoff is the wait before the second try, 1s when 0. It doubles for
+	// each try after that, up to MaxBackoff when that is set
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Sleep is time.Sleep unless set
+	Sleep func(time.Duration)
+}
+
+// WithRetry wraps n to try attempts times, starting with a wait of backoff
+func WithRetry(n Notifier, attempts int, backoff time.Duration) *Retry {
+	return &Retry{
+		Notifier: n,
+		Attempts: attempts,
+		Backoff:  backoff,
+	}
+}
+
+// Notify sends m, trying again on errors that aren't permanent. When the
+// Notifier is a Multi, only its Notifiers that failed are tried again
+func (r *Retry) Notify(m Message) (err error) {
+	attempts := r.Attempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+
+	backoff := r.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	sleep := r.Sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	n := r.Notifier
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			sleep(backoff)
+			backoff *= 2
+			if r.MaxBackoff > 0 && backoff > r.MaxBackoff {
+				backoff = r.MaxBackoff
+			}
+		}
+
+		if err = n.Notify(m); err == nil || IsPermanent(err) {
+			return
+		}
+
+		if multi, ok := err.(*MultiError); ok {
+			n = multi.Failed
+		}
+	}
+
+	return fmt.Errorf("notify: gave up after %d attempts: %v", attempts, err)
+}
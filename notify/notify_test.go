@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+func TestTemplateRender(t *testing.T) {
+	tmpl, err := NewTemplate(
+		"{{.Ticket.DefaultSubject}}\n got a reply",
+		"{{.Note.Creator.Address}} wrote: {{text .Note.Content}} ({{.Fields.tier}})",
+	)
+	if err != nil {
+		t.Fatalf("Expected no error in NewTemplate(), got %v", err)
+	}
+
+	m, err := tmpl.Render(Data{
+		Event:  "reply",
+		Ticket: snappy.Ticket{ID: 7, DefaultSubject: "Help"},
+		Note:   snappy.Note{ID: 3, Content: "<p>Any news?</p>", Creator: snappy.Contact{Address: "sam@example.com"}},
+		Fields: map[string]interface{}{"tier": "stale"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error in Render(), got %v", err)
+	}
+
+	if m.Subject != "Help got a reply" || m.Body != "sam@example.com wrote: Any news? (stale)" {
+		t.Errorf("Unexpected message %q %q", m.Subject, m.Body)
+	}
+
+	if m.Event != "reply" || m.Ticket == nil || m.Ticket.ID != 7 || m.Note == nil || m.WallPost != nil {
+		t.Errorf("Expected the message to be about the ticket and note, got %+v", m)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	if _, err := NewTemplate("{{.Nope", ""); err == nil || !strings.HasPrefix(err.Error(), "notify: subject:") {
+		t.Errorf("Expected a subject error, got %v", err)
+	}
+
+	tmpl, _ := NewTemplate("{{.Nope}}", "")
+	if _, err := tmpl.Render(Data{}); err == nil {
+		t.Errorf("Expected an error rendering a missing field")
+	}
+}
+
+func TestMulti(t *testing.T) {
+	var got []string
+	ok := NotifierFunc(func(m Message) error { got = append(got, m.Subject); return nil })
+	failing := NotifierFunc(func(m Message) error { return errors.New("down") })
+
+	err := Multi{failing, ok, failing}.Notify(Message{Subject: "hi"})
+	if err == nil || err.Error() != "down; down" {
+		t.Errorf("Expected both errors, got %v", err)
+	}
+	if reflect.DeepEqual([]string{"hi"}, got) == false {
+		t.Errorf("Expected the working notifier to get the message, got %v", got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	flaky := NotifierFunc(func(m Message) error {
+		calls++
+		if calls < 3 {
+			return errors.New("try again")
+		}
+		return nil
+	})
+
+	var slept []time.Duration
+	r := WithRetry(flaky, 4, time.Second)
+	r.MaxBackoff = 1500 * time.Millisecond
+	r.Sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	if err := r.Notify(Message{}); err != nil {
+		t.Fatalf("Expected no error in Notify(), got %v", err)
+	}
+
+	if expected := []time.Duration{time.Second, 1500 * time.Millisecond}; reflect.DeepEqual(expected, slept) == false {
+		t.Errorf("Expected waits of %v, got %v", expected, slept)
+	}
+
+	calls = -10
+	if err := r.Notify(Message{}); err == nil || !strings.Contains(err.Error(), "gave up after 4 attempts: try again") {
+		t.Errorf("Expected to give up, got %v", err)
+	}
+}
+
+func TestRetryMulti(t *testing.T) {
+	sent, calls := 0, 0
+	ok := NotifierFunc(func(m Message) error { sent++; return nil })
+	flaky := NotifierFunc(func(m Message) error {
+		if calls++; calls < 3 {
+			return errors.New("try again")
+		}
+		return nil
+	})
+
+	r := WithRetry(Multi{ok, flaky}, 3, time.Second)
+	r.Sleep = func(time.Duration) {}
+
+	if err := r.Notify(Message{}); err != nil || sent != 1 || calls != 3 {
+		t.Errorf("Expected only the failing notifier to be tried again, got %d sends, %d tries and %v", sent, calls, err)
+	}
+
+	bad := NotifierFunc(func(m Message) error { return Permanent(errors.New("bad address")) })
+	down := NotifierFunc(func(m Message) error { return errors.New("down") })
+
+	if err := (Multi{ok, bad, bad}).Notify(Message{}); !IsPermanent(err) {
+		t.Errorf("Expected only permanent errors to be permanent, got %v", err)
+	}
+
+	err := Multi{bad, down}.Notify(Message{})
+	if IsPermanent(err) {
+		t.Errorf("Expected a permanent and a temporary error not to be permanent")
+	}
+	if multi, ok := err.(*MultiError); !ok || len(multi.Failed) != 2 || !IsPermanent(multi.Errors[0]) {
+		t.Errorf("Expected a MultiError keeping each error, got %#v", err)
+	}
+}
+
+func TestRetryPermanent(t *testing.T) {
+	calls := 0
+	broken := NotifierFunc(func(m Message) error {
+		calls++
+		return Permanent(errors.New("bad address"))
+	})
+
+	r := WithRetry(broken, 3, time.Second)
+	r.Sleep = func(time.Duration) {}
+
+	if err := r.Notify(Message{}); err == nil || err.Error() != "bad address" || calls != 1 {
+		t.Errorf("Expected one try and the permanent error, got %d tries and %v", calls, err)
+	}
+}
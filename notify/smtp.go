@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP emails messages through a mail server
+type SMTP struct {
+	// Addr is the server's host:port
+	Addr string
+
+	// Auth is used when the server asks for it, e.g. smtp.PlainAuth
+	Auth smtp.Auth
+
+	From string
+	To   []string
+}
+
+// NewSMTP creates an SMTP notifier sending from one address to others
+func NewSMTP(addr string, auth smtp.Auth, from string, to ...string) *SMTP {
+	return &SMTP{
+		Addr: addr,
+		Auth: auth,
+		From: from,
+		To:   to,
+	}
+}
+
+// Notify emails m as plain text
+func (s *SMTP) Notify(m Message) error {
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return Permanent(fmt.Errorf("notify: from address: %v", err))
+	}
+
+	if len(s.To) == 0 {
+		return Permanent(fmt.Errorf("notify: no one to email"))
+	}
+
+	var to []string
+	var recipients []string
+	for _, address := range s.To {
+		a, err := mail.ParseAddress(address)
+		if err != nil {
+			return Permanent(fmt.Errorf("notify: to address %q: %v", address, err))
+		}
+		to = append(to, a.String())
+		recipients = append(recipients, a.Address)
+	}
+
+	date := m.Time
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("Mime-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	// the writer ends lines with CRLF itself
+	qp := quotedprintable.NewWriter(&b)
+	if _, err := qp.Write([]byte(m.Body)); err != nil {
+		return fmt.Errorf("notify: smtp: %v", err)
+	}
+	if err := qp.Close(); err != nil {
+		return fmt.Errorf("notify: smtp: %v", err)
+	}
+
+	if err := smtp.SendMail(s.Addr, s.Auth, from.Address, recipients, b.Bytes()); err != nil {
+		return fmt.Errorf("notify: smtp: %v", err)
+	}
+	return nil
+}
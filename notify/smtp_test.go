@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpServer is a stand-in mail server that accepts one message
+type smtpServer struct {
+	listener   net.Listener
+	from       string
+	recipients []string
+	data       string
+	done       chan struct{}
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &smtpServer{listener: l, done: make(chan struct{})}
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	defer close(s.done)
+
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 localhost ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch command {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			s.from = line[len("MAIL FROM:"):]
+			reply("250 ok")
+		case "RCPT":
+			s.recipients = append(s.recipients, line[len("RCPT TO:"):])
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.data = data.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	server := newSMTPServer(t)
+	defer server.listener.Close()
+
+	n := NewSMTP(server.listener.Addr().String(), nil, "Snappy Bot <bot@example.com>", "boss@example.com", "Sam <sam@example.com>")
+
+	err := n.Notify(Message{
+		Subject: "Ticket 7 is waiting – still",
+		Body:    "It has waited a day.\n.\nPlease look.",
+		Time:    time.Date(2014, 1, 2, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error in Notify(), got %v", err)
+	}
+	<-server.done
+
+	if server.from != "<bot@example.com>" {
+		t.Errorf("Unexpected MAIL FROM %q", server.from)
+	}
+	if expected := "<boss@example.com> <sam@example.com>"; strings.Join(server.recipients, " ") != expected {
+		t.Errorf("Expected recipients %q, got %q", expected, server.recipients)
+	}
+
+	// undo the dot stuffing before parsing
+	msg, err := mail.ReadMessage(strings.NewReader(strings.Replace(server.data, "\r\n..", "\r\n.", -1)))
+	if err != nil {
+		t.Fatalf("Expected no error reading the message, got %v", err)
+	}
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "Ticket 7 is waiting – still" {
+		t.Errorf("Unexpected subject %q", subject)
+	}
+	if to := msg.Header.Get("To"); to != `<boss@example.com>, "Sam" <sam@example.com>` {
+		t.Errorf("Unexpected To %q", to)
+	}
+
+	body, _ := ioutil.ReadAll(msg.Body)
+	if expected := "It has waited a day.\r\n.\r\nPlease look."; strings.TrimSpace(string(body)) != expected {
+		t.Errorf("Expected body %q, got %q", expected, body)
+	}
+}
+
+func TestSMTPBadAddress(t *testing.T) {
+	err := NewSMTP("127.0.0.1:1", nil, "not an address").Notify(Message{})
+	if err == nil || !IsPermanent(err) {
+		t.Errorf("Expected a permanent error, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Webhook posts messages as JSON to a URL
+type Webhook struct {
+	URL string
+
+	// Header is added to every request, e.g. for an Authorization token
+	Header http.Header
+
+	// Client is http.DefaultClient unless set
+	Client *http.Client
+}
+
+// NewWebhook creates a Webhook posting to url
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url}
+}
+
+// Notify posts m. Responses other than 2xx are errors, and 4xx ones other
+// than 408 and 429 are permanent
+func (w *Webhook) Notify(m Message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(b))
+	if err != nil {
+		return Permanent(fmt.Errorf("notify: webhook: %v", err))
+	}
+
+	for key, values := range w.Header {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notify: webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	err = fmt.Errorf("notify: webhook: %s", resp.Status)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/derekpitt/snappy"
+)
+
+func TestWebhook(t *testing.T) {
+	var got Message
+	var auth string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	w := NewWebhook(server.URL)
+	w.Header = http.Header{"Authorization": {"Bearer token"}}
+
+	err := w.Notify(Message{Subject: "hi", Event: "escalation", Ticket: &snappy.Ticket{ID: 7}})
+	if err != nil {
+		t.Fatalf("Expected no error in Notify(), got %v", err)
+	}
+
+	if got.Subject != "hi" || got.Event != "escalation" || got.Ticket == nil || got.Ticket.ID != 7 {
+		t.Errorf("Unexpected message %+v", got)
+	}
+	if auth != "Bearer token" {
+		t.Errorf("Expected the header to be sent, got %q", auth)
+	}
+}
+
+func TestWebhookErrors(t *testing.T) {
+	cases := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusBadGateway, false},
+	}
+
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+		}))
+
+		err := NewWebhook(server.URL).Notify(Message{})
+		if err == nil || IsPermanent(err) != c.permanent {
+			t.Errorf("%d: expected an error, permanent %v, got %v", c.status, c.permanent, err)
+		}
+
+		server.Close()
+	}
+}
@@ -0,0 +1,416 @@
+package render
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	heading     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	rule        = regexp.MustCompile(`^ {0,3}([-*_])( *[-*_]){2,} *$`)
+	bullet      = regexp.MustCompile(`^ {0,3}[-*+]\s+`)
+	numbered    = regexp.MustCompile(`^ {0,3}\d{1,9}[.)]\s+`)
+	fence       = regexp.MustCompile("^ {0,3}(```|~~~)")
+	quoteMarker = regexp.MustCompile(`^ {0,3}> ?`)
+)
+
+// Markdown converts Markdown to HTML that is safe to send as the body of a
+// NewNote or NewWallPost. Any HTML in the source is escaped rather than
+// passed through, and links and images only keep http, https and mailto
+// addresses (or relative ones).
+//
+// Headings, paragraphs, hard line breaks, emphasis, strong, strikethrough,
+// code spans, fenced code blocks, block quotes, nested lists, horizontal
+// rules, links, autolinks and images are supported.
+func Markdown(md string) string {
+	md = strings.Replace(md, "\r\n", "\n", -1)
+	md = strings.Replace(md, "\t", "    ", -1)
+	return strings.Join(blocks(strings.Split(md, "\n")), "\n")
+}
+
+// Plain converts plain text to HTML, escaping it and keeping its paragraphs
+// and line breaks
+func Plain(text string) string {
+	text = strings.Replace(strings.TrimSpace(text), "\r\n", "\n", -1)
+
+	var paragraphs []string
+	for _, p := range strings.Split(text, "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			paragraphs = append(paragraphs, "<p>"+strings.Replace(html.EscapeString(p), "\n", "<br>", -1)+"</p>")
+		}
+	}
+	return strings.Join(paragraphs, "\n")
+}
+
+// blocks renders lines of Markdown as HTML blocks
+func blocks(lines []string) []string {
+	var out []string
+	var para []string
+
+	endPara := func() {
+		if len(para) > 0 {
+			out = append(out, "<p>"+paragraph(para)+"</p>")
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			endPara()
+
+		case fence.MatchString(line):
+			endPara()
+			marker := fence.FindStringSubmatch(line)[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), marker); i++ {
+				code = append(code, lines[i])
+			}
+			out = append(out, "<pre><code>"+html.EscapeString(strings.Join(code, "\n"))+"</code></pre>")
+
+		case heading.MatchString(trimmed):
+			endPara()
+			m := heading.FindStringSubmatch(trimmed)
+			level := string('0' + rune(len(m[1])))
+			out = append(out, "<h"+level+">"+inline(m[2])+"</h"+level+">")
+
+		case rule.MatchString(line):
+			endPara()
+			out = append(out, "<hr>")
+
+		case quoteMarker.MatchString(line):
+			endPara()
+			var quoted []string
+			for ; i < len(lines) && quoteMarker.MatchString(lines[i]); i++ {
+				quoted = append(quoted, quoteMarker.ReplaceAllString(lines[i], ""))
+			}
+			i--
+			out = append(out, "<blockquote>\n"+strings.Join(blocks(quoted), "\n")+"\n</blockquote>")
+
+		case bullet.MatchString(line) || numbered.MatchString(line):
+			endPara()
+			var block string
+			block, i = listBlock(lines, i)
+			out = append(out, block)
+
+		default:
+			para = append(para, line)
+		}
+	}
+
+	endPara()
+	return out
+}
+
+// listBlock renders the list starting at lines[start], returning the html and the
+// index of its last line
+func listBlock(lines []string, start int) (string, int) {
+	ordered := numbered.MatchString(lines[start])
+	marker := bullet
+	tag := "ul"
+	if ordered {
+		marker = numbered
+		tag = "ol"
+	}
+
+	var items [][]string
+	loose := false
+	i := start
+
+	for ; i < len(lines); i++ {
+		line := lines[i]
+
+		if strings.TrimSpace(line) == "" {
+			// a blank line only continues the list if the list goes on after it
+			if i+1 < len(lines) && (marker.MatchString(lines[i+1]) || indented(lines[i+1])) {
+				loose = true
+				items[len(items)-1] = append(items[len(items)-1], "")
+				continue
+			}
+			break
+		}
+
+		// indented lines belong to the item, which is how lists nest
+		if i > start && indented(line) {
+			items[len(items)-1] = append(items[len(items)-1], dedent(line))
+			continue
+		}
+
+		if m := marker.FindString(line); m != "" {
+			items = append(items, []string{line[len(m):]})
+			continue
+		}
+
+		// lazy continuation of the item's paragraph
+		if !bullet.MatchString(line) && !numbered.MatchString(line) && !quoteMarker.MatchString(line) && !fence.MatchString(line) && !heading.MatchString(strings.TrimSpace(line)) {
+			items[len(items)-1] = append(items[len(items)-1], line)
+			continue
+		}
+
+		break
+	}
+
+	var b strings.Builder
+	b.WriteString("<" + tag + ">\n")
+
+	for _, item := range items {
+		content := strings.Join(blocks(item), "\n")
+		if !loose {
+			content = unwrapParagraph(content)
+		}
+		b.WriteString("<li>" + content + "</li>\n")
+	}
+
+	b.WriteString("</" + tag + ">")
+	return b.String(), i - 1
+}
+
+// indented reports whether a line is indented enough to belong to a list item
+func indented(line string) bool {
+	return strings.HasPrefix(line, "  ") && strings.TrimSpace(line) != ""
+}
+
+// dedent removes up to four leading spaces
+func dedent(line string) string {
+	for i := 0; i < 4 && strings.HasPrefix(line, " "); i++ {
+		line = line[1:]
+	}
+	return line
+}
+
+// unwrapParagraph drops the <p> around the first paragraph of a tight list item
+func unwrapParagraph(content string) string {
+	if !strings.HasPrefix(content, "<p>") {
+		return content
+	}
+	end := strings.Index(content, "</p>")
+	return content[3:end] + content[end+4:]
+}
+
+// paragraph renders the lines of a paragraph, keeping hard line breaks
+func paragraph(lines []string) string {
+	var b strings.Builder
+
+	for i, line := range lines {
+		hard := strings.HasSuffix(line, "  ") || strings.HasSuffix(line, "\\")
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, "\\") {
+			line = strings.TrimSuffix(line, "\\")
+		}
+
+		b.WriteString(inline(line))
+
+		if i < len(lines)-1 {
+			if hard {
+				b.WriteString("<br>")
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+// escapable are the characters a backslash can escape
+const escapable = "\\`*_{}[]()#+-.!|~<>\""
+
+// inline renders emphasis, code, links and images in a line of text,
+// escaping everything else
+func inline(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		rest := s[i:]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(escapable, s[i+1]) >= 0:
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			ticks := len(rest) - len(strings.TrimLeft(rest, "`"))
+			if end := strings.Index(rest[ticks:], rest[:ticks]); end >= 0 {
+				code := strings.TrimSpace(rest[ticks : ticks+end])
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += ticks + end + ticks
+				continue
+			}
+
+		case c == '!' && strings.HasPrefix(rest, "!["):
+			if text, dest, n, ok := linkParts(rest[1:]); ok {
+				if safeURL(dest) {
+					b.WriteString(`<img src="` + html.EscapeString(dest) + `" alt="` + html.EscapeString(text) + `">`)
+				} else {
+					b.WriteString(html.EscapeString(text))
+				}
+				i += 1 + n
+				continue
+			}
+
+		case c == '[':
+			if text, dest, n, ok := linkParts(rest); ok {
+				if safeURL(dest) {
+					b.WriteString(`<a href="` + html.EscapeString(dest) + `">` + inline(text) + "</a>")
+				} else {
+					b.WriteString(inline(text))
+				}
+				i += n
+				continue
+			}
+
+		case c == '<':
+			if end := strings.IndexByte(rest, '>'); end > 0 {
+				dest := rest[1:end]
+				if !strings.ContainsAny(dest, " <") && (strings.Contains(dest, "://") || strings.Contains(dest, "@")) {
+					href := dest
+					if !strings.Contains(dest, ":") {
+						href = "mailto:" + dest
+					}
+					if safeURL(href) {
+						b.WriteString(`<a href="` + html.EscapeString(href) + `">` + html.EscapeString(dest) + "</a>")
+						i += end + 1
+						continue
+					}
+				}
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if span, n, ok := emphasis(s, i); ok {
+				b.WriteString(span)
+				i += n
+				continue
+			}
+		}
+
+		b.WriteString(html.EscapeString(string(c)))
+		i++
+	}
+
+	return b.String()
+}
+
+// emphasis renders the emphasis, strong or strikethrough span starting at
+// s[i], returning how many bytes it used
+func emphasis(s string, i int) (string, int, bool) {
+	rest := s[i:]
+	c := rest[0]
+
+	delim := string(c)
+	if strings.HasPrefix(rest, delim+delim) {
+		delim += delim
+	}
+	if c == '~' && len(delim) != 2 {
+		return "", 0, false
+	}
+
+	inner := rest[len(delim):]
+	if inner == "" || inner[0] == ' ' {
+		return "", 0, false
+	}
+
+	// underscores inside words are just underscores
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return "", 0, false
+	}
+
+	end := -1
+	for j := 0; j+len(delim) <= len(inner); j++ {
+		if !strings.HasPrefix(inner[j:], delim) || j == 0 || inner[j-1] == ' ' {
+			continue
+		}
+		if c == '_' && j+len(delim) < len(inner) && isWordByte(inner[j+len(delim)]) {
+			continue
+		}
+		// a single delimiter can't close on half of a double one
+		if len(delim) == 1 && strings.HasPrefix(inner[j:], delim+delim) {
+			j++
+			continue
+		}
+		end = j
+		break
+	}
+
+	if end < 0 {
+		return "", 0, false
+	}
+
+	tag := "em"
+	switch {
+	case c == '~':
+		tag = "del"
+	case len(delim) == 2:
+		tag = "strong"
+	}
+
+	return "<" + tag + ">" + inline(inner[:end]) + "</" + tag + ">", len(delim)*2 + end, true
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// linkParts splits "[text](dest)" at the start of s, returning how many bytes it used
+func linkParts(s string) (text, dest string, n int, ok bool) {
+	depth := 0
+	closing := -1
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+		if depth == 0 {
+			closing = i
+			break
+		}
+	}
+
+	if closing < 0 || closing+1 >= len(s) || s[closing+1] != '(' {
+		return
+	}
+
+	end := strings.IndexByte(s[closing+1:], ')')
+	if end < 0 {
+		return
+	}
+
+	dest = strings.TrimSpace(s[closing+2 : closing+1+end])
+
+	// an optional "title" after the address is dropped
+	if i := strings.IndexAny(dest, " \t"); i >= 0 {
+		dest = dest[:i]
+	}
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+
+	return s[1:closing], dest, closing + 2 + end, true
+}
+
+// safeURL reports whether a link address is allowed into the html
+func safeURL(dest string) bool {
+	if dest == "" || strings.IndexFunc(dest, func(r rune) bool { return r < ' ' || r == 0x7f }) >= 0 {
+		return false
+	}
+
+	u, err := url.Parse(dest)
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,56 @@
+package render
+
+import (
+	"testing"
+)
+
+func TestMarkdown(t *testing.T) {
+	cases := []struct {
+		in, expected string
+	}{
+		{"Hello *there*, **friend** and ~~foe~~", "<p>Hello <em>there</em>, <strong>friend</strong> and <del>foe</del></p>"},
+		{"snake_case_name and _emphasis_", "<p>snake_case_name and <em>emphasis</em></p>"},
+		{"# Title #\n\npara one\nstill one  \nbroken\n\npara two", "<h1>Title</h1>\n<p>para one\nstill one<br>\nbroken</p>\n<p>para two</p>"},
+		{"use `a < b` here\n\n```\nif a < b {\n}\n```", "<p>use <code>a &lt; b</code> here</p>\n<pre><code>if a &lt; b {\n}</code></pre>"},
+		{"- one\n- two\n  - nested\n- three", "<ul>\n<li>one</li>\n<li>two\n<ul>\n<li>nested</li>\n</ul></li>\n<li>three</li>\n</ul>"},
+		{"1. first\n2. second", "<ol>\n<li>first</li>\n<li>second</li>\n</ol>"},
+		{"> quoted\n> more\n\nafter", "<blockquote>\n<p>quoted\nmore</p>\n</blockquote>\n<p>after</p>"},
+		{"[docs](https://example.com/a?b=1&c=2 \"title\") and <help@test.com>", `<p><a href="https://example.com/a?b=1&amp;c=2">docs</a> and <a href="mailto:help@test.com">help@test.com</a></p>`},
+		{"---", "<hr>"},
+		{`\*not emphasis\*`, "<p>*not emphasis*</p>"},
+	}
+
+	for _, c := range cases {
+		if got := Markdown(c.in); got != c.expected {
+			t.Errorf("Markdown(%q):\nexpected %q\ngot      %q", c.in, c.expected, got)
+		}
+	}
+}
+
+func TestMarkdownSanitizes(t *testing.T) {
+	cases := []struct {
+		in, expected string
+	}{
+		{"<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{`<img src=x onerror="alert(1)">`, "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>"},
+		{"[click](javascript:alert(1))", "<p>click)</p>"},
+		{"[click](JavaScript:alert)", "<p>click</p>"},
+		{"![x](data:image/png;base64,AAAA)", "<p>x</p>"},
+		{`[a"b](https://example.com/"onmouseover="x)`, `<p><a href="https://example.com/&#34;onmouseover=&#34;x">a&#34;b</a></p>`},
+	}
+
+	for _, c := range cases {
+		if got := Markdown(c.in); got != c.expected {
+			t.Errorf("Markdown(%q):\nexpected %q\ngot      %q", c.in, c.expected, got)
+		}
+	}
+}
+
+func TestPlain(t *testing.T) {
+	in := "Hi <Sam>,\r\nline two & more\n\n\n\nThanks"
+	expected := "<p>Hi &lt;Sam&gt;,<br>line two &amp; more</p>\n<p>Thanks</p>"
+
+	if got := Plain(in); got != expected {
+		t.Errorf("Plain(%q):\nexpected %q\ngot      %q", in, expected, got)
+	}
+}
@@ -0,0 +1,416 @@
+// Package render converts between the formats Snappy content comes in:
+// note HTML to readable plain text, and Markdown to sanitized HTML for the
+// bodies of new notes and wall posts.
+package render
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/derekpitt/snappy"
+)
+
+// markup spots content that is HTML rather than plain text
+var markup = regexp.MustCompile(`(?i)</?(p|div|br|span|blockquote|html|body|a|b|i|strong|em|ul|ol|li|table|pre|h[1-6])\b[^>]*>`)
+
+// IsHTML reports whether s looks like HTML rather than plain text
+func IsHTML(s string) bool {
+	return markup.MatchString(s)
+}
+
+// NoteText returns the content of a note as plain text
+func NoteText(n snappy.Note) string {
+	if IsHTML(n.Content) {
+		return Text(n.Content)
+	}
+	return strings.TrimSpace(strings.Replace(n.Content, "\r\n", "\n", -1))
+}
+
+// WallPostText returns the content of a wall post as plain text. The Markdown
+// source is already readable so it is used when the post has one
+func WallPostText(p snappy.WallPost) string {
+	if strings.TrimSpace(p.ContentMarkdown) != "" {
+		return strings.TrimSpace(p.ContentMarkdown)
+	}
+	return Text(p.Content)
+}
+
+// blockTags start a new line when they open or close
+var blockTags = map[string]bool{
+	"p": true, "div": true, "br": true, "ul": true, "ol": true, "li": true,
+	"table": true, "tr": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "pre": true, "hr": true, "blockquote": true,
+	"section": true, "article": true, "header": true, "footer": true,
+}
+
+// paragraphTags are followed by a blank line
+var paragraphTags = map[string]bool{
+	"p": true, "table": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "pre": true, "blockquote": true,
+}
+
+type list struct {
+	ordered bool
+	n       int
+}
+
+type link struct {
+	href  string
+	start int
+}
+
+type textRenderer struct {
+	out  strings.Builder
+	line strings.Builder
+
+	quote  int
+	pre    int
+	lists  []list
+	marker string
+	links  []link
+	blank  bool
+
+	// written is the quote depth of the last line written
+	written int
+
+	// row holds the cells of the table row being read, cell where the
+	// current cell starts in line (-1 outside a cell)
+	row    []string
+	header bool
+	cell   int
+}
+
+// Text converts HTML to plain text. Links keep their address after the link
+// text, list items get "- " or "1. " markers, blockquotes are prefixed with
+// "> " like an email client would and table cells are separated by " | "
+func Text(s string) string {
+	r := &textRenderer{cell: -1}
+
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			lt = len(s)
+		}
+
+		r.line.WriteString(html.UnescapeString(s[:lt]))
+		s = s[lt:]
+
+		if s == "" {
+			break
+		}
+
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				break
+			}
+			s = s[end+3:]
+			continue
+		}
+
+		gt := strings.IndexByte(s, '>')
+		if gt < 0 {
+			break
+		}
+
+		raw := s[1:gt]
+		s = s[gt+1:]
+
+		closing := strings.HasPrefix(raw, "/")
+		name := strings.ToLower(strings.TrimLeft(raw, "/"))
+		if i := strings.IndexAny(name, " \t\r\n/"); i >= 0 {
+			name = name[:i]
+		}
+
+		if !closing && (name == "script" || name == "style") {
+			end := strings.Index(strings.ToLower(s), "</"+name)
+			if end < 0 {
+				break
+			}
+			s = s[end:]
+			continue
+		}
+
+		r.tag(name, raw, closing)
+	}
+
+	r.flush()
+
+	return squeeze(r.out.String())
+}
+
+func (r *textRenderer) tag(name, raw string, closing bool) {
+	switch name {
+	case "a":
+		r.anchor(raw, closing)
+		return
+	case "img":
+		if alt := attr(raw, "alt"); alt != "" {
+			r.line.WriteString("[image: " + alt + "]")
+		}
+		return
+	case "td", "th":
+		r.tableCell(name, closing)
+		return
+	}
+
+	// inside a table cell blocks just separate words
+	if r.cell >= 0 && blockTags[name] {
+		r.line.WriteString(" ")
+		return
+	}
+
+	switch name {
+	case "tr":
+		r.flush()
+		if closing {
+			r.endRow()
+		} else {
+			r.row = nil
+			r.header = true
+		}
+		return
+	case "li":
+		r.flush()
+		if !closing {
+			r.startItem()
+		}
+		return
+	case "ul", "ol":
+		r.flush()
+		if closing {
+			if len(r.lists) > 0 {
+				r.lists = r.lists[:len(r.lists)-1]
+			}
+			if len(r.lists) == 0 {
+				r.blank = true
+			}
+		} else {
+			r.lists = append(r.lists, list{ordered: name == "ol"})
+		}
+		return
+	case "hr":
+		r.flush()
+		r.line.WriteString("---")
+		r.flush()
+		r.blank = true
+		return
+	case "pre":
+		r.flush()
+		if closing && r.pre > 0 {
+			r.pre--
+		} else if !closing {
+			r.pre++
+		}
+	case "blockquote":
+		r.flush()
+		if closing && r.quote > 0 {
+			r.quote--
+		} else if !closing {
+			r.quote++
+		}
+	}
+
+	if !blockTags[name] {
+		return
+	}
+
+	if name == "br" {
+		r.flushLine(true)
+		return
+	}
+
+	r.flush()
+
+	if paragraphTags[name] && (closing || name == "blockquote") {
+		r.blank = true
+	}
+}
+
+func (r *textRenderer) anchor(raw string, closing bool) {
+	if !closing {
+		r.links = append(r.links, link{href: attr(raw, "href"), start: r.line.Len()})
+		return
+	}
+
+	if len(r.links) == 0 {
+		return
+	}
+
+	l := r.links[len(r.links)-1]
+	r.links = r.links[:len(r.links)-1]
+
+	if l.href == "" || strings.HasPrefix(l.href, "#") {
+		return
+	}
+
+	text := ""
+	if l.start <= r.line.Len() {
+		text = strings.Join(strings.Fields(r.line.String()[l.start:]), " ")
+	}
+
+	switch {
+	case text == "":
+		r.line.WriteString(l.href)
+	case text == l.href, "mailto:"+text == l.href, "http://"+text == l.href, "https://"+text == l.href:
+	default:
+		r.line.WriteString(" (" + l.href + ")")
+	}
+}
+
+func (r *textRenderer) tableCell(name string, closing bool) {
+	if !closing {
+		if r.cell < 0 {
+			r.cell = r.line.Len()
+		}
+		if name == "td" {
+			r.header = false
+		}
+		return
+	}
+
+	if r.cell < 0 {
+		return
+	}
+
+	text := r.line.String()
+	r.row = append(r.row, strings.Join(strings.Fields(text[r.cell:]), " "))
+	r.line.Reset()
+	r.line.WriteString(text[:r.cell])
+	r.cell = -1
+}
+
+func (r *textRenderer) endRow() {
+	if len(r.row) == 0 {
+		return
+	}
+
+	r.line.WriteString(strings.Join(r.row, " | "))
+	r.flush()
+
+	if r.header {
+		var rule []string
+		for _, c := range r.row {
+			n := len([]rune(c))
+			if n < 3 {
+				n = 3
+			}
+			rule = append(rule, strings.Repeat("-", n))
+		}
+		r.line.WriteString(strings.Join(rule, " | "))
+		r.flush()
+	}
+
+	r.row = nil
+}
+
+func (r *textRenderer) startItem() {
+	if len(r.lists) == 0 {
+		r.lists = append(r.lists, list{})
+	}
+
+	l := &r.lists[len(r.lists)-1]
+	l.n++
+
+	r.marker = "- "
+	if l.ordered {
+		r.marker = strconv.Itoa(l.n) + ". "
+	}
+}
+
+// flush ends the current line if it has any text
+func (r *textRenderer) flush() {
+	r.flushLine(false)
+}
+
+// flushLine ends the current line, writing it even when it is empty if force is set
+func (r *textRenderer) flushLine(force bool) {
+	text := r.line.String()
+	r.line.Reset()
+
+	// links that are still open continue on the next line
+	for i := range r.links {
+		r.links[i].start = 0
+	}
+
+	var lines []string
+	if r.pre > 0 {
+		lines = strings.Split(strings.Trim(text, "\n"), "\n")
+		if len(lines) == 1 && lines[0] == "" {
+			lines = nil
+		}
+	} else if t := strings.Join(strings.Fields(text), " "); t != "" {
+		lines = []string{t}
+	}
+
+	if len(lines) == 0 && !force {
+		return
+	}
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+
+	quote := strings.Repeat("> ", r.quote)
+
+	if r.blank && r.out.Len() > 0 {
+		depth := r.quote
+		if r.written < depth {
+			depth = r.written
+		}
+		r.out.WriteString(strings.TrimSpace(strings.Repeat("> ", depth)) + "\n")
+	}
+	r.blank = false
+	r.written = r.quote
+
+	indent := ""
+	if len(r.lists) > 0 {
+		indent = strings.Repeat("   ", len(r.lists)-1)
+	}
+
+	for _, l := range lines {
+		r.out.WriteString(quote + indent)
+		if r.marker != "" {
+			r.out.WriteString(r.marker)
+			r.marker = ""
+		} else if len(r.lists) > 0 {
+			r.out.WriteString("   ")
+		}
+		r.out.WriteString(l + "\n")
+	}
+}
+
+// squeeze trims trailing space from lines and collapses runs of blank lines
+func squeeze(s string) string {
+	var lines []string
+	isBlank := func(l string) bool { return strings.Trim(l, "> ") == "" }
+
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimRight(l, " \t")
+		if isBlank(l) && (len(lines) == 0 || isBlank(lines[len(lines)-1])) {
+			continue
+		}
+		lines = append(lines, l)
+	}
+
+	for len(lines) > 0 && isBlank(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+var attrPattern = map[string]*regexp.Regexp{
+	"href": regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`),
+	"alt":  regexp.MustCompile(`(?i)\balt\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`),
+}
+
+// attr returns the value of an attribute of a raw tag
+func attr(raw, name string) string {
+	m := attrPattern[name].FindStringSubmatch(raw)
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(html.UnescapeString(m[1] + m[2] + m[3]))
+}
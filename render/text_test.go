@@ -0,0 +1,50 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/derekpitt/snappy"
+)
+
+func TestText(t *testing.T) {
+	cases := []struct {
+		in, expected string
+	}{
+		{"<p>Hi &amp; hello</p><p>Second   paragraph</p>", "Hi & hello\n\nSecond paragraph"},
+		{"line one<br>line two<br/>", "line one\nline two"},
+		{`See <a href="https://example.com/docs">the docs</a> or <a href="https://example.com">https://example.com</a>`, "See the docs (https://example.com/docs) or https://example.com"},
+		{`<a href="mailto:help@test.com">help@test.com</a> <a href="#top">top</a>`, "help@test.com top"},
+		{"<ul><li>one</li><li>two<ol><li>a</li><li>b</li></ol></li></ul><p>after</p>", "- one\n- two\n   1. a\n   2. b\n\nafter"},
+		{"<p>I said</p><blockquote><p>one</p><blockquote>two</blockquote></blockquote><p>after</p>", "I said\n\n> one\n>\n> > two\n\nafter"},
+		{"<table><tr><th>Name</th><th>Qty</th></tr><tr><td>Paper</td><td><p>2</p></td></tr></table>", "Name | Qty\n---- | ---\nPaper | 2"},
+		{"<pre>  indented\n    code</pre>", "  indented\n    code"},
+		{"<style>p { color: red }</style><!-- hidden --><script>alert(1)</script>visible", "visible"},
+		{`<h1>Title</h1>text<hr><img src="x.png" alt="logo">`, "Title\n\ntext\n---\n\n[image: logo]"},
+	}
+
+	for _, c := range cases {
+		if got := Text(c.in); got != c.expected {
+			t.Errorf("Text(%q): expected %q, got %q", c.in, c.expected, got)
+		}
+	}
+}
+
+func TestNoteText(t *testing.T) {
+	if got := NoteText(snappy.Note{Content: "plain\r\ntext <not a tag>"}); got != "plain\ntext <not a tag>" {
+		t.Errorf("Expected plain text to be left alone, got %q", got)
+	}
+
+	if got := NoteText(snappy.Note{Content: "<div>html</div>"}); got != "html" {
+		t.Errorf("Expected html to be converted, got %q", got)
+	}
+}
+
+func TestWallPostText(t *testing.T) {
+	if got := WallPostText(snappy.WallPost{Content: "<p>html</p>", ContentMarkdown: "**md**"}); got != "**md**" {
+		t.Errorf("Expected the markdown source, got %q", got)
+	}
+
+	if got := WallPostText(snappy.WallPost{Content: "<p>html</p>"}); got != "html" {
+		t.Errorf("Expected the html as text, got %q", got)
+	}
+}
@@ -0,0 +1,188 @@
+package snappy
+
+import (
+	"errors"
+	"strings"
+)
+
+// ReplyOptions changes how NewReply and ReplyToTicket build a reply
+type ReplyOptions struct {
+	// Subject defaults to the ticket's subject
+	Subject string
+
+	// StaffID is who the reply is from, the owner of the API key when zero
+	StaffID int
+
+	// To defaults to the ticket's next recipients, or its contacts (its
+	// opener, without any) when it has none
+	To   []NoteAddress
+	From []NoteAddress
+
+	// Private posts the reply to the account's wall, linked to the ticket,
+	// instead of sending it. The Snappy API can't add private notes, and the
+	// wall is only seen by staff
+	Private bool
+
+	// CheckConflicts gets the ticket again before a public reply, and
+	// returns a ConflictError instead if notes were added since it was read
+	CheckConflicts bool
+}
+
+// NewReply builds the note replying to a ticket, taking the nonce, mailbox,
+// recipients and subject from it, without sending it.
+// The API only takes "to" recipients, so the ticket's cc and bcc recipients
+// aren't copied to the reply
+func NewReply(ticket Ticket, body string, opts ReplyOptions) (note NewNote, err error) {
+	if strings.TrimSpace(body) == "" {
+		return note, errors.New("snappy: empty reply")
+	}
+
+	if ticket.TicketNonce == "" {
+		return note, errors.New("snappy: ticket has no nonce, get it with Ticket() first")
+	}
+
+	note = NewNote{
+		Subject:     opts.Subject,
+		Message:     body,
+		MailboxID:   ticket.MailboxID,
+		StaffID:     opts.StaffID,
+		TicketNonce: ticket.TicketNonce,
+		From:        opts.From,
+		To:          opts.To,
+	}
+
+	if note.Subject == "" {
+		note.Subject = ticket.DefaultSubject
+	}
+
+	if note.MailboxID == 0 {
+		note.MailboxID = ticket.Mailbox.ID
+	}
+
+	if len(note.To) == 0 {
+		note.To = ticket.replyRecipients()
+	}
+
+	return
+}
+
+// ErrNoteNotFound is returned by ReplyToTicket when the reply was sent but
+// the note it created couldn't be told apart from the ticket's other notes.
+// Don't send the reply again
+var ErrNoteNotFound = errors.New("snappy: reply sent, but the note it created wasn't found")
+
+// ReplyToTicket replies to a ticket with the note NewReply builds, and
+// returns the note it created. The API doesn't return the note, so the
+// ticket's notes are read before and after sending to find it.
+// A private reply is a wall post, not a note, and returns a zero Note
+func (s *Snappy) ReplyToTicket(ticket Ticket, body string, opts ReplyOptions) (note Note, err error) {
+	reply, err := NewReply(ticket, body, opts)
+	if err != nil {
+		return
+	}
+
+	if opts.Private {
+		accountID := ticket.AccountID
+		if accountID == 0 {
+			accountID = ticket.Mailbox.AccountID
+		}
+		if accountID == 0 {
+			return note, errors.New("snappy: ticket has no account id for a private reply")
+		}
+
+		err = s.CreateWallPost(accountID, NewWallPost{
+			Content:  body,
+			Type:     "post",
+			TicketID: ticket.ID,
+		})
+		return
+	}
+
+	if ticket.ID == 0 {
+		return note, errors.New("snappy: ticket has no id, get it with Ticket() first")
+	}
+
+	if opts.CheckConflicts {
+		if err = s.CheckConflict(ticket); err != nil {
+			return
+		}
+	}
+
+	before, err := s.TicketNotes(ticket.ID)
+	if err != nil {
+		return
+	}
+
+	if err = s.CreateNote(reply); err != nil {
+		return
+	}
+
+	after, err := s.TicketNotes(ticket.ID)
+	if err != nil {
+		return
+	}
+
+	note, ok := createdNote(before, after, body, opts.StaffID)
+	if !ok {
+		err = ErrNoteNotFound
+	}
+	return
+}
+
+// createdNote finds the note a reply with body from staffID added, among
+// the staff notes in after that weren't in before. The API may reformat the
+// body, so a single new note is taken when none has it exactly
+func createdNote(before, after []Note, body string, staffID int) (note Note, ok bool) {
+	seen := map[int]bool{}
+	for _, n := range before {
+		seen[n.ID] = true
+	}
+
+	var added []Note
+	for _, n := range after {
+		if seen[n.ID] || n.CreatedByStaffID == 0 || (staffID != 0 && n.CreatedByStaffID != staffID) {
+			continue
+		}
+		added = append(added, n)
+	}
+
+	for _, n := range added {
+		if strings.TrimSpace(n.Content) == strings.TrimSpace(body) && (!ok || n.ID > note.ID) {
+			note, ok = n, true
+		}
+	}
+
+	if !ok && len(added) == 1 {
+		note, ok = added[0], true
+	}
+
+	return
+}
+
+// replyRecipients is who a reply goes to when none are given
+func (t Ticket) replyRecipients() (to []NoteAddress) {
+	if len(t.NextRecipients.To) > 0 {
+		return t.NextRecipients.To
+	}
+
+	contacts := t.Contacts
+	if len(contacts) == 0 {
+		contacts = []Contact{t.Opener}
+	}
+
+	seen := map[string]bool{}
+	for _, c := range contacts {
+		address := strings.ToLower(c.Address)
+		if address == "" || seen[address] {
+			continue
+		}
+		seen[address] = true
+
+		to = append(to, NoteAddress{
+			Name:    strings.TrimSpace(c.FirstName + " " + c.LastName),
+			Address: c.Address,
+		})
+	}
+
+	return
+}
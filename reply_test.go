@@ -0,0 +1,142 @@
+package snappy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+var replyTicket = Ticket{
+	ID:             1,
+	AccountID:      3,
+	MailboxID:      2,
+	DefaultSubject: "Help",
+	TicketNonce:    "abc",
+	Contacts: []Contact{
+		{FirstName: "Test", LastName: "1", Address: "test@test.com"},
+		{FirstName: "Test", LastName: "1", Address: "TEST@test.com"},
+		{FirstName: "Other", Address: "other@test.com"},
+	},
+}
+
+func TestReplyToTicket(t *testing.T) {
+	setup()
+	defer teardown()
+
+	notes := []Note{{ID: 5, Content: "help!", CreatedByContactID: 1}}
+	mux.HandleFunc("/ticket/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(notes)
+	})
+
+	var got NewNote
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &got)
+
+		// someone else replied at the same time
+		notes = append(notes,
+			Note{ID: 6, Content: "on it", CreatedByStaffID: 4},
+			Note{ID: 7, Content: got.Message, CreatedByStaffID: 4},
+		)
+	})
+
+	note, err := client.ReplyToTicket(replyTicket, "thanks!", ReplyOptions{StaffID: 4})
+	if err != nil {
+		t.Fatalf("Expected no error in ReplyToTicket(), got %v", err)
+	}
+
+	if expected := (Note{ID: 7, Content: "thanks!", CreatedByStaffID: 4}); reflect.DeepEqual(expected, note) == false {
+		t.Errorf("Expected %+v, got %+v", expected, note)
+	}
+
+	expected := NewNote{
+		Subject:     "Help",
+		Message:     "thanks!",
+		MailboxID:   2,
+		StaffID:     4,
+		TicketNonce: "abc",
+		To: []NoteAddress{
+			{Name: "Test 1", Address: "test@test.com"},
+			{Name: "Other", Address: "other@test.com"},
+		},
+	}
+
+	if reflect.DeepEqual(expected, got) == false {
+		t.Errorf("Expected %+v to be sent, got %+v", expected, got)
+	}
+
+	next := replyTicket
+	next.NextRecipients = Recipients{To: []NoteAddress{{Name: "To Test", Address: "to@test.com"}}}
+
+	client.ReplyToTicket(next, "thanks!", ReplyOptions{Subject: "Re: Help"})
+	if reflect.DeepEqual(next.NextRecipients.To, got.To) == false || got.Subject != "Re: Help" {
+		t.Errorf("Expected the next recipients and subject to be used, got %+v", got)
+	}
+}
+
+func TestReplyToTicketNoteNotFound(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var notes []Note
+	mux.HandleFunc("/ticket/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(notes)
+	})
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		// the API reformatted the reply, and someone else replied too
+		notes = append(notes,
+			Note{ID: 6, Content: "on it", CreatedByStaffID: 4},
+			Note{ID: 7, Content: "<p>thanks!</p>", CreatedByStaffID: 3},
+		)
+	})
+
+	if _, err := client.ReplyToTicket(replyTicket, "thanks!", ReplyOptions{}); err != ErrNoteNotFound {
+		t.Errorf("Expected ErrNoteNotFound, got %v", err)
+	}
+
+	// only one of them is from the staff member replying
+	notes = nil
+	if note, err := client.ReplyToTicket(replyTicket, "thanks!", ReplyOptions{StaffID: 3}); err != nil || note.ID != 7 {
+		t.Errorf("Expected the new note from staff 3, got %+v, %v", note, err)
+	}
+}
+
+func TestReplyToTicketPrivate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected a private reply not to create a note")
+	})
+
+	var got NewWallPost
+	mux.HandleFunc("/account/3/wall", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &got)
+	})
+
+	note, err := client.ReplyToTicket(replyTicket, "call them back", ReplyOptions{Private: true})
+	if err != nil {
+		t.Fatalf("Expected no error in ReplyToTicket(), got %v", err)
+	}
+
+	if expected := (NewWallPost{Content: "call them back", Type: "post", TicketID: 1}); reflect.DeepEqual(expected, got) == false {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+
+	if reflect.DeepEqual(Note{}, note) == false {
+		t.Errorf("Expected no note for a private reply, got %+v", note)
+	}
+}
+
+func TestReplyToTicketErrors(t *testing.T) {
+	if _, err := client.ReplyToTicket(replyTicket, " \n", ReplyOptions{}); err == nil {
+		t.Error("Expected an error for an empty reply")
+	}
+
+	if _, err := client.ReplyToTicket(Ticket{ID: 1}, "hi", ReplyOptions{}); err == nil {
+		t.Error("Expected an error for a ticket without a nonce")
+	}
+}
@@ -0,0 +1,161 @@
+// Package report builds reports over an account's tickets, notes and wall:
+// staff workload, and tag trends, co-occurrence and resolution times.
+// Reports are slices of structs with json tags so they can be written as
+// CSV or JSON with the format package, or with WriteCSV and WriteJSON.
+package report
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/format"
+	"github.com/derekpitt/snappy/mirror"
+)
+
+// maxWallPages stops Collect from paging through a very long wall
+const maxWallPages = 40
+
+// Range is a span of time reports cover, From inclusive and To exclusive.
+// A zero bound is open
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// Contains reports whether t is within the range
+func (r Range) Contains(t time.Time) bool {
+	if !r.From.IsZero() && t.Before(r.From) {
+		return false
+	}
+	if !r.To.IsZero() && !t.Before(r.To) {
+		return false
+	}
+	return true
+}
+
+// Data is what reports are built from
+type Data struct {
+	Staff   []snappy.Employee
+	Tickets []snappy.Ticket
+	Notes   map[int][]snappy.Note
+	Wall    []snappy.WallPost
+}
+
+// Collect fetches the data of an account from the API: its staff, the
+// tickets in its mailbox listings with their notes, and the wall posts made
+// since r.From
+func Collect(client *snappy.Snappy, accountID int, r Range) (d *Data, err error) {
+	d = &Data{Notes: map[int][]snappy.Note{}}
+
+	if d.Staff, err = client.Staff(accountID); err != nil {
+		return nil, fmt.Errorf("report: staff: %v", err)
+	}
+
+	mailboxes, err := client.Mailboxes(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("report: mailboxes: %v", err)
+	}
+
+	seen := map[int]bool{}
+
+	for _, m := range mailboxes {
+		tickets, err := client.MailboxTickets(m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("report: mailbox %d: %v", m.ID, err)
+		}
+
+		for _, t := range tickets {
+			if seen[t.ID] {
+				continue
+			}
+			seen[t.ID] = true
+
+			notes, err := client.TicketNotes(t.ID)
+			if err != nil {
+				return nil, fmt.Errorf("report: notes for ticket %d: %v", t.ID, err)
+			}
+
+			d.Tickets = append(d.Tickets, t)
+			d.Notes[t.ID] = notes
+		}
+	}
+
+	posts, err := client.Wall(accountID)
+
+	for page := 0; err == nil && len(posts) > 0 && page < maxWallPages; page++ {
+		d.Wall = append(d.Wall, posts...)
+
+		last := posts[len(posts)-1]
+		if at, ok := parseTime(last.CreatedAt); ok && !r.From.IsZero() && at.Before(r.From) {
+			break
+		}
+
+		posts, err = client.WallAfter(accountID, last.ID)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("report: wall: %v", err)
+	}
+
+	return
+}
+
+// FromStore reads the data of an account from a mirror store. Stores don't
+// keep the wall, so wall activity is left empty
+func FromStore(store mirror.Store, accountID int) (d *Data, err error) {
+	d = &Data{Notes: map[int][]snappy.Note{}}
+
+	if d.Staff, err = store.Staff(accountID); err != nil {
+		return nil, err
+	}
+
+	if d.Tickets, err = store.Tickets(accountID); err != nil {
+		return nil, err
+	}
+
+	for _, t := range d.Tickets {
+		if d.Notes[t.ID], err = store.Notes(t.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// FromSearch collects the tickets matching a search. Notes, staff and wall
+// are left empty, which is enough for the tag reports
+func FromSearch(client *snappy.Snappy, accountID int, query string) (d *Data, err error) {
+	d = &Data{Notes: map[int][]snappy.Note{}}
+
+	if d.Tickets, err = client.SearchAll(accountID, query); err != nil {
+		return nil, fmt.Errorf("report: search %q: %v", query, err)
+	}
+
+	return
+}
+
+// parseTime parses the string timestamps of the API, which are in UTC
+func parseTime(s string) (time.Time, bool) {
+	t, err := time.ParseInLocation(snappy.TimeLayout, s, time.UTC)
+	return t, err == nil
+}
+
+// WriteCSV writes report rows as CSV with a header line
+func WriteCSV(w io.Writer, rows interface{}) error {
+	return write(w, "csv", rows)
+}
+
+// WriteJSON writes report rows as a JSON array
+func WriteJSON(w io.Writer, rows interface{}) error {
+	return write(w, "json", rows)
+}
+
+func write(w io.Writer, spec string, rows interface{}) error {
+	f, err := format.New(spec, format.Options{})
+	if err != nil {
+		return err
+	}
+	return f.Format(w, rows)
+}
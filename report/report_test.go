@@ -0,0 +1,136 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/mirror"
+)
+
+var (
+	mux    *http.ServeMux
+	server *httptest.Server
+	client *snappy.Snappy
+)
+
+func setup() {
+	mux = http.NewServeMux()
+	server = httptest.NewServer(mux)
+
+	client = snappy.WithAPIKey("apikey")
+	client.SetEndpointPrefix(server.URL)
+}
+
+func teardown() {
+	server.Close()
+}
+
+func at(s string) time.Time {
+	t, _ := time.Parse(snappy.TimeLayout, s)
+	return t
+}
+
+func TestRange(t *testing.T) {
+	r := Range{From: at("2014-01-01 00:00:00"), To: at("2014-01-02 00:00:00")}
+
+	if !r.Contains(at("2014-01-01 00:00:00")) || r.Contains(at("2014-01-02 00:00:00")) || r.Contains(at("2013-12-31 23:59:59")) {
+		t.Errorf("Expected From to be inclusive and To exclusive")
+	}
+
+	if !(Range{}).Contains(at("1999-01-01 00:00:00")) {
+		t.Errorf("Expected an empty range to contain everything")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/account/1/staff", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":5,"first_name":"Jane"}]`)
+	})
+	mux.HandleFunc("/account/1/mailboxes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":2}]`)
+	})
+	mux.HandleFunc("/mailbox/2/inbox", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":10},{"id":11}]`)
+	})
+	mux.HandleFunc("/mailbox/2/tickets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":11}]`)
+	})
+	mux.HandleFunc("/mailbox/2/yours", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[]`)
+	})
+	mux.HandleFunc("/ticket/10/notes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":100}]`)
+	})
+	mux.HandleFunc("/ticket/11/notes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":110},{"id":111}]`)
+	})
+	mux.HandleFunc("/account/1/wall", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("after") {
+		case "":
+			fmt.Fprintf(w, `[{"id":3,"created_at":"2014-01-05 10:00:00"},{"id":2,"created_at":"2014-01-03 10:00:00"}]`)
+		case "2":
+			fmt.Fprintf(w, `[{"id":1,"created_at":"2013-12-01 10:00:00"}]`)
+		default:
+			t.Errorf("Expected paging to stop once posts are older than the range")
+			fmt.Fprintf(w, `[]`)
+		}
+	})
+
+	d, err := Collect(client, 1, Range{From: at("2014-01-01 00:00:00")})
+	if err != nil {
+		t.Fatalf("Expected no error in Collect(), got %v", err)
+	}
+
+	if len(d.Staff) != 1 || len(d.Tickets) != 2 || len(d.Notes[11]) != 2 || len(d.Wall) != 3 {
+		t.Errorf("Unexpected data %+v", d)
+	}
+}
+
+func TestFromStore(t *testing.T) {
+	store := mirror.NewMemoryStore()
+	store.PutStaff(1, snappy.Employee{ID: 5})
+	store.PutTicket(snappy.Ticket{ID: 10, AccountID: 1})
+	store.PutTicket(snappy.Ticket{ID: 20, AccountID: 2})
+	store.PutNotes(10, []snappy.Note{snappy.Note{ID: 100}})
+
+	d, err := FromStore(store, 1)
+	if err != nil {
+		t.Fatalf("Expected no error in FromStore(), got %v", err)
+	}
+
+	if len(d.Staff) != 1 || len(d.Tickets) != 1 || len(d.Notes[10]) != 1 {
+		t.Errorf("Unexpected data %+v", d)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	rows := []Workload{{StaffID: 5, Name: "Jane Doe", Replies: 3, MedianReplySeconds: 90}}
+
+	var csv bytes.Buffer
+	if err := WriteCSV(&csv, rows); err != nil {
+		t.Fatalf("Expected no error in WriteCSV(), got %v", err)
+	}
+
+	expected := "staff_id,name,username,replies,private_notes,tickets_opened,assigned,median_reply_seconds,wall_posts,wall_comments,likes_given,likes_received\n" +
+		"5,Jane Doe,,3,0,0,0,90,0,0,0,0\n"
+	if csv.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, csv.String())
+	}
+
+	var js bytes.Buffer
+	if err := WriteJSON(&js, rows); err != nil {
+		t.Fatalf("Expected no error in WriteJSON(), got %v", err)
+	}
+
+	if !bytes.Contains(js.Bytes(), []byte(`"median_reply_seconds": 90`)) {
+		t.Errorf("Unexpected json %s", js.String())
+	}
+}
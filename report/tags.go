@@ -0,0 +1,220 @@
+package report
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/sla"
+)
+
+// Period is the bucket size of a trend
+type Period string
+
+// The periods a trend can be bucketed by. Weeks start on Monday
+const (
+	Day  Period = "day"
+	Week Period = "week"
+)
+
+// start returns the beginning of the period t falls in
+func (p Period) start(t time.Time) time.Time {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+
+	if p == Week {
+		offset := (int(day.Weekday()) + 6) % 7
+		day = day.AddDate(0, 0, -offset)
+	}
+
+	return day
+}
+
+// normalizeTags lowercases a ticket's tags and drops duplicates
+func normalizeTags(t snappy.Ticket) []string {
+	seen := map[string]bool{}
+	var tags []string
+	for _, tag := range t.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func opened(t snappy.Ticket, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.Unix(int64(t.OpenedAt), 0).In(loc)
+}
+
+// TagCount is how many tickets opened in a period had a tag
+type TagCount struct {
+	Tag     string `json:"tag"`
+	Period  string `json:"period"`
+	Tickets int    `json:"tickets"`
+}
+
+// TagTrend counts the tickets with each tag by the day or week they were
+// opened, in loc (UTC when nil). Rows are ordered by period, then tag
+func TagTrend(tickets []snappy.Ticket, period Period, loc *time.Location) []TagCount {
+	counts := map[[2]string]int{}
+
+	for _, t := range tickets {
+		p := period.start(opened(t, loc)).Format("2006-01-02")
+		for _, tag := range normalizeTags(t) {
+			counts[[2]string{p, tag}]++
+		}
+	}
+
+	rows := make([]TagCount, 0, len(counts))
+	for k, n := range counts {
+		rows = append(rows, TagCount{Tag: k[1], Period: k[0], Tickets: n})
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Period != rows[j].Period {
+			return rows[i].Period < rows[j].Period
+		}
+		return rows[i].Tag < rows[j].Tag
+	})
+
+	return rows
+}
+
+// TagPair is how many tickets had both of two tags
+type TagPair struct {
+	A       string `json:"a"`
+	B       string `json:"b"`
+	Tickets int    `json:"tickets"`
+}
+
+// TagPairs counts how often tags appear together, most common pairs first
+func TagPairs(tickets []snappy.Ticket) []TagPair {
+	counts := map[[2]string]int{}
+
+	for _, t := range tickets {
+		tags := normalizeTags(t)
+		for i := range tags {
+			for j := i + 1; j < len(tags); j++ {
+				counts[[2]string{tags[i], tags[j]}]++
+			}
+		}
+	}
+
+	rows := make([]TagPair, 0, len(counts))
+	for k, n := range counts {
+		rows = append(rows, TagPair{A: k[0], B: k[1], Tickets: n})
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Tickets != rows[j].Tickets {
+			return rows[i].Tickets > rows[j].Tickets
+		}
+		if rows[i].A != rows[j].A {
+			return rows[i].A < rows[j].A
+		}
+		return rows[i].B < rows[j].B
+	})
+
+	return rows
+}
+
+// TagResolution is how long tickets with a tag took to resolve
+type TagResolution struct {
+	Tag      string `json:"tag"`
+	Tickets  int    `json:"tickets"`
+	Resolved int    `json:"resolved"`
+
+	// AverageResolutionSeconds is over the resolved tickets
+	AverageResolutionSeconds int64 `json:"average_resolution_seconds"`
+}
+
+// AverageResolution returns AverageResolutionSeconds as a duration
+func (r TagResolution) AverageResolution() time.Duration {
+	return time.Duration(r.AverageResolutionSeconds) * time.Second
+}
+
+// TagResolutions works out the average resolution time of each tag, as
+// measured by calc (see sla for how resolution is measured, and for
+// measuring in business hours). Rows are ordered by tag
+func TagResolutions(tickets []snappy.Ticket, calc *sla.Calculator) []TagResolution {
+	byTag := map[string]*TagResolution{}
+	totals := map[string]time.Duration{}
+
+	for _, t := range tickets {
+		result := calc.Ticket(t)
+
+		for _, tag := range normalizeTags(t) {
+			row := byTag[tag]
+			if row == nil {
+				row = &TagResolution{Tag: tag}
+				byTag[tag] = row
+			}
+
+			row.Tickets++
+			if result.Resolved {
+				row.Resolved++
+				totals[tag] += result.Resolution
+			}
+		}
+	}
+
+	rows := make([]TagResolution, 0, len(byTag))
+	for tag, row := range byTag {
+		if row.Resolved > 0 {
+			row.AverageResolutionSeconds = int64(totals[tag] / time.Duration(row.Resolved) / time.Second)
+		}
+		rows = append(rows, *row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Tag < rows[j].Tag })
+
+	return rows
+}
+
+// NewTag is a tag first used within a range
+type NewTag struct {
+	Tag       string `json:"tag"`
+	FirstSeen string `json:"first_seen"`
+	Tickets   int    `json:"tickets"`
+}
+
+// NewTags lists the tags whose earliest ticket was opened within r, with
+// the number of tickets that have them. Rows are ordered by when the tag
+// first appeared
+func NewTags(tickets []snappy.Ticket, r Range) []NewTag {
+	first := map[string]time.Time{}
+	counts := map[string]int{}
+
+	for _, t := range tickets {
+		at := opened(t, time.UTC)
+		for _, tag := range normalizeTags(t) {
+			counts[tag]++
+			if f, ok := first[tag]; !ok || at.Before(f) {
+				first[tag] = at
+			}
+		}
+	}
+
+	var rows []NewTag
+	for tag, at := range first {
+		if r.Contains(at) {
+			rows = append(rows, NewTag{Tag: tag, FirstSeen: at.Format(snappy.TimeLayout), Tickets: counts[tag]})
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].FirstSeen != rows[j].FirstSeen {
+			return rows[i].FirstSeen < rows[j].FirstSeen
+		}
+		return rows[i].Tag < rows[j].Tag
+	})
+
+	return rows
+}
@@ -0,0 +1,111 @@
+package report
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/sla"
+)
+
+func tagTickets() []snappy.Ticket {
+	return []snappy.Ticket{
+		// Thursday
+		snappy.Ticket{ID: 1, OpenedAt: unix("2014-01-02 09:00:00"), Tags: []string{"#support", "@test1"}, Status: "closed", UpdatedAt: "2014-01-02 11:00:00"},
+		snappy.Ticket{ID: 2, OpenedAt: unix("2014-01-02 10:00:00"), Tags: []string{"#Support", "#billing", "#support"}, Status: "closed", UpdatedAt: "2014-01-02 14:00:00"},
+		// the next Monday
+		snappy.Ticket{ID: 3, OpenedAt: unix("2014-01-06 10:00:00"), Tags: []string{"#support", "#billing", "#outage"}, Status: "waiting"},
+		snappy.Ticket{ID: 4, OpenedAt: unix("2014-01-07 10:00:00")},
+	}
+}
+
+func TestTagTrend(t *testing.T) {
+	daily := TagTrend(tagTickets(), Day, nil)
+
+	expected := []TagCount{
+		{Tag: "#billing", Period: "2014-01-02", Tickets: 1},
+		{Tag: "#support", Period: "2014-01-02", Tickets: 2},
+		{Tag: "@test1", Period: "2014-01-02", Tickets: 1},
+		{Tag: "#billing", Period: "2014-01-06", Tickets: 1},
+		{Tag: "#outage", Period: "2014-01-06", Tickets: 1},
+		{Tag: "#support", Period: "2014-01-06", Tickets: 1},
+	}
+
+	if reflect.DeepEqual(expected, daily) == false {
+		t.Errorf("Expected %+v, got %+v", expected, daily)
+	}
+
+	weekly := TagTrend(tagTickets(), Week, nil)
+	if weekly[0].Period != "2013-12-30" || weekly[len(weekly)-1].Period != "2014-01-06" {
+		t.Errorf("Expected weeks to start on Monday, got %+v", weekly)
+	}
+
+	// 09:00 UTC on the 2nd is still the 1st in Honolulu
+	if hnl, err := time.LoadLocation("Pacific/Honolulu"); err == nil {
+		if got := TagTrend(tagTickets()[:1], Day, hnl); got[0].Period != "2014-01-01" {
+			t.Errorf("Expected days in the given location, got %+v", got)
+		}
+	}
+}
+
+func TestTagPairs(t *testing.T) {
+	expected := []TagPair{
+		{A: "#billing", B: "#support", Tickets: 2},
+		{A: "#billing", B: "#outage", Tickets: 1},
+		{A: "#outage", B: "#support", Tickets: 1},
+		{A: "#support", B: "@test1", Tickets: 1},
+	}
+
+	if got := TagPairs(tagTickets()); reflect.DeepEqual(expected, got) == false {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestTagResolutions(t *testing.T) {
+	got := TagResolutions(tagTickets(), sla.New(sla.Policy{}))
+
+	expected := []TagResolution{
+		{Tag: "#billing", Tickets: 2, Resolved: 1, AverageResolutionSeconds: 4 * 3600},
+		{Tag: "#outage", Tickets: 1},
+		{Tag: "#support", Tickets: 3, Resolved: 2, AverageResolutionSeconds: 3 * 3600},
+		{Tag: "@test1", Tickets: 1, Resolved: 1, AverageResolutionSeconds: 2 * 3600},
+	}
+
+	if reflect.DeepEqual(expected, got) == false {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+
+	if got[2].AverageResolution() != 3*time.Hour {
+		t.Errorf("Expected a 3 hour average, got %v", got[2].AverageResolution())
+	}
+}
+
+func TestNewTags(t *testing.T) {
+	got := NewTags(tagTickets(), Range{From: at("2014-01-03 00:00:00")})
+
+	expected := []NewTag{{Tag: "#outage", FirstSeen: "2014-01-06 10:00:00", Tickets: 1}}
+	if reflect.DeepEqual(expected, got) == false {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestFromSearch(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/account/1/search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"meta":{"total":2},"data":[{"id":1,"tags":["#a"]},{"id":2,"tags":["#a","#b"]}]}`)
+	})
+
+	d, err := FromSearch(client, 1, "tag:#a")
+	if err != nil {
+		t.Fatalf("Expected no error in FromSearch(), got %v", err)
+	}
+
+	if got := TagPairs(d.Tickets); len(got) != 1 || got[0].Tickets != 1 {
+		t.Errorf("Unexpected pairs %+v", got)
+	}
+}
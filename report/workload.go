@@ -0,0 +1,153 @@
+package report
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/sla"
+)
+
+// Workload is what one staff member did over a range
+type Workload struct {
+	StaffID  int    `json:"staff_id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+
+	// Replies counts public notes, PrivateNotes the rest
+	Replies      int `json:"replies"`
+	PrivateNotes int `json:"private_notes"`
+
+	// TicketsOpened counts tickets the staff member opened
+	TicketsOpened int `json:"tickets_opened"`
+
+	// Assigned counts open tickets tagged with "@username", which is how
+	// Snappy assigns tickets. It is a count as of now, not over the range
+	Assigned int `json:"assigned"`
+
+	// MedianReplySeconds is the median time from a customer writing in to
+	// this staff member answering
+	MedianReplySeconds int64 `json:"median_reply_seconds"`
+
+	WallPosts     int `json:"wall_posts"`
+	WallComments  int `json:"wall_comments"`
+	LikesGiven    int `json:"likes_given"`
+	LikesReceived int `json:"likes_received"`
+}
+
+// MedianReply returns MedianReplySeconds as a duration
+func (w Workload) MedianReply() time.Duration {
+	return time.Duration(w.MedianReplySeconds) * time.Second
+}
+
+// AssignedTo reports whether a ticket is tagged with "@username"
+func AssignedTo(t snappy.Ticket, username string) bool {
+	if username == "" {
+		return false
+	}
+	for _, tag := range t.Tags {
+		if strings.EqualFold(tag, "@"+username) {
+			return true
+		}
+	}
+	return false
+}
+
+// StaffWorkload reports the workload of every staff member over a range,
+// in the order of d.Staff
+func StaffWorkload(d *Data, r Range) []Workload {
+	byID := map[int]*Workload{}
+	byName := map[string]*Workload{}
+	replyTimes := map[int][]time.Duration{}
+
+	workloads := make([]Workload, len(d.Staff))
+	for i, e := range d.Staff {
+		w := &workloads[i]
+		w.StaffID = e.ID
+		w.Name = strings.TrimSpace(e.FirstName + " " + e.LastName)
+		w.Username = e.UserName
+
+		byID[e.ID] = w
+		for _, name := range []string{w.Name, e.UserName} {
+			if name != "" {
+				byName[strings.ToLower(name)] = w
+			}
+		}
+	}
+
+	for _, t := range d.Tickets {
+		if w := byID[t.OpenedByStaffID]; w != nil && r.Contains(time.Unix(int64(t.OpenedAt), 0)) {
+			w.TicketsOpened++
+		}
+
+		if t.Status != "closed" {
+			for i := range workloads {
+				if AssignedTo(t, workloads[i].Username) {
+					workloads[i].Assigned++
+				}
+			}
+		}
+
+		notes := append([]snappy.Note{}, d.Notes[t.ID]...)
+		sort.SliceStable(notes, func(i, j int) bool { return notes[i].CreatedAt < notes[j].CreatedAt })
+
+		// waiting is when the oldest customer note nobody has answered yet was written
+		var waiting time.Time
+
+		for _, n := range notes {
+			at := time.Unix(int64(n.CreatedAt), 0)
+
+			if n.CreatedByStaffID == 0 {
+				if waiting.IsZero() {
+					waiting = at
+				}
+				continue
+			}
+
+			if n.Scope == "private" {
+				if w := byID[n.CreatedByStaffID]; w != nil && r.Contains(at) {
+					w.PrivateNotes++
+				}
+				continue
+			}
+
+			if w := byID[n.CreatedByStaffID]; w != nil && r.Contains(at) {
+				w.Replies++
+				if !waiting.IsZero() {
+					replyTimes[n.CreatedByStaffID] = append(replyTimes[n.CreatedByStaffID], at.Sub(waiting))
+				}
+			}
+			waiting = time.Time{}
+		}
+	}
+
+	for _, p := range d.Wall {
+		at, _ := parseTime(p.CreatedAt)
+		if w := byID[p.StaffID]; w != nil && r.Contains(at) {
+			w.WallPosts++
+			w.LikesReceived += p.LikeCount
+		}
+
+		if r.Contains(at) {
+			for _, like := range p.Likes {
+				if w := byName[strings.ToLower(strings.TrimSpace(like))]; w != nil {
+					w.LikesGiven++
+				}
+			}
+		}
+
+		for _, c := range p.Comments {
+			cat, _ := parseTime(c.CreatedAt)
+			if w := byID[c.StaffID]; w != nil && r.Contains(cat) {
+				w.WallComments++
+			}
+		}
+	}
+
+	for i := range workloads {
+		workloads[i].MedianReplySeconds = int64(sla.Distribute(replyTimes[workloads[i].StaffID]).P50 / time.Second)
+	}
+
+	return workloads
+}
@@ -0,0 +1,87 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/derekpitt/snappy"
+)
+
+func unix(s string) int {
+	return int(at(s).Unix())
+}
+
+func TestStaffWorkload(t *testing.T) {
+	d := &Data{
+		Staff: []snappy.Employee{
+			snappy.Employee{ID: 5, FirstName: "Jane", LastName: "Doe", UserName: "jane"},
+			snappy.Employee{ID: 6, FirstName: "Joe", LastName: "Bloggs", UserName: "joe"},
+		},
+		Tickets: []snappy.Ticket{
+			snappy.Ticket{ID: 1, OpenedAt: unix("2014-01-02 09:00:00"), Tags: []string{"@Jane"}, Status: "waiting"},
+			snappy.Ticket{ID: 2, OpenedAt: unix("2014-01-02 10:00:00"), OpenedByStaffID: 6, Tags: []string{"@jane"}, Status: "closed"},
+			snappy.Ticket{ID: 3, OpenedAt: unix("2013-12-02 10:00:00"), OpenedByStaffID: 6, Tags: []string{"@joe"}},
+		},
+		Notes: map[int][]snappy.Note{
+			1: []snappy.Note{
+				snappy.Note{CreatedAt: unix("2014-01-02 11:00:00"), CreatedByStaffID: 5},
+				snappy.Note{CreatedAt: unix("2014-01-02 09:00:00"), CreatedByContactID: 9},
+				snappy.Note{CreatedAt: unix("2014-01-02 09:30:00"), CreatedByContactID: 9},
+				snappy.Note{CreatedAt: unix("2014-01-02 11:30:00"), CreatedByStaffID: 6, Scope: "private"},
+				snappy.Note{CreatedAt: unix("2014-01-02 12:00:00"), CreatedByContactID: 9},
+				snappy.Note{CreatedAt: unix("2014-01-02 13:00:00"), CreatedByStaffID: 5},
+				snappy.Note{CreatedAt: unix("2014-01-02 14:00:00"), CreatedByStaffID: 5},
+			},
+			3: []snappy.Note{
+				snappy.Note{CreatedAt: unix("2013-12-02 10:00:00"), CreatedByContactID: 9},
+				snappy.Note{CreatedAt: unix("2013-12-02 11:00:00"), CreatedByStaffID: 6},
+			},
+		},
+		Wall: []snappy.WallPost{
+			snappy.WallPost{
+				StaffID:   5,
+				CreatedAt: "2014-01-02 10:00:00",
+				Likes:     []string{"Joe Bloggs", "someone else"},
+				LikeCount: 2,
+				Comments: []snappy.WallComment{
+					snappy.WallComment{StaffID: 6, CreatedAt: "2014-01-02 10:05:00"},
+					snappy.WallComment{StaffID: 6, CreatedAt: "2014-02-02 10:05:00"},
+				},
+			},
+			snappy.WallPost{StaffID: 6, CreatedAt: "2013-12-02 10:00:00", Likes: []string{"jane"}, LikeCount: 1},
+		},
+	}
+
+	got := StaffWorkload(d, Range{From: at("2014-01-01 00:00:00"), To: at("2014-02-01 00:00:00")})
+
+	expected := []Workload{
+		{
+			StaffID:            5,
+			Name:               "Jane Doe",
+			Username:           "jane",
+			Replies:            3,
+			Assigned:           1,
+			MedianReplySeconds: 90 * 60,
+			WallPosts:          1,
+			LikesReceived:      2,
+		},
+		{
+			StaffID:       6,
+			Name:          "Joe Bloggs",
+			Username:      "joe",
+			PrivateNotes:  1,
+			TicketsOpened: 1,
+			Assigned:      1,
+			WallComments:  1,
+			LikesGiven:    1,
+		},
+	}
+
+	if reflect.DeepEqual(expected, got) == false {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+
+	if got[0].MedianReply().Minutes() != 90 {
+		t.Errorf("Expected a 90 minute median reply, got %v", got[0].MedianReply())
+	}
+}
@@ -0,0 +1,42 @@
+package rules
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Entry records an action taken on a ticket
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Rule     string    `json:"rule"`
+	TicketID int       `json:"ticket_id"`
+	Action   string    `json:"action"`
+	Detail   string    `json:"detail"`
+	DryRun   bool      `json:"dry_run"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Log is where an Engine records what it did
+type Log interface {
+	Record(e Entry) error
+}
+
+// JSONLog writes entries as JSON lines. It is safe for concurrent use
+type JSONLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONLog creates a JSONLog writing to w
+func NewJSONLog(w io.Writer) *JSONLog {
+	return &JSONLog{enc: json.NewEncoder(w)}
+}
+
+// Record writes an entry
+func (l *JSONLog) Record(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(e)
+}
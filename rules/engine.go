@@ -0,0 +1,368 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/calendar"
+	"github.com/derekpitt/snappy/internal/atomicfile"
+	"github.com/derekpitt/snappy/rules/expr"
+)
+
+// State is what an Engine remembers between runs
+type State struct {
+	// Fired holds the "rule/ticket/action" keys of the notes and wall posts
+	// already made, so polling the same ticket again doesn't repeat them
+	Fired map[string]bool `json:"fired"`
+}
+
+// LoadState reads a State from a file. A missing file is an empty State
+func LoadState(path string) (s *State, err error) {
+	s = &State{Fired: map[string]bool{}}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("rules: %s: %v", path, err)
+	}
+
+	if s.Fired == nil {
+		s.Fired = map[string]bool{}
+	}
+
+	return
+}
+
+// Save writes a State to a file, through a temporary file renamed into place
+func (s *State) Save(path string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(path, b, 0644)
+}
+
+// Engine evaluates rules over tickets and carries out their actions
+type Engine struct {
+	Client    *snappy.Snappy
+	AccountID int
+	Rules     []Rule
+
+	// DryRun records what would be done without doing it
+	DryRun bool
+
+	// Log receives an entry for every action, it may be nil
+	Log Log
+
+	// Calendar makes ticket ages count business hours only when set
+	Calendar *calendar.Calendar
+
+	// Now is time.Now unless set
+	Now func() time.Time
+
+	// State is loaded from StatePath when nil, and saved there after every
+	// note or wall post when StatePath is set
+	State     *State
+	StatePath string
+}
+
+// New creates an Engine, checking the rules first
+func New(client *snappy.Snappy, accountID int, rules []Rule) (*Engine, error) {
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Engine{
+		Client:    client,
+		AccountID: accountID,
+		Rules:     rules,
+	}, nil
+}
+
+func (e *Engine) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
+
+func (e *Engine) since(from, now time.Time) time.Duration {
+	if e.Calendar != nil {
+		return e.Calendar.Duration(from, now)
+	}
+	return now.Sub(from)
+}
+
+// env builds what conditions are matched against, fetching the ticket's
+// notes only when a rule's expression reads them
+func (e *Engine) env(t snappy.Ticket, now time.Time) (env expr.Env, err error) {
+	env.Ticket = t
+	env.Age = e.since(time.Unix(int64(t.OpenedAt), 0), now)
+
+	env.Wait = env.Age
+	if t.LastReplyAt != 0 {
+		env.Wait = e.since(time.Unix(int64(t.LastReplyAt), 0), now)
+	}
+
+	for _, r := range e.Rules {
+		if r.When.Expr == nil || !r.When.Expr.UsesNote() {
+			continue
+		}
+
+		notes, err := e.Client.TicketNotes(t.ID)
+		if err != nil {
+			return env, fmt.Errorf("rules: notes for ticket %d: %v", t.ID, err)
+		}
+
+		for _, n := range notes {
+			if n.CreatedAt > env.Note.CreatedAt || n.CreatedAt == env.Note.CreatedAt && n.ID > env.Note.ID {
+				env.Note = n
+			}
+		}
+		break
+	}
+
+	return
+}
+
+// Poll evaluates the rules over the inbox of each mailbox
+func (e *Engine) Poll(mailboxIDs ...int) (entries []Entry, err error) {
+	for _, id := range mailboxIDs {
+		tickets, err := e.Client.InboxAtMailbox(id)
+		if err != nil {
+			return entries, fmt.Errorf("rules: inbox of mailbox %d: %v", id, err)
+		}
+
+		for _, t := range tickets {
+			applied, err := e.Apply(t)
+			entries = append(entries, applied...)
+			if err != nil {
+				return entries, err
+			}
+		}
+	}
+
+	return
+}
+
+// Apply evaluates the rules over a single ticket. Later rules see the tags
+// earlier rules gave the ticket, and the tags are updated once at the end.
+// Actions that fail are recorded with their error and don't stop the rest;
+// the error returned is from fetching the ticket's notes, saving State or
+// the audit log
+func (e *Engine) Apply(t snappy.Ticket) (entries []Entry, err error) {
+	if err = e.loadState(); err != nil {
+		return
+	}
+
+	now := e.now()
+
+	env, err := e.env(t, now)
+	if err != nil {
+		return
+	}
+
+	working := t
+	working.Tags = append([]string{}, t.Tags...)
+
+	var saveErr error
+
+	record := func(rule string, a Action, detail string, actionErr error) {
+		entry := Entry{
+			Time:     now,
+			Rule:     rule,
+			TicketID: t.ID,
+			Action:   string(a.Kind),
+			Detail:   detail,
+			DryRun:   e.DryRun,
+		}
+		if actionErr != nil {
+			entry.Error = actionErr.Error()
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, r := range e.Rules {
+		env.Ticket = working
+		if !r.When.Match(env) {
+			continue
+		}
+
+		for i, a := range r.Then {
+			switch a.Kind {
+			case AddTags, RemoveTags, Assign:
+				before := strings.Join(working.Tags, " ")
+				working.Tags = changeTags(working.Tags, a)
+				if after := strings.Join(working.Tags, " "); after != before {
+					record(r.Name, a, tagDetail(a), nil)
+				}
+
+			case SetStatus:
+				record(r.Name, a, a.Status, fmt.Errorf("the snappy API can't change a ticket's status"))
+
+			case Note, WallPost:
+				key := fmt.Sprintf("%s/%d/%d", r.Name, t.ID, i)
+				if e.State.Fired[key] {
+					continue
+				}
+
+				message, err := a.message(working)
+				if err == nil && !e.DryRun {
+					if err = e.post(working, a, message); err == nil {
+						e.State.Fired[key] = true
+						if e.StatePath != "" && saveErr == nil {
+							saveErr = e.State.Save(e.StatePath)
+						}
+					}
+				}
+				record(r.Name, a, message, err)
+			}
+		}
+
+		if r.Stop {
+			break
+		}
+	}
+
+	if !sameTags(t.Tags, working.Tags) && !e.DryRun {
+		if err := e.Client.UpdateTags(t.ID, working.Tags...); err != nil {
+			for i := range entries {
+				if isTagAction(entries[i].Action) && entries[i].Error == "" {
+					entries[i].Error = err.Error()
+				}
+			}
+		}
+	}
+
+	if e.Log != nil {
+		for _, entry := range entries {
+			if err = e.Log.Record(entry); err != nil {
+				return
+			}
+		}
+	}
+
+	if saveErr != nil {
+		err = fmt.Errorf("rules: saving state: %v", saveErr)
+	}
+
+	return
+}
+
+// loadState loads State from StatePath the first time it is needed
+func (e *Engine) loadState() (err error) {
+	if e.State == nil {
+		e.State = &State{}
+		if e.StatePath != "" {
+			if e.State, err = LoadState(e.StatePath); err != nil {
+				return
+			}
+		}
+	}
+
+	if e.State.Fired == nil {
+		e.State.Fired = map[string]bool{}
+	}
+
+	return
+}
+
+func (e *Engine) post(t snappy.Ticket, a Action, message string) error {
+	post := snappy.NewWallPost{
+		Content: message,
+		Type:    "post",
+		Tags:    a.Tags,
+	}
+
+	if a.Kind == Note {
+		post.TicketID = t.ID
+	}
+
+	return e.Client.CreateWallPost(e.AccountID, post)
+}
+
+func isTagAction(kind string) bool {
+	switch Kind(kind) {
+	case AddTags, RemoveTags, Assign:
+		return true
+	}
+	return false
+}
+
+func tagDetail(a Action) string {
+	switch a.Kind {
+	case AddTags:
+		return "+" + strings.Join(a.Tags, " +")
+	case RemoveTags:
+		return "-" + strings.Join(a.Tags, " -")
+	}
+	return "@" + strings.TrimPrefix(a.Staff, "@")
+}
+
+// changeTags applies a tag action to a list of tags
+func changeTags(tags []string, a Action) []string {
+	result := append([]string{}, tags...)
+
+	remove := func(match func(string) bool) {
+		kept := result[:0]
+		for _, t := range result {
+			if !match(t) {
+				kept = append(kept, t)
+			}
+		}
+		result = kept
+	}
+
+	add := func(tag string) {
+		for _, t := range result {
+			if strings.EqualFold(t, tag) {
+				return
+			}
+		}
+		result = append(result, tag)
+	}
+
+	switch a.Kind {
+	case AddTags:
+		for _, tag := range a.Tags {
+			add(tag)
+		}
+	case RemoveTags:
+		for _, tag := range a.Tags {
+			remove(func(t string) bool { return strings.EqualFold(t, tag) })
+		}
+	case Assign:
+		staff := "@" + strings.TrimPrefix(a.Staff, "@")
+		remove(func(t string) bool { return strings.HasPrefix(t, "@") && !strings.EqualFold(t, staff) })
+		add(staff)
+	}
+
+	return result
+}
+
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
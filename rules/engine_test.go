@@ -0,0 +1,274 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/rules/expr"
+)
+
+var (
+	mux    *http.ServeMux
+	server *httptest.Server
+	client *snappy.Snappy
+)
+
+func setup() {
+	mux = http.NewServeMux()
+	server = httptest.NewServer(mux)
+
+	client = snappy.WithAPIKey("apikey")
+	client.SetEndpointPrefix(server.URL)
+}
+
+func teardown() {
+	server.Close()
+}
+
+var now = time.Date(2014, 1, 2, 12, 0, 0, 0, time.UTC)
+
+func testRules() []Rule {
+	return []Rule{
+		{
+			Name: "billing",
+			When: Condition{Summary: regexp.MustCompile(`(?i)invoice|charged`)},
+			Then: []Action{
+				{Kind: AddTags, Tags: []string{"#billing"}},
+				{Kind: Assign, Staff: "test1"},
+			},
+		},
+		{
+			Name: "billing escalation",
+			When: Condition{HasTags: []string{"#billing"}, MinAge: time.Hour},
+			Then: []Action{
+				{Kind: Note, Message: "Ticket {{.ID}} has waited over an hour"},
+				{Kind: SetStatus, Status: "waiting"},
+			},
+			Stop: true,
+		},
+		{
+			Name: "never reached",
+			Then: []Action{{Kind: AddTags, Tags: []string{"#other"}}},
+		},
+	}
+}
+
+func TestPoll(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var tags []string
+	var posts []snappy.NewWallPost
+
+	mux.HandleFunc("/mailbox/2/inbox", func(w http.ResponseWriter, r *http.Request) {
+		opened := now.Add(-2 * time.Hour).Unix()
+		fmt.Fprintf(w, `[{"id":7,"summary":"I was charged twice","opened_at":%d,"tags":["@someone"]}]`, opened)
+	})
+	mux.HandleFunc("/ticket/7/tags", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		json.Unmarshal([]byte(r.PostForm.Get("tags")), &tags)
+	})
+	mux.HandleFunc("/account/1/wall", func(w http.ResponseWriter, r *http.Request) {
+		var p snappy.NewWallPost
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &p)
+		posts = append(posts, p)
+	})
+
+	engine, err := New(client, 1, testRules())
+	if err != nil {
+		t.Fatalf("Expected no error in New(), got %v", err)
+	}
+
+	var log bytes.Buffer
+	engine.Log = NewJSONLog(&log)
+	engine.Now = func() time.Time { return now }
+
+	entries, err := engine.Poll(2)
+	if err != nil {
+		t.Fatalf("Expected no error in Poll(), got %v", err)
+	}
+
+	if expected := []string{"#billing", "@test1"}; reflect.DeepEqual(expected, tags) == false {
+		t.Errorf("Expected tags %v, got %v", expected, tags)
+	}
+
+	if len(posts) != 1 || posts[0].TicketID != 7 || posts[0].Content != "Ticket 7 has waited over an hour" {
+		t.Errorf("Unexpected wall posts %+v", posts)
+	}
+
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Rule+":"+e.Action)
+	}
+	expected := []string{"billing:add_tags", "billing:assign", "billing escalation:note", "billing escalation:status"}
+	if reflect.DeepEqual(expected, actions) == false {
+		t.Errorf("Expected entries %v, got %v", expected, actions)
+	}
+
+	if entries[3].Error == "" {
+		t.Errorf("Expected the status change to be recorded as failed")
+	}
+
+	if lines := strings.Count(log.String(), "\n"); lines != 4 {
+		t.Errorf("Expected 4 lines in the audit log, got %d: %s", lines, log.String())
+	}
+
+	// polling again doesn't repeat the note
+	if _, err := engine.Poll(2); err != nil {
+		t.Fatalf("Expected no error in Poll(), got %v", err)
+	}
+	if len(posts) != 1 {
+		t.Errorf("Expected the note not to be posted twice, got %d posts", len(posts))
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			t.Errorf("Expected no changes in a dry run, got %s %s", r.Method, r.URL.Path)
+		}
+	})
+
+	engine, _ := New(client, 1, testRules())
+	engine.DryRun = true
+	engine.Now = func() time.Time { return now }
+
+	entries, err := engine.Apply(snappy.Ticket{ID: 7, Summary: "about my invoice", OpenedAt: int(now.Add(-2 * time.Hour).Unix())})
+	if err != nil {
+		t.Fatalf("Expected no error in Apply(), got %v", err)
+	}
+
+	if len(entries) != 4 || !entries[0].DryRun || entries[2].Detail != "Ticket 7 has waited over an hour" {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+}
+
+func TestUpdateTagsFailure(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/ticket/7/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	engine, _ := New(client, 1, testRules()[:1])
+
+	entries, err := engine.Apply(snappy.Ticket{ID: 7, Summary: "invoice"})
+	if err != nil {
+		t.Fatalf("Expected no error in Apply(), got %v", err)
+	}
+
+	for _, e := range entries {
+		if e.Error == "" {
+			t.Errorf("Expected the failed tag update on every tag entry, got %+v", e)
+		}
+	}
+
+}
+
+func TestApplyNoteExpr(t *testing.T) {
+	setup()
+	defer teardown()
+
+	fetched := 0
+	mux.HandleFunc("/ticket/7/notes", func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		fmt.Fprint(w, `[{"id":2,"created_at":20,"content":"please cancel"},{"id":1,"created_at":10,"content":"hello"}]`)
+	})
+
+	rules := []Rule{{
+		Name: "cancel",
+		When: Condition{Expr: expr.MustCompile(`"cancel" in note.content && wait > 1h`)},
+		Then: []Action{{Kind: AddTags, Tags: []string{"#cancel"}}},
+	}}
+
+	engine, err := New(client, 1, rules)
+	if err != nil {
+		t.Fatalf("Expected no error in New(), got %v", err)
+	}
+	engine.DryRun = true
+	engine.Now = func() time.Time { return now }
+
+	ticket := snappy.Ticket{ID: 7, LastReplyAt: int(now.Add(-2 * time.Hour).Unix())}
+	entries, err := engine.Apply(ticket)
+	if err != nil {
+		t.Fatalf("Expected no error in Apply(), got %v", err)
+	}
+
+	if fetched != 1 || len(entries) != 1 || entries[0].Detail != "+#cancel" {
+		t.Errorf("Expected the notes to be fetched once and the rule to fire, got %d fetches and %+v", fetched, entries)
+	}
+
+	// rules that don't read the note don't fetch them
+	engine.Rules[0].When.Expr = expr.MustCompile(`wait > 1h`)
+	if _, err := engine.Apply(ticket); err != nil {
+		t.Fatalf("Expected no error in Apply(), got %v", err)
+	}
+	if fetched != 1 {
+		t.Errorf("Expected the notes not to be fetched again, got %d fetches", fetched)
+	}
+}
+
+func TestPollState(t *testing.T) {
+	setup()
+	defer teardown()
+
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var posts []snappy.NewWallPost
+
+	mux.HandleFunc("/mailbox/2/inbox", func(w http.ResponseWriter, r *http.Request) {
+		opened := now.Add(-2 * time.Hour).Unix()
+		fmt.Fprintf(w, `[{"id":7,"summary":"I was charged twice","opened_at":%d,"tags":["#billing","@test1"]}]`, opened)
+	})
+	mux.HandleFunc("/account/1/wall", func(w http.ResponseWriter, r *http.Request) {
+		var p snappy.NewWallPost
+		json.NewDecoder(r.Body).Decode(&p)
+		posts = append(posts, p)
+	})
+
+	statePath := filepath.Join(dir, "state.json")
+
+	// each Engine is a separate run of the CLI
+	for run := 0; run < 2; run++ {
+		engine, _ := New(client, 1, testRules())
+		engine.StatePath = statePath
+		engine.Now = func() time.Time { return now }
+
+		if _, err := engine.Poll(2); err != nil {
+			t.Fatalf("Expected no error in Poll(), got %v", err)
+		}
+	}
+
+	if len(posts) != 1 {
+		t.Errorf("Expected the note to be posted once across runs, got %d posts", len(posts))
+	}
+
+	state, err := LoadState(statePath)
+	if err != nil {
+		t.Fatalf("Expected no error in LoadState(), got %v", err)
+	}
+	if expected := map[string]bool{"billing escalation/7/0": true}; reflect.DeepEqual(expected, state.Fired) == false {
+		t.Errorf("Expected fired %v, got %v", expected, state.Fired)
+	}
+}
@@ -0,0 +1,485 @@
+package expr
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+type kind int
+
+const (
+	boolType kind = iota
+	intType
+	stringType
+	durationType
+	listType
+	objectType
+)
+
+type typ struct {
+	kind kind
+	rt   reflect.Type // of an objectType
+}
+
+func (t typ) String() string {
+	switch t.kind {
+	case boolType:
+		return "boolean"
+	case intType:
+		return "number"
+	case stringType:
+		return "string"
+	case durationType:
+		return "duration"
+	case listType:
+		return "list"
+	}
+	return strings.ToLower(t.rt.Name())
+}
+
+type compiled struct {
+	typ  typ
+	eval func(*Env) interface{}
+}
+
+// roots are the names an expression starts from
+var roots = map[string]struct {
+	typ typ
+	get func(*Env) interface{}
+}{
+	"ticket": {typ{kind: objectType, rt: reflect.TypeOf(snappy.Ticket{})}, func(e *Env) interface{} { return reflect.ValueOf(e.Ticket) }},
+	"note":   {typ{kind: objectType, rt: reflect.TypeOf(snappy.Note{})}, func(e *Env) interface{} { return reflect.ValueOf(e.Note) }},
+	"age":    {typ{kind: durationType}, func(e *Env) interface{} { return e.Age }},
+	"wait":   {typ{kind: durationType}, func(e *Env) interface{} { return e.Wait }},
+}
+
+// aliases are shorter names for fields, by the type they are on
+var aliases = map[reflect.Type]map[string]string{
+	reflect.TypeOf(snappy.Ticket{}): {"subject": "default_subject"},
+}
+
+type compiler struct {
+	src      string
+	usesNote bool
+}
+
+func (c *compiler) compile(n *node) (compiled, error) {
+	switch n.kind {
+	case stringNode:
+		v := n.str
+		return compiled{typ{kind: stringType}, func(*Env) interface{} { return v }}, nil
+
+	case intNode:
+		v := n.num
+		return compiled{typ{kind: intType}, func(*Env) interface{} { return v }}, nil
+
+	case durationNode:
+		v := n.dur
+		return compiled{typ{kind: durationType}, func(*Env) interface{} { return v }}, nil
+
+	case boolNode:
+		v := n.bool
+		return compiled{typ{kind: boolType}, func(*Env) interface{} { return v }}, nil
+
+	case listNode:
+		return c.list(n)
+
+	case pathNode:
+		return c.path(n)
+
+	case callNode:
+		return c.call(n)
+
+	case notNode:
+		operand, err := c.expect(n.children[0], boolType, "! needs a boolean")
+		if err != nil {
+			return compiled{}, err
+		}
+		return compiled{typ{kind: boolType}, func(e *Env) interface{} { return !operand.eval(e).(bool) }}, nil
+	}
+
+	return c.binary(n)
+}
+
+// expect compiles n and checks it is of kind k
+func (c *compiler) expect(n *node, k kind, why string) (compiled, error) {
+	result, err := c.compile(n)
+	if err != nil {
+		return compiled{}, err
+	}
+	if result.typ.kind != k {
+		return compiled{}, errorAt(c.src, n.pos, "%s, not a %s", why, result.typ)
+	}
+	return result, nil
+}
+
+func (c *compiler) list(n *node) (compiled, error) {
+	items := make([]compiled, len(n.children))
+	for i, child := range n.children {
+		item, err := c.expect(child, stringType, "lists can only hold strings")
+		if err != nil {
+			return compiled{}, err
+		}
+		items[i] = item
+	}
+
+	return compiled{typ{kind: listType}, func(e *Env) interface{} {
+		values := make([]string, len(items))
+		for i, item := range items {
+			values[i] = item.eval(e).(string)
+		}
+		return values
+	}}, nil
+}
+
+func (c *compiler) path(n *node) (compiled, error) {
+	root, ok := roots[n.path[0]]
+	if !ok {
+		return compiled{}, errorAt(c.src, n.pos, "unknown name %q%s, expected ticket, note, age or wait", n.path[0], suggest(n.path[0], []string{"ticket", "note", "age", "wait"}))
+	}
+
+	if n.path[0] == "note" {
+		c.usesNote = true
+	}
+
+	t := root.typ
+	var index []int
+
+	for i, name := range n.path[1:] {
+		pos := n.pathPos[i+1]
+		if t.kind != objectType {
+			return compiled{}, errorAt(c.src, pos, "%s is a %s, it has no field %q", strings.Join(n.path[:i+1], "."), t, name)
+		}
+
+		field, ok := fieldByName(t.rt, name)
+		if !ok {
+			return compiled{}, errorAt(c.src, pos, "%s has no field %q%s", strings.Join(n.path[:i+1], "."), name, suggest(name, fieldNames(t.rt)))
+		}
+
+		ft, ok := typeOf(field.Type)
+		if !ok {
+			return compiled{}, errorAt(c.src, pos, "%s can't be used in expressions", strings.Join(n.path[:i+2], "."))
+		}
+
+		index = append(index, field.Index...)
+		t = ft
+	}
+
+	if t.kind == objectType {
+		return compiled{}, errorAt(c.src, n.pos, "%s is a %s, pick one of its fields, e.g. %s.%s", strings.Join(n.path, "."), t, strings.Join(n.path, "."), fieldNames(t.rt)[0])
+	}
+
+	if index == nil {
+		return compiled{t, root.get}, nil
+	}
+
+	get := root.get
+	return compiled{t, func(e *Env) interface{} {
+		v := get(e).(reflect.Value).FieldByIndex(index)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int64:
+			return v.Int()
+		case reflect.String:
+			return v.String()
+		case reflect.Bool:
+			return v.Bool()
+		}
+		return v.Interface()
+	}}, nil
+}
+
+// typeOf maps a field's Go type to the type it has in expressions
+func typeOf(rt reflect.Type) (typ, bool) {
+	switch rt.Kind() {
+	case reflect.Int, reflect.Int64:
+		return typ{kind: intType}, true
+	case reflect.String:
+		return typ{kind: stringType}, true
+	case reflect.Bool:
+		return typ{kind: boolType}, true
+	case reflect.Slice:
+		if rt.Elem().Kind() == reflect.String {
+			return typ{kind: listType}, true
+		}
+	case reflect.Struct:
+		return typ{kind: objectType, rt: rt}, true
+	}
+	return typ{}, false
+}
+
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return ""
+	}
+	return name
+}
+
+func fieldByName(rt reflect.Type, name string) (reflect.StructField, bool) {
+	if alias, ok := aliases[rt][name]; ok {
+		name = alias
+	}
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if jsonName(f) == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// fieldNames lists the names expressions can use for the fields of rt
+func fieldNames(rt reflect.Type) (names []string) {
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if _, ok := typeOf(f.Type); ok && jsonName(f) != "" {
+			names = append(names, jsonName(f))
+		}
+	}
+	for alias := range aliases[rt] {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	return
+}
+
+var functions = map[string]struct {
+	arg    []kind // the kinds the argument may be
+	result kind
+	fn     func(interface{}) interface{}
+}{
+	"lower":  {[]kind{stringType}, stringType, func(v interface{}) interface{} { return strings.ToLower(v.(string)) }},
+	"upper":  {[]kind{stringType}, stringType, func(v interface{}) interface{} { return strings.ToUpper(v.(string)) }},
+	"domain": {[]kind{stringType}, stringType, func(v interface{}) interface{} { return domain(v.(string)) }},
+	"len": {[]kind{listType, stringType}, intType, func(v interface{}) interface{} {
+		if list, ok := v.([]string); ok {
+			return int64(len(list))
+		}
+		return int64(len([]rune(v.(string))))
+	}},
+}
+
+func (c *compiler) call(n *node) (compiled, error) {
+	f, ok := functions[n.name]
+	if !ok {
+		return compiled{}, errorAt(c.src, n.pos, "unknown function %q%s, expected lower, upper, domain or len", n.name, suggest(n.name, []string{"lower", "upper", "domain", "len"}))
+	}
+
+	if len(n.children) != 1 {
+		return compiled{}, errorAt(c.src, n.pos, "%s takes 1 argument, not %d", n.name, len(n.children))
+	}
+
+	arg, err := c.compile(n.children[0])
+	if err != nil {
+		return compiled{}, err
+	}
+
+	accepted := false
+	var names []string
+	for _, k := range f.arg {
+		accepted = accepted || arg.typ.kind == k
+		names = append(names, typ{kind: k}.String())
+	}
+	if !accepted {
+		return compiled{}, errorAt(c.src, n.children[0].pos, "%s needs a %s, not a %s", n.name, strings.Join(names, " or "), arg.typ)
+	}
+
+	fn := f.fn
+	return compiled{typ{kind: f.result}, func(e *Env) interface{} { return fn(arg.eval(e)) }}, nil
+}
+
+func (c *compiler) binary(n *node) (compiled, error) {
+	switch n.op {
+	case "&&", "||":
+		left, err := c.expect(n.children[0], boolType, n.op+" needs booleans")
+		if err != nil {
+			return compiled{}, err
+		}
+		right, err := c.expect(n.children[1], boolType, n.op+" needs booleans")
+		if err != nil {
+			return compiled{}, err
+		}
+
+		if n.op == "&&" {
+			return compiled{typ{kind: boolType}, func(e *Env) interface{} { return left.eval(e).(bool) && right.eval(e).(bool) }}, nil
+		}
+		return compiled{typ{kind: boolType}, func(e *Env) interface{} { return left.eval(e).(bool) || right.eval(e).(bool) }}, nil
+
+	case "matches":
+		left, err := c.expect(n.children[0], stringType, "matches needs a string on its left")
+		if err != nil {
+			return compiled{}, err
+		}
+
+		pattern := n.children[1]
+		if pattern.kind != stringNode {
+			return compiled{}, errorAt(c.src, pattern.pos, "matches needs a regular expression in quotes on its right")
+		}
+		re, err := regexp.Compile(pattern.str)
+		if err != nil {
+			return compiled{}, errorAt(c.src, pattern.pos, "bad regular expression: %v", err)
+		}
+
+		return compiled{typ{kind: boolType}, func(e *Env) interface{} { return re.MatchString(left.eval(e).(string)) }}, nil
+
+	case "in", "not in":
+		left, err := c.expect(n.children[0], stringType, n.op+" needs a string on its left")
+		if err != nil {
+			return compiled{}, err
+		}
+		right, err := c.compile(n.children[1])
+		if err != nil {
+			return compiled{}, err
+		}
+		if right.typ.kind != listType && right.typ.kind != stringType {
+			return compiled{}, errorAt(c.src, n.children[1].pos, "%s needs a list or a string on its right, not a %s", n.op, right.typ)
+		}
+
+		negate := n.op == "not in"
+		return compiled{typ{kind: boolType}, func(e *Env) interface{} {
+			return contains(right.eval(e), left.eval(e).(string)) != negate
+		}}, nil
+	}
+
+	left, err := c.compile(n.children[0])
+	if err != nil {
+		return compiled{}, err
+	}
+	right, err := c.compile(n.children[1])
+	if err != nil {
+		return compiled{}, err
+	}
+
+	if left.typ.kind != right.typ.kind {
+		return compiled{}, errorAt(c.src, n.opPos, "can't compare a %s with a %s", left.typ, right.typ)
+	}
+
+	ordered := n.op != "==" && n.op != "!="
+	switch left.typ.kind {
+	case intType, durationType, stringType:
+	case boolType:
+		if ordered {
+			return compiled{}, errorAt(c.src, n.opPos, "booleans can only be compared with == and !=")
+		}
+	default:
+		return compiled{}, errorAt(c.src, n.opPos, "can't compare lists, use in instead")
+	}
+
+	op := n.op
+	return compiled{typ{kind: boolType}, func(e *Env) interface{} {
+		return compare(op, left.eval(e), right.eval(e))
+	}}, nil
+}
+
+// contains reports whether s is in a list or a string, ignoring case
+func contains(in interface{}, s string) bool {
+	if list, ok := in.([]string); ok {
+		for _, v := range list {
+			if strings.EqualFold(v, s) {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.Contains(strings.ToLower(in.(string)), strings.ToLower(s))
+}
+
+func compare(op string, a, b interface{}) bool {
+	var cmp int
+
+	switch a := a.(type) {
+	case bool:
+		if op == "==" {
+			return a == b.(bool)
+		}
+		return a != b.(bool)
+	case string:
+		cmp = strings.Compare(a, b.(string))
+	case int64:
+		cmp = sign(a - b.(int64))
+	case time.Duration:
+		cmp = sign(int64(a - b.(time.Duration)))
+	}
+
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+func sign(n int64) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// domain returns the lowercased domain of an address
+func domain(address string) string {
+	i := strings.LastIndex(address, "@")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(address[i+1:]))
+}
+
+// suggest returns a "did you mean" hint for a misspelt name
+func suggest(name string, names []string) string {
+	best, bestDistance := "", 3
+	for _, n := range names {
+		if d := distance(name, n); d < bestDistance {
+			best, bestDistance = n, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return ` (did you mean "` + best + `"?)`
+}
+
+// distance is the Levenshtein distance between two names
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = cur[j-1] + 1
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,137 @@
+// Package expr is a small, safe expression language for rule conditions,
+// e.g.
+//
+//	ticket.status == "waiting" && "#billing" in ticket.tags && age > 4h
+//
+// Expressions are compiled once and type checked against the fields of the
+// Ticket, Contact and Note types, named by their json tags, so a typo or a
+// comparison between a string and a duration is reported with its line and
+// column before any ticket is looked at. Compiled expressions can only read
+// the environment they are evaluated in; they can't loop or call out.
+//
+// The names an expression can use are:
+//
+//	ticket   the ticket, e.g. ticket.subject, ticket.opener.address, ticket.mailbox.id
+//	note     the ticket's latest note, e.g. note.content, note.creator.address
+//	age      how long ago the ticket was opened
+//	wait     how long ago the ticket was last replied to
+//
+// ticket.subject is short for ticket.default_subject. Values are strings,
+// whole numbers, booleans, durations (30s, 15m, 4h, 2d, 1w or 1h30m) and
+// lists of strings, written ["a", "b"]. The operators are, loosest first:
+//
+//	||                         either is true
+//	&&                         both are true
+//	!                          not
+//	== != < <= > >=            compare strings, numbers and durations
+//	in, not in                 a string in a list or within a string, ignoring case
+//	matches                    a string matches a regular expression literal
+//
+// and the functions lower(s), upper(s), domain(address) and len(list or
+// string).
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+// Env is what an expression is evaluated against
+type Env struct {
+	Ticket snappy.Ticket
+
+	// Note is the ticket's latest note, the zero Note when it has none
+	Note snappy.Note
+
+	Age  time.Duration
+	Wait time.Duration
+}
+
+// Error is a compile error at a position in the source
+type Error struct {
+	// Offset is the byte offset of the error, Line and Column count from 1
+	Offset int
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+func errorAt(src string, offset int, format string, args ...interface{}) *Error {
+	before := src[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := len([]rune(before[strings.LastIndex(before, "\n")+1:])) + 1
+
+	return &Error{
+		Offset: offset,
+		Line:   line,
+		Column: column,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+// Program is a compiled expression
+type Program struct {
+	src      string
+	eval     func(*Env) interface{}
+	usesNote bool
+}
+
+// Compile parses and type checks an expression, which has to be true or
+// false. Errors are *Error
+func Compile(src string) (*Program, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{src: src, tokens: tokens}
+	n, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compiler{src: src}
+	compiled, err := c.compile(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if compiled.typ.kind != boolType {
+		return nil, errorAt(src, n.pos, "expression is a %s, it has to be true or false", compiled.typ)
+	}
+
+	return &Program{src: src, eval: compiled.eval, usesNote: c.usesNote}, nil
+}
+
+// MustCompile is Compile that panics on an error, for expressions known to
+// be good
+func MustCompile(src string) *Program {
+	p, err := Compile(src)
+	if err != nil {
+		panic("expr: " + src + ": " + err.Error())
+	}
+	return p
+}
+
+// Eval evaluates the expression in env
+func (p *Program) Eval(env Env) bool {
+	return p.eval(&env).(bool)
+}
+
+// UsesNote reports whether the expression reads the note, so callers can
+// skip fetching notes when it doesn't
+func (p *Program) UsesNote() bool {
+	return p.usesNote
+}
+
+// String returns the source of the expression
+func (p *Program) String() string {
+	return p.src
+}
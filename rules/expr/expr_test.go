@@ -0,0 +1,122 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+var env = Env{
+	Ticket: snappy.Ticket{
+		ID:             7,
+		MailboxID:      2,
+		Status:         "waiting",
+		DefaultSubject: "Invoice #123 is wrong",
+		Tags:           []string{"#Billing", "@test1"},
+		Unread:         true,
+		Opener:         snappy.Contact{FirstName: "Sam", Address: "sam@Mail.Example.com"},
+		Mailbox:        snappy.Mailbox{ID: 2, Address: "help@example.com"},
+	},
+	Note: snappy.Note{Scope: "public", Content: "Any news on this?", Creator: snappy.Contact{Address: "sam@mail.example.com"}},
+	Age:  5 * time.Hour,
+	Wait: 90 * time.Minute,
+}
+
+func TestEval(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected bool
+	}{
+		{`ticket.status == "waiting" && "#billing" in ticket.tags && age > 4h`, true},
+		{`ticket.status != "waiting"`, false},
+		{`"#refund" not in ticket.tags`, true},
+		{`ticket.subject matches "(?i)^invoice"`, true},
+		{`ticket.default_subject matches "refund"`, false},
+		{`domain(ticket.opener.address) == "mail.example.com"`, true},
+		{`"example.com" in ticket.opener.address`, true},
+		{`lower(ticket.opener.first_name) in ["sam", "alex"]`, true},
+		{`ticket.mailbox.id == 2 && ticket.id >= 7 && ticket.id < 8`, true},
+		{`ticket.unread && !(wait < 1h)`, true},
+		{`wait > 1h30m`, false},
+		{`age <= 1d || false`, true},
+		{`len(ticket.tags) == 2 && len("abc") == 3`, true},
+		{`note.scope == "public" && "news" in note.content`, true},
+		{`upper(note.creator.address) == "SAM@MAIL.EXAMPLE.COM"`, true},
+		{`"a" in []`, false},
+		{"ticket.status == \"waiting\"\n  && age > 2w", false},
+	}
+
+	for _, c := range cases {
+		p, err := Compile(c.src)
+		if err != nil {
+			t.Errorf("Expected no error in Compile(%q), got %v", c.src, err)
+			continue
+		}
+
+		if got := p.Eval(env); got != c.expected {
+			t.Errorf("%s: expected %v, got %v", c.src, c.expected, got)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	cases := []struct {
+		src      string
+		position string
+		message  string
+	}{
+		{``, "1:1", "empty expression"},
+		{`ticket.statu == "new"`, "1:8", `ticket has no field "statu" (did you mean "status"?)`},
+		{`tciket.status == "new"`, "1:1", `unknown name "tciket"`},
+		{`ticket.status == 4h`, "1:15", "can't compare a string with a duration"},
+		{`age > 4`, "1:5", "can't compare a duration with a number"},
+		{`ticket.status = "new"`, "1:15", `did you mean "=="?`},
+		{`ticket.status == "new`, "1:18", "unterminated string"},
+		{`ticket.opener == "x"`, "1:1", "ticket.opener is a contact, pick one of its fields"},
+		{`ticket.contacts == "x"`, "1:8", "ticket.contacts can't be used"},
+		{`ticket.status`, "1:1", "expression is a string"},
+		{`ticket.subject matches "("`, "1:24", "bad regular expression"},
+		{`ticket.id in ticket.tags`, "1:1", "in needs a string on its left"},
+		{`age > 4x`, "1:7", `bad number or duration "4x"`},
+		{`age > 1h && (ticket.unread`, "1:27", `unexpected end of expression, expected ")"`},
+		{`1 < 2 < 3`, "1:7", "can't be chained"},
+		{`ticket.unread && shout(ticket.status)`, "1:18", `unknown function "shout"`},
+		{`len(age) > 1`, "1:5", "len needs a list or string, not a duration"},
+		{`ticket.tags == ["a"]`, "1:13", "can't compare lists"},
+		{"ticket.unread &&\n  ticket.id in 3", "2:3", "in needs a string"},
+		{`ticket.unread ticket.id`, "1:15", "expected &&, || or the end of the expression"},
+		{`ticket.status not "x"`, "1:19", "expected in after not"},
+	}
+
+	for _, c := range cases {
+		_, err := Compile(c.src)
+		if err == nil {
+			t.Errorf("Expected an error compiling %q", c.src)
+			continue
+		}
+
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%s: expected an *Error, got %T", c.src, err)
+			continue
+		}
+
+		if position := strings.SplitN(e.Error(), ": ", 2)[0]; position != c.position {
+			t.Errorf("%s: expected the error at %s, got %v", c.src, c.position, err)
+		}
+		if !strings.Contains(e.Msg, c.message) {
+			t.Errorf("%s: expected the error to contain %q, got %q", c.src, c.message, e.Msg)
+		}
+	}
+}
+
+func TestUsesNote(t *testing.T) {
+	if MustCompile(`age > 1h`).UsesNote() {
+		t.Errorf("Expected an expression without note not to use it")
+	}
+	if !MustCompile(`age > 1h || note.scope == "private"`).UsesNote() {
+		t.Errorf("Expected an expression with note to use it")
+	}
+}
@@ -0,0 +1,194 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokInt
+	tokDuration
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBrack
+	tokRBrack
+	tokComma
+	tokDot
+)
+
+type token struct {
+	kind tokenKind
+	pos  int
+	text string
+
+	// the value of string, int and duration literals
+	str string
+	num int64
+	dur time.Duration
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.str)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators, longest first so "<=" wins over "<"
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!"}
+
+// durationUnits are the units a duration literal can use
+var durationUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(src); {
+		c := src[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+
+		case c == '"':
+			start := i
+			i++
+			var b strings.Builder
+			for {
+				if i >= len(src) || src[i] == '\n' {
+					return nil, errorAt(src, start, "unterminated string")
+				}
+				if src[i] == '"' {
+					i++
+					break
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					switch src[i+1] {
+					case '"', '\\':
+						b.WriteByte(src[i+1])
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						return nil, errorAt(src, i, "unknown escape \\%c", src[i+1])
+					}
+					i += 2
+					continue
+				}
+				b.WriteByte(src[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokString, pos: start, text: src[start:i], str: b.String()})
+			continue
+
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(src) && (isDigit(src[i]) || isLetter(src[i])) {
+				i++
+			}
+			t, err := number(src, start, src[start:i])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, t)
+			continue
+
+		case isLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i]) || src[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, pos: start, text: src[start:i]})
+			continue
+		}
+
+		single := map[byte]tokenKind{'(': tokLParen, ')': tokRParen, '[': tokLBrack, ']': tokRBrack, ',': tokComma, '.': tokDot}
+		if kind, ok := single[c]; ok {
+			tokens = append(tokens, token{kind: kind, pos: i, text: string(c)})
+			i++
+			continue
+		}
+
+		matched := false
+		for _, op := range operators {
+			if strings.HasPrefix(src[i:], op) {
+				tokens = append(tokens, token{kind: tokOp, pos: i, text: op})
+				i += len(op)
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			r := []rune(src[i:])[0]
+			if c == '=' {
+				return nil, errorAt(src, i, "unexpected \"=\", did you mean \"==\"?")
+			}
+			if unicode.IsPrint(r) {
+				return nil, errorAt(src, i, "unexpected %q", r)
+			}
+			return nil, errorAt(src, i, "unexpected character %U", r)
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// number turns "42" into an int and "1h30m" or "2d" into a duration
+func number(src string, pos int, text string) (token, error) {
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return token{kind: tokInt, pos: pos, text: text, num: n}, nil
+	}
+
+	var total time.Duration
+	rest := text
+	for rest != "" {
+		digits := 0
+		for digits < len(rest) && isDigit(rest[digits]) {
+			digits++
+		}
+		letters := digits
+		for letters < len(rest) && isLetter(rest[letters]) {
+			letters++
+		}
+
+		n, err := strconv.ParseInt(rest[:digits], 10, 64)
+		unit, ok := durationUnits[rest[digits:letters]]
+		if err != nil || !ok {
+			return token{}, errorAt(src, pos, "bad number or duration %q, durations look like 30m, 4h or 2d", text)
+		}
+
+		total += time.Duration(n) * unit
+		rest = rest[letters:]
+	}
+
+	return token{kind: tokDuration, pos: pos, text: text, dur: total}, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,286 @@
+package expr
+
+import "time"
+
+type nodeKind int
+
+const (
+	stringNode nodeKind = iota
+	intNode
+	durationNode
+	boolNode
+	listNode
+	pathNode
+	callNode
+	notNode
+	binaryNode
+)
+
+type node struct {
+	kind nodeKind
+	pos  int
+
+	str  string
+	num  int64
+	dur  time.Duration
+	bool bool
+
+	// path is the dotted names of a pathNode, with their positions
+	path     []string
+	pathPos  []int
+	name     string // of a callNode
+	op       string // of a binaryNode
+	opPos    int
+	children []*node
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isOp(text string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == text
+}
+
+func (p *parser) isWord(text string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && t.text == text
+}
+
+func (p *parser) unexpected(t token, want string) error {
+	return errorAt(p.src, t.pos, "unexpected %s, expected %s", t, want)
+}
+
+func (p *parser) parse() (*node, error) {
+	if p.peek().kind == tokEOF {
+		return nil, errorAt(p.src, 0, "empty expression")
+	}
+
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t, "&&, || or the end of the expression")
+	}
+
+	return n, nil
+}
+
+func (p *parser) or() (*node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("||") {
+		op := p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &node{kind: binaryNode, pos: left.pos, op: op.text, opPos: op.pos, children: []*node{left, right}}
+	}
+
+	return left, nil
+}
+
+func (p *parser) and() (*node, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("&&") {
+		op := p.next()
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = &node{kind: binaryNode, pos: left.pos, op: op.text, opPos: op.pos, children: []*node{left, right}}
+	}
+
+	return left, nil
+}
+
+func (p *parser) not() (*node, error) {
+	if p.isOp("!") {
+		op := p.next()
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &node{kind: notNode, pos: op.pos, children: []*node{operand}}, nil
+	}
+
+	return p.comparison()
+}
+
+// comparisonOp reads a comparison operator, if there is one
+func (p *parser) comparisonOp() (op string, pos int, ok bool) {
+	t := p.peek()
+
+	switch {
+	case t.kind == tokOp && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+		p.next()
+		return t.text, t.pos, true
+
+	case p.isWord("in") || p.isWord("matches"):
+		p.next()
+		return t.text, t.pos, true
+
+	case p.isWord("not"):
+		p.next()
+		if !p.isWord("in") {
+			return "", 0, false
+		}
+		p.next()
+		return "not in", t.pos, true
+	}
+
+	return "", 0, false
+}
+
+func (p *parser) comparison() (*node, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	at := p.i
+	op, opPos, ok := p.comparisonOp()
+	if !ok {
+		if p.i != at {
+			return nil, p.unexpected(p.peek(), "in after not")
+		}
+		return left, nil
+	}
+
+	right, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &node{kind: binaryNode, pos: left.pos, op: op, opPos: opPos, children: []*node{left, right}}
+
+	if _, pos, chained := p.comparisonOp(); chained {
+		return nil, errorAt(p.src, pos, "comparisons can't be chained, join them with && instead")
+	}
+
+	return n, nil
+}
+
+func (p *parser) primary() (*node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokString:
+		return &node{kind: stringNode, pos: t.pos, str: t.str}, nil
+
+	case tokInt:
+		return &node{kind: intNode, pos: t.pos, num: t.num}, nil
+
+	case tokDuration:
+		return &node{kind: durationNode, pos: t.pos, dur: t.dur}, nil
+
+	case tokLParen:
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, p.unexpected(closing, "\")\"")
+		}
+		return n, nil
+
+	case tokLBrack:
+		list := &node{kind: listNode, pos: t.pos}
+		if p.peek().kind == tokRBrack {
+			p.next()
+			return list, nil
+		}
+		for {
+			item, err := p.primary()
+			if err != nil {
+				return nil, err
+			}
+			list.children = append(list.children, item)
+
+			sep := p.next()
+			if sep.kind == tokRBrack {
+				return list, nil
+			}
+			if sep.kind != tokComma {
+				return nil, p.unexpected(sep, "\",\" or \"]\"")
+			}
+		}
+
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return &node{kind: boolNode, pos: t.pos, bool: t.text == "true"}, nil
+		case "in", "not", "matches":
+			return nil, p.unexpected(t, "a value")
+		}
+
+		if p.peek().kind == tokLParen {
+			return p.call(t)
+		}
+
+		n := &node{kind: pathNode, pos: t.pos, path: []string{t.text}, pathPos: []int{t.pos}}
+		for p.peek().kind == tokDot {
+			p.next()
+			field := p.next()
+			if field.kind != tokIdent {
+				return nil, p.unexpected(field, "a field name after \".\"")
+			}
+			n.path = append(n.path, field.text)
+			n.pathPos = append(n.pathPos, field.pos)
+		}
+		return n, nil
+	}
+
+	return nil, p.unexpected(t, "a value")
+}
+
+func (p *parser) call(name token) (*node, error) {
+	p.next() // (
+
+	n := &node{kind: callNode, pos: name.pos, name: name.text}
+	if p.peek().kind == tokRParen {
+		p.next()
+		return n, nil
+	}
+
+	for {
+		arg, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		n.children = append(n.children, arg)
+
+		sep := p.next()
+		if sep.kind == tokRParen {
+			return n, nil
+		}
+		if sep.kind != tokComma {
+			return nil, p.unexpected(sep, "\",\" or \")\"")
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/derekpitt/snappy/rules/expr"
+)
+
+// fileRule is a rule as written in a rules file
+type fileRule struct {
+	Name string       `json:"name"`
+	When string       `json:"when"`
+	Then []fileAction `json:"then"`
+	Stop bool         `json:"stop"`
+}
+
+// fileAction is an action as written in a rules file. Exactly one of the
+// kinds is set, Tags goes with Wall
+type fileAction struct {
+	AddTags    []string `json:"add_tags"`
+	RemoveTags []string `json:"remove_tags"`
+	Assign     string   `json:"assign"`
+	Status     string   `json:"status"`
+	Note       string   `json:"note"`
+	Wall       string   `json:"wall"`
+	Tags       []string `json:"tags"`
+}
+
+func (f fileAction) action() (a Action, err error) {
+	var kinds []Kind
+
+	if f.AddTags != nil {
+		kinds = append(kinds, AddTags)
+		a = Action{Kind: AddTags, Tags: f.AddTags}
+	}
+	if f.RemoveTags != nil {
+		kinds = append(kinds, RemoveTags)
+		a = Action{Kind: RemoveTags, Tags: f.RemoveTags}
+	}
+	if f.Assign != "" {
+		kinds = append(kinds, Assign)
+		a = Action{Kind: Assign, Staff: f.Assign}
+	}
+	if f.Status != "" {
+		kinds = append(kinds, SetStatus)
+		a = Action{Kind: SetStatus, Status: f.Status}
+	}
+	if f.Note != "" {
+		kinds = append(kinds, Note)
+		a = Action{Kind: Note, Message: f.Note}
+	}
+	if f.Wall != "" {
+		kinds = append(kinds, WallPost)
+		a = Action{Kind: WallPost, Message: f.Wall, Tags: f.Tags}
+	}
+
+	switch {
+	case len(kinds) == 0:
+		err = fmt.Errorf("an action needs one of add_tags, remove_tags, assign, status, note or wall")
+	case len(kinds) > 1:
+		err = fmt.Errorf("an action can only do one thing, this one has %v", kinds)
+	case f.Tags != nil && a.Kind != WallPost:
+		err = fmt.Errorf("tags only goes with wall, use add_tags to tag the ticket")
+	}
+
+	return
+}
+
+// Parse reads rules from JSON like
+//
+//	{"rules": [
+//	  {"name": "billing",
+//	   "when": "ticket.subject matches \"(?i)invoice\" && \"#billing\" not in ticket.tags",
+//	   "then": [{"add_tags": ["#billing"]}, {"assign": "sam"}],
+//	   "stop": true},
+//	  {"name": "stale",
+//	   "when": "ticket.status == \"waiting\" && age > 4h",
+//	   "then": [{"note": "{{.DefaultSubject}} has been waiting a while"}]}
+//	]}
+//
+// "when" is an expression (see the expr package), and a rule without one
+// matches every ticket. The actions are add_tags, remove_tags, assign,
+// status, note and wall, which takes "tags" for the wall post. Rules are
+// compiled and validated, and errors say where they are: the line and
+// column for bad JSON, and the rule and the position within "when" for bad
+// expressions.
+//
+// Only JSON is read, YAML would need a package from outside the standard
+// library.
+func Parse(data []byte) ([]Rule, error) {
+	var file struct {
+		Rules []fileRule `json:"rules"`
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, jsonError(data, err)
+	}
+
+	rules := make([]Rule, 0, len(file.Rules))
+	names := map[string]bool{}
+
+	for i, f := range file.Rules {
+		where := fmt.Sprintf("rule %d", i+1)
+		if f.Name != "" {
+			where = fmt.Sprintf("rule %q", f.Name)
+		}
+
+		if names[f.Name] && f.Name != "" {
+			return nil, fmt.Errorf("rules: %s: the name is used twice", where)
+		}
+		names[f.Name] = true
+
+		r := Rule{Name: f.Name, Stop: f.Stop}
+
+		if strings.TrimSpace(f.When) != "" {
+			program, err := expr.Compile(f.When)
+			if err != nil {
+				return nil, fmt.Errorf("rules: %s: when %v", where, err)
+			}
+			r.When.Expr = program
+		}
+
+		for j, fa := range f.Then {
+			a, err := fa.action()
+			if err != nil {
+				return nil, fmt.Errorf("rules: %s: action %d: %v", where, j+1, err)
+			}
+			r.Then = append(r.Then, a)
+		}
+
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// LoadFile reads rules from a JSON file, see Parse
+func LoadFile(path string) ([]Rule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return rules, nil
+}
+
+// jsonError adds the line and column to JSON errors that have an offset
+func jsonError(data []byte, err error) error {
+	var offset int64
+
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		// the offset is just past the bad character
+		offset = e.Offset - 1
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return fmt.Errorf("rules: %v", err)
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+
+	return fmt.Errorf("rules: %d:%d: %v", line, column, err)
+}
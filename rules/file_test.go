@@ -0,0 +1,108 @@
+package rules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/rules/expr"
+)
+
+const testFile = `{"rules": [
+  {"name": "billing",
+   "when": "ticket.subject matches \"(?i)invoice\" && \"#billing\" not in ticket.tags",
+   "then": [{"add_tags": ["#billing"]}, {"assign": "test1"}],
+   "stop": true},
+  {"name": "stale",
+   "when": "ticket.status == \"waiting\" && age > 4h",
+   "then": [{"note": "{{.DefaultSubject}} is stale"}, {"wall": "stale", "tags": ["#stale"]}, {"status": "new"}]},
+  {"name": "everything",
+   "then": [{"remove_tags": ["#new"]}]}
+]}`
+
+func TestParse(t *testing.T) {
+	rules, err := Parse([]byte(testFile))
+	if err != nil {
+		t.Fatalf("Expected no error in Parse(), got %v", err)
+	}
+
+	if len(rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(rules))
+	}
+
+	expected := []Action{
+		{Kind: Note, Message: "{{.DefaultSubject}} is stale"},
+		{Kind: WallPost, Message: "stale", Tags: []string{"#stale"}},
+		{Kind: SetStatus, Status: "new"},
+	}
+	if reflect.DeepEqual(expected, rules[1].Then) == false {
+		t.Errorf("Expected actions %+v, got %+v", expected, rules[1].Then)
+	}
+
+	if !rules[0].Stop || rules[1].Stop {
+		t.Errorf("Expected only the first rule to stop")
+	}
+
+	ticket := snappy.Ticket{DefaultSubject: "Invoice", Status: "waiting"}
+	matches := []bool{true, true, true}
+	for i, r := range rules {
+		if got := r.When.Match(expr.Env{Ticket: ticket, Age: 5 * time.Hour}); got != matches[i] {
+			t.Errorf("%s: expected match %v, got %v", r.Name, matches[i], got)
+		}
+	}
+
+	ticket.Tags = []string{"#Billing"}
+	if rules[0].When.Match(expr.Env{Ticket: ticket}) {
+		t.Errorf("Expected billing not to match a ticket already tagged")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		file    string
+		message string
+	}{
+		{"{\"rules\": [\n  {\"name\": \"a\",}\n]}", "rules: 2:16: invalid character '}'"},
+		{`{"rules": [{"name": "a", "wen": "age > 1h"}]}`, `unknown field "wen"`},
+		{`{"rules": [{"name": "a", "when": 3}]}`, "rules: 1:35: json: cannot unmarshal number"},
+		{`{"rules": [{"name": "a", "when": "age > 1h &&", "then": [{"assign": "sam"}]}]}`, `rules: rule "a": when 1:12: unexpected end of expression`},
+		{`{"rules": [{"when": "ticket.statu == \"x\"", "then": [{"assign": "sam"}]}]}`, `rules: rule 1: when 1:8: ticket has no field "statu"`},
+		{`{"rules": [{"name": "a", "then": [{}]}]}`, `rules: rule "a": action 1: an action needs one of`},
+		{`{"rules": [{"name": "a", "then": [{"assign": "sam", "note": "hi"}]}]}`, "can only do one thing, this one has [assign note]"},
+		{`{"rules": [{"name": "a", "then": [{"add_tags": ["#a"], "tags": ["#b"]}]}]}`, "tags only goes with wall"},
+		{`{"rules": [{"name": "a", "then": [{"add_tags": []}]}]}`, "rules: a: add_tags without tags"},
+		{`{"rules": [{"name": "a", "then": [{"assign": "x"}]}, {"name": "a", "then": [{"assign": "y"}]}]}`, `rule "a": the name is used twice`},
+	}
+
+	for _, c := range cases {
+		_, err := Parse([]byte(c.file))
+		if err == nil {
+			t.Errorf("Expected an error parsing %s", c.file)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.message) {
+			t.Errorf("Expected the error to contain %q, got %q", c.message, err)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "rules.json")
+	ioutil.WriteFile(path, []byte(`{"rules": [{"name": "a", "when": "age >", "then": [{"assign": "x"}]}]}`), 0600)
+
+	_, err = LoadFile(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+": rules: rule \"a\": when 1:6:") {
+		t.Errorf("Expected the error to start with the path and position, got %v", err)
+	}
+}
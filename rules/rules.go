@@ -0,0 +1,255 @@
+// Package rules tags and routes tickets automatically. A Rule pairs a
+// Condition on a ticket with Actions to take when it matches, and an Engine
+// evaluates rules over the tickets it polls from mailbox inboxes, recording
+// everything it does (or would do, in dry run mode) to an audit log.
+// Rules can be written in Go or read from JSON files with LoadFile, where
+// conditions are expressions of the expr package.
+//
+// The Snappy API has no way to change a ticket's status or to add a private
+// note, so:
+//
+//   - status actions are recorded in the audit log as failed
+//   - note actions post to the wall, linked to the ticket, which only staff see
+//   - assign actions tag the ticket with "@username", which is how Snappy
+//     assigns tickets, replacing any other "@" tag
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/rules/expr"
+)
+
+// Condition matches tickets. Every field that is set has to match; an empty
+// Condition matches every ticket
+type Condition struct {
+	// Mailboxes the ticket has to be in
+	Mailboxes []int
+
+	// Subject and Summary are matched against DefaultSubject and Summary
+	Subject *regexp.Regexp
+	Summary *regexp.Regexp
+
+	// ContactDomains are the domains the opener's address may be at,
+	// subdomains included
+	ContactDomains []string
+
+	// HasTags all have to be on the ticket, LacksTags none of them
+	HasTags   []string
+	LacksTags []string
+
+	// CreatedVia lists the channels the ticket may have come in by, e.g. "email"
+	CreatedVia []string
+
+	// Statuses the ticket may be in
+	Statuses []string
+
+	// MinAge and MaxAge bound how long ago the ticket was opened
+	MinAge time.Duration
+	MaxAge time.Duration
+
+	// Expr is an expression the ticket has to match, see the expr package
+	Expr *expr.Program
+}
+
+func hasTag(t snappy.Ticket, tag string) bool {
+	for _, tt := range t.Tags {
+		if strings.EqualFold(tt, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// domain returns the lowercased domain of an address
+func domain(address string) string {
+	i := strings.LastIndex(address, "@")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(address[i+1:]))
+}
+
+// Match reports whether the ticket of env matches
+func (c Condition) Match(env expr.Env) bool {
+	t, age := env.Ticket, env.Age
+
+	if len(c.Mailboxes) > 0 && !containsInt(c.Mailboxes, t.MailboxID) {
+		return false
+	}
+
+	if c.Subject != nil && !c.Subject.MatchString(t.DefaultSubject) {
+		return false
+	}
+
+	if c.Summary != nil && !c.Summary.MatchString(t.Summary) {
+		return false
+	}
+
+	if len(c.ContactDomains) > 0 {
+		d := domain(t.Opener.Address)
+		matched := false
+		for _, want := range c.ContactDomains {
+			want = strings.ToLower(strings.TrimPrefix(want, "@"))
+			if d == want || strings.HasSuffix(d, "."+want) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for _, tag := range c.HasTags {
+		if !hasTag(t, tag) {
+			return false
+		}
+	}
+
+	for _, tag := range c.LacksTags {
+		if hasTag(t, tag) {
+			return false
+		}
+	}
+
+	if len(c.CreatedVia) > 0 && !containsFold(c.CreatedVia, t.CreatedVia) {
+		return false
+	}
+
+	if len(c.Statuses) > 0 && !containsFold(c.Statuses, t.Status) {
+		return false
+	}
+
+	if c.MinAge != 0 && age < c.MinAge {
+		return false
+	}
+
+	if c.MaxAge != 0 && age > c.MaxAge {
+		return false
+	}
+
+	if c.Expr != nil && !c.Expr.Eval(env) {
+		return false
+	}
+
+	return true
+}
+
+// Kind is what an action does
+type Kind string
+
+// The kinds of action
+const (
+	AddTags    Kind = "add_tags"
+	RemoveTags Kind = "remove_tags"
+	Assign     Kind = "assign"
+	SetStatus  Kind = "status"
+	Note       Kind = "note"
+	WallPost   Kind = "wall"
+)
+
+// Action is something done to a matching ticket
+type Action struct {
+	Kind Kind
+
+	// Tags for AddTags, RemoveTags and the tags of a WallPost
+	Tags []string
+
+	// Staff is the username to Assign to
+	Staff string
+
+	// Status for SetStatus
+	Status string
+
+	// Message is the content of a Note or WallPost. It is a text/template
+	// executed with the ticket, e.g. "{{.DefaultSubject}} needs a look"
+	Message string
+}
+
+// Rule is a condition and what to do when a ticket matches it
+type Rule struct {
+	Name string
+	When Condition
+	Then []Action
+
+	// Stop skips the rules after this one for tickets it matched
+	Stop bool
+}
+
+// Validate checks that a rule's actions make sense
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rules: a rule needs a name")
+	}
+
+	if len(r.Then) == 0 {
+		return fmt.Errorf("rules: %s: no actions", r.Name)
+	}
+
+	for _, a := range r.Then {
+		switch a.Kind {
+		case AddTags, RemoveTags:
+			if len(a.Tags) == 0 {
+				return fmt.Errorf("rules: %s: %s without tags", r.Name, a.Kind)
+			}
+		case Assign:
+			if strings.TrimPrefix(a.Staff, "@") == "" {
+				return fmt.Errorf("rules: %s: assign without a staff username", r.Name)
+			}
+		case SetStatus:
+			if a.Status == "" {
+				return fmt.Errorf("rules: %s: status without a status", r.Name)
+			}
+		case Note, WallPost:
+			if strings.TrimSpace(a.Message) == "" {
+				return fmt.Errorf("rules: %s: %s without a message", r.Name, a.Kind)
+			}
+			if _, err := template.New("").Parse(a.Message); err != nil {
+				return fmt.Errorf("rules: %s: %v", r.Name, err)
+			}
+		default:
+			return fmt.Errorf("rules: %s: unknown action %q", r.Name, a.Kind)
+		}
+	}
+
+	return nil
+}
+
+// message executes an action's message template with a ticket
+func (a Action) message(t snappy.Ticket) (string, error) {
+	tmpl, err := template.New("").Parse(a.Message)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, t); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
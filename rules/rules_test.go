@@ -0,0 +1,93 @@
+package rules
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/rules/expr"
+)
+
+func TestConditionMatch(t *testing.T) {
+	ticket := snappy.Ticket{
+		MailboxID:      2,
+		DefaultSubject: "Invoice #123 is wrong",
+		Summary:        "I was charged twice",
+		CreatedVia:     "email",
+		Status:         "new",
+		Tags:           []string{"#Billing"},
+		Opener:         snappy.Contact{Address: "someone@mail.Example.com"},
+	}
+
+	cases := []struct {
+		name     string
+		c        Condition
+		expected bool
+	}{
+		{"empty", Condition{}, true},
+		{"mailbox", Condition{Mailboxes: []int{1, 2}}, true},
+		{"other mailbox", Condition{Mailboxes: []int{1}}, false},
+		{"subject", Condition{Subject: regexp.MustCompile(`(?i)invoice`)}, true},
+		{"summary", Condition{Summary: regexp.MustCompile(`refund`)}, false},
+		{"subdomain", Condition{ContactDomains: []string{"example.com"}}, true},
+		{"other domain", Condition{ContactDomains: []string{"ample.com"}}, false},
+		{"has tags", Condition{HasTags: []string{"#billing"}}, true},
+		{"lacks tags", Condition{LacksTags: []string{"#billing"}}, false},
+		{"created via", Condition{CreatedVia: []string{"Email"}}, true},
+		{"status", Condition{Statuses: []string{"waiting"}}, false},
+		{"old enough", Condition{MinAge: time.Hour}, true},
+		{"too old", Condition{MaxAge: time.Hour}, false},
+		{"expr", Condition{Expr: expr.MustCompile(`"#billing" in ticket.tags && age > 1h`)}, true},
+		{"expr false", Condition{Expr: expr.MustCompile(`ticket.status == "waiting"`)}, false},
+	}
+
+	for _, c := range cases {
+		if got := c.c.Match(expr.Env{Ticket: ticket, Age: 2 * time.Hour}); got != c.expected {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []Rule{
+		{Then: []Action{{Kind: AddTags, Tags: []string{"#a"}}}},
+		{Name: "no actions"},
+		{Name: "no tags", Then: []Action{{Kind: AddTags}}},
+		{Name: "no staff", Then: []Action{{Kind: Assign, Staff: "@"}}},
+		{Name: "no message", Then: []Action{{Kind: Note}}},
+		{Name: "bad template", Then: []Action{{Kind: WallPost, Message: "{{.Nope"}}},
+		{Name: "unknown", Then: []Action{{Kind: "explode"}}},
+	}
+
+	for _, r := range bad {
+		if err := r.Validate(); err == nil {
+			t.Errorf("Expected an error for rule %q", r.Name)
+		}
+	}
+
+	good := Rule{Name: "ok", Then: []Action{{Kind: Note, Message: "{{.ID}}"}, {Kind: Assign, Staff: "test1"}}}
+	if err := good.Validate(); err != nil {
+		t.Errorf("Expected no error in Validate(), got %v", err)
+	}
+}
+
+func TestChangeTags(t *testing.T) {
+	tags := []string{"#a", "@old"}
+
+	if got := changeTags(tags, Action{Kind: AddTags, Tags: []string{"#A", "#b"}}); len(got) != 3 || got[2] != "#b" {
+		t.Errorf("Unexpected tags %v", got)
+	}
+
+	if got := changeTags(tags, Action{Kind: RemoveTags, Tags: []string{"#A"}}); len(got) != 1 || got[0] != "@old" {
+		t.Errorf("Unexpected tags %v", got)
+	}
+
+	if got := changeTags(tags, Action{Kind: Assign, Staff: "new"}); len(got) != 2 || got[1] != "@new" {
+		t.Errorf("Unexpected tags %v", got)
+	}
+
+	if tags[0] != "#a" || tags[1] != "@old" {
+		t.Errorf("Expected the original tags to be left alone, got %v", tags)
+	}
+}
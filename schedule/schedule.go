@@ -0,0 +1,179 @@
+// Package schedule sends notes and changes tags at a later time, so a reply
+// written now can go out at 9am in the customer's time zone, or a ticket can
+// be snoozed until Monday. Jobs are kept in a Store, a JSON file, and a
+// Scheduler runs the ones that are due, retrying failures with a backoff.
+//
+// The Snappy API has no way to change a ticket's status, so snoozing tags the
+// ticket with SnoozeTag and schedules the tag's removal; rules and views can
+// leave snoozed tickets alone until then.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+// Kind is what a job does
+type Kind string
+
+// The kinds of job
+const (
+	// Note sends Job.Note with CreateNote
+	Note Kind = "note"
+
+	// Tags adds Job.AddTags to the ticket and removes Job.RemoveTags
+	Tags Kind = "tags"
+)
+
+// State is where a job is in its life
+type State string
+
+// The states of a job
+const (
+	Pending State = "pending"
+
+	// Running is a job a Scheduler has claimed, until its Lease runs out
+	Running State = "running"
+
+	Done      State = "done"
+	Failed    State = "failed"
+	Cancelled State = "cancelled"
+)
+
+// SnoozeTag is the tag Snooze adds
+const SnoozeTag = "#snoozed"
+
+// Job is something to do to a ticket at a later time
+type Job struct {
+	ID       int       `json:"id"`
+	Kind     Kind      `json:"kind"`
+	TicketID int       `json:"ticket_id"`
+	Due      time.Time `json:"due"`
+	State    State     `json:"state"`
+
+	Note       *snappy.NewNote `json:"note,omitempty"`
+	AddTags    []string        `json:"add_tags,omitempty"`
+	RemoveTags []string        `json:"remove_tags,omitempty"`
+
+	// Attempts counts the tries so far, Retry is when the next one is due
+	// after a failure, and Error is the last failure
+	Attempts int       `json:"attempts"`
+	Retry    time.Time `json:"retry"`
+	Error    string    `json:"error,omitempty"`
+
+	// Lease is when the claim on a running job runs out. A job left running
+	// by a Scheduler that died is run again after it
+	Lease time.Time `json:"lease"`
+
+	CreatedAt  time.Time `json:"created_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Validate checks a job can be run
+func (j Job) Validate() error {
+	if j.TicketID <= 0 {
+		return errors.New("schedule: a job needs a ticket")
+	}
+
+	if j.Due.IsZero() {
+		return errors.New("schedule: a job needs a due time")
+	}
+
+	switch j.Kind {
+	case Note:
+		if j.Note == nil {
+			return errors.New("schedule: a note job needs a note")
+		}
+		return j.Note.Validate()
+	case Tags:
+		if len(j.AddTags) == 0 && len(j.RemoveTags) == 0 {
+			return errors.New("schedule: a tags job needs tags to add or remove")
+		}
+		return nil
+	case "status":
+		return errors.New("schedule: the Snappy API can't change a ticket's status, snooze it instead")
+	}
+
+	return fmt.Errorf("schedule: unknown kind of job %q", j.Kind)
+}
+
+// Summary describes what a job does
+func (j Job) Summary() string {
+	switch j.Kind {
+	case Note:
+		if j.Note == nil {
+			return "note"
+		}
+		return fmt.Sprintf("note %q", j.Note.Subject)
+	case Tags:
+		var changes []string
+		for _, t := range j.AddTags {
+			changes = append(changes, "+"+t)
+		}
+		for _, t := range j.RemoveTags {
+			changes = append(changes, "-"+t)
+		}
+		return "tags " + strings.Join(changes, " ")
+	}
+	return string(j.Kind)
+}
+
+// next is when a pending job should run
+func (j Job) next() time.Time {
+	if j.Retry.After(j.Due) {
+		return j.Retry
+	}
+	return j.Due
+}
+
+// Reply creates a job sending a reply to a ticket at a later time, see
+// snappy.NewReply. Private replies and conflict checks aren't supported
+func Reply(ticket snappy.Ticket, body string, opts snappy.ReplyOptions, due time.Time) (Job, error) {
+	if opts.Private || opts.CheckConflicts {
+		return Job{}, errors.New("schedule: replies can't be private or check for conflicts")
+	}
+
+	note, err := snappy.NewReply(ticket, body, opts)
+	if err != nil {
+		return Job{}, err
+	}
+
+	return Job{Kind: Note, TicketID: ticket.ID, Due: due, Note: &note}, nil
+}
+
+// ChangeTags creates a job changing a ticket's tags at a later time
+func ChangeTags(ticketID int, add, remove []string, due time.Time) Job {
+	return Job{Kind: Tags, TicketID: ticketID, Due: due, AddTags: add, RemoveTags: remove}
+}
+
+// changeTags applies a tags job to a ticket's tags
+func changeTags(tags []string, j Job) []string {
+	result := []string{}
+
+	for _, t := range tags {
+		if !contains(j.RemoveTags, t) {
+			result = append(result, t)
+		}
+	}
+
+	for _, t := range j.AddTags {
+		if !contains(result, t) {
+			result = append(result, t)
+		}
+	}
+
+	return result
+}
+
+func contains(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package schedule
+
+import (
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+// Scheduler runs the jobs in a Store when they are due
+type Scheduler struct {
+	Client *snappy.Snappy
+	Store  *Store
+
+	// MaxAttempts is how many times a job is tried before it fails, Backoff
+	// how long to wait after the first failure, doubling up to MaxBackoff
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+
+	// Lease is how long a job is kept from other Schedulers while it runs,
+	// it should be longer than any job takes
+	Lease time.Duration
+
+	// Now returns the current time, it defaults to time.Now
+	Now func() time.Time
+}
+
+// New creates a Scheduler that tries each job 5 times, waiting a minute after
+// the first failure and up to an hour after later ones
+func New(client *snappy.Snappy, store *Store) *Scheduler {
+	return &Scheduler{
+		Client:      client,
+		Store:       store,
+		MaxAttempts: 5,
+		Backoff:     time.Minute,
+		MaxBackoff:  time.Hour,
+		Lease:       10 * time.Minute,
+	}
+}
+
+func (s *Scheduler) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Snooze tags a ticket with SnoozeTag now and schedules the tag's removal.
+// The removal is stored first, and cancelled again if tagging fails, so a
+// ticket is never left snoozed for good
+func (s *Scheduler) Snooze(ticketID int, until time.Time) (Job, error) {
+	j, err := s.Store.Add(ChangeTags(ticketID, nil, []string{SnoozeTag}, until))
+	if err != nil {
+		return j, err
+	}
+
+	if err := s.changeTags(Job{TicketID: ticketID, AddTags: []string{SnoozeTag}}); err != nil {
+		if cancelled, cancelErr := s.Store.Cancel(j.ID); cancelErr == nil {
+			j = cancelled
+		}
+		return j, err
+	}
+
+	return j, nil
+}
+
+// Run runs the pending jobs that are due and returns them as they ended up.
+// Each job is claimed in the Store before it runs, so Schedulers sharing a
+// Store never run the same job twice. A job that fails is tried again after
+// a backoff, until it runs out of attempts or fails in a way retrying won't
+// fix
+func (s *Scheduler) Run() (ran []Job, err error) {
+	pending, err := s.Store.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, j := range pending {
+		now := s.now()
+
+		// it may have been cancelled or claimed since the list was read
+		claimed, ok, err := s.Store.claim(j.ID, now, now.Add(s.Lease))
+		if err != nil {
+			return ran, err
+		}
+		if !ok {
+			continue
+		}
+
+		j = s.run(claimed)
+		if err := s.Store.record(claimed.Lease, j); err != nil {
+			return ran, err
+		}
+
+		ran = append(ran, j)
+	}
+
+	return
+}
+
+// run tries a job once and updates it with the outcome
+func (s *Scheduler) run(j Job) Job {
+	var err error
+	switch j.Kind {
+	case Note:
+		err = s.Client.CreateNote(*j.Note)
+	case Tags:
+		err = s.changeTags(j)
+	default:
+		err = j.Validate()
+	}
+
+	now := s.now()
+	j.Attempts++
+	j.Lease = time.Time{}
+
+	if err == nil {
+		j.State, j.Error, j.Retry, j.FinishedAt = Done, "", time.Time{}, now
+		return j
+	}
+
+	j.Error = err.Error()
+
+	if j.Attempts >= s.MaxAttempts || permanent(err) {
+		j.State, j.FinishedAt = Failed, now
+		return j
+	}
+
+	backoff := s.Backoff
+	for i := 1; i < j.Attempts && backoff < s.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if s.MaxBackoff > 0 && backoff > s.MaxBackoff {
+		backoff = s.MaxBackoff
+	}
+	j.State, j.Retry = Pending, now.Add(backoff)
+
+	return j
+}
+
+// permanent reports whether retrying after err would fail the same way
+func permanent(err error) bool {
+	return snappy.IsValidationError(err) || snappy.IsNotFound(err) || snappy.IsUnauthorized(err)
+}
+
+func (s *Scheduler) changeTags(j Job) error {
+	t, err := s.Client.Ticket(j.TicketID)
+	if err != nil {
+		return err
+	}
+
+	return s.Client.UpdateTags(j.TicketID, changeTags(t.Tags, j)...)
+}
+
+// Watch calls Run every interval until stop is closed, passing what each run
+// did to handle
+func (s *Scheduler) Watch(interval time.Duration, stop <-chan struct{}, handle func([]Job, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		ran, err := s.Run()
+		if handle != nil {
+			handle(ran, err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+var (
+	mux    *http.ServeMux
+	server *httptest.Server
+	client *snappy.Snappy
+	dir    string
+)
+
+func setup() {
+	mux = http.NewServeMux()
+	server = httptest.NewServer(mux)
+
+	client = snappy.WithAPIKey("apikey")
+	client.SetEndpointPrefix(server.URL)
+
+	dir, _ = ioutil.TempDir("", "schedule")
+}
+
+func teardown() {
+	server.Close()
+	os.RemoveAll(dir)
+}
+
+var start = time.Date(2014, 1, 2, 8, 0, 0, 0, time.UTC)
+
+// ticket is the server's state for ticket 7
+type ticket struct {
+	tags  []string
+	notes []snappy.NewNote
+	fail  int
+}
+
+func (t *ticket) handle() {
+	mux.HandleFunc("/ticket/7", func(w http.ResponseWriter, r *http.Request) {
+		tags, _ := json.Marshal(t.tags)
+		fmt.Fprintf(w, `{"id":7,"mailbox_id":2,"nonce":"abc","default_subject":"Help","tags":%s}`, tags)
+	})
+	mux.HandleFunc("/ticket/7/tags", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		json.Unmarshal([]byte(r.PostForm.Get("tags")), &t.tags)
+	})
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		if t.fail > 0 {
+			t.fail--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		var n snappy.NewNote
+		json.NewDecoder(r.Body).Decode(&n)
+		t.notes = append(t.notes, n)
+	})
+}
+
+func newScheduler(now *time.Time) *Scheduler {
+	s := New(client, NewStore(filepath.Join(dir, "jobs.json")))
+	s.Now = func() time.Time { return *now }
+	return s
+}
+
+func TestRun(t *testing.T) {
+	setup()
+	defer teardown()
+
+	tk := &ticket{tags: []string{"#support"}}
+	tk.handle()
+
+	now := start
+	s := newScheduler(&now)
+
+	reply, err := Reply(snappy.Ticket{ID: 7, MailboxID: 2, TicketNonce: "abc", DefaultSubject: "Help"}, "thanks!", snappy.ReplyOptions{StaffID: 4}, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error in Reply(), got %v", err)
+	}
+
+	if reply, err = s.Store.Add(reply); err != nil || reply.ID != 1 || reply.State != Pending {
+		t.Fatalf("Unexpected job %+v, %v", reply, err)
+	}
+
+	tags, _ := s.Store.Add(ChangeTags(7, []string{"#billing"}, []string{"#support"}, start.Add(2*time.Hour)))
+
+	if ran, _ := s.Run(); len(ran) != 0 {
+		t.Errorf("Expected nothing to be due, got %+v", ran)
+	}
+
+	now = start.Add(90 * time.Minute)
+	ran, err := s.Run()
+	if err != nil {
+		t.Fatalf("Expected no error in Run(), got %v", err)
+	}
+
+	if len(ran) != 1 || ran[0].ID != reply.ID || ran[0].State != Done || ran[0].Attempts != 1 {
+		t.Errorf("Expected the reply to be sent, got %+v", ran)
+	}
+
+	expected := snappy.NewNote{Subject: "Help", Message: "thanks!", MailboxID: 2, StaffID: 4, TicketNonce: "abc"}
+	if len(tk.notes) != 1 || reflect.DeepEqual(expected, tk.notes[0]) == false {
+		t.Errorf("Expected %+v, got %+v", expected, tk.notes)
+	}
+
+	now = start.Add(3 * time.Hour)
+	s.Run()
+
+	if expected := []string{"#billing"}; reflect.DeepEqual(expected, tk.tags) == false {
+		t.Errorf("Expected tags %v, got %v", expected, tk.tags)
+	}
+
+	if job, _ := s.Store.Get(tags.ID); job.State != Done {
+		t.Errorf("Expected the tags job to be done, got %+v", job)
+	}
+
+	if pending, _ := s.Store.Pending(); len(pending) != 0 {
+		t.Errorf("Expected nothing pending, got %+v", pending)
+	}
+
+	// nothing runs twice
+	if ran, _ := s.Run(); len(ran) != 0 || len(tk.notes) != 1 {
+		t.Errorf("Expected nothing to run again, got %+v", ran)
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	setup()
+	defer teardown()
+
+	tk := &ticket{fail: 2}
+	tk.handle()
+
+	now := start
+	s := newScheduler(&now)
+
+	job, _ := Reply(snappy.Ticket{ID: 7, MailboxID: 2, TicketNonce: "abc"}, "thanks!", snappy.ReplyOptions{}, start)
+	job, _ = s.Store.Add(job)
+
+	ran, _ := s.Run()
+	if len(ran) != 1 || ran[0].State != Pending || ran[0].Attempts != 1 || !ran[0].Retry.Equal(start.Add(time.Minute)) || ran[0].Error == "" {
+		t.Fatalf("Expected a retry in a minute, got %+v", ran)
+	}
+
+	// not due again until the backoff is over
+	now = start.Add(30 * time.Second)
+	if ran, _ := s.Run(); len(ran) != 0 {
+		t.Errorf("Expected to wait for the backoff, got %+v", ran)
+	}
+
+	now = start.Add(time.Minute)
+	ran, _ = s.Run()
+	if len(ran) != 1 || !ran[0].Retry.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("Expected the backoff to double, got %+v", ran)
+	}
+
+	now = now.Add(2 * time.Minute)
+	ran, _ = s.Run()
+	if len(ran) != 1 || ran[0].State != Done || ran[0].Attempts != 3 || ran[0].Error != "" || len(tk.notes) != 1 {
+		t.Errorf("Expected the third attempt to work, got %+v", ran)
+	}
+
+	// running out of attempts
+	tk.fail = 10
+	s.MaxAttempts = 2
+	job, _ = s.Store.Add(job)
+	s.Run()
+	now = now.Add(time.Hour)
+	if ran, _ := s.Run(); len(ran) != 1 || ran[0].State != Failed || ran[0].Attempts != 2 {
+		t.Errorf("Expected the job to fail, got %+v", ran)
+	}
+}
+
+func TestRunPermanentFailure(t *testing.T) {
+	setup()
+	defer teardown()
+
+	now := start
+	s := newScheduler(&now)
+
+	// the ticket is gone
+	s.Store.Add(ChangeTags(7, []string{"#a"}, nil, start))
+
+	ran, _ := s.Run()
+	if len(ran) != 1 || ran[0].State != Failed || ran[0].Attempts != 1 {
+		t.Errorf("Expected a 404 not to be retried, got %+v", ran)
+	}
+}
+
+func TestRunClaims(t *testing.T) {
+	setup()
+	defer teardown()
+
+	tk := &ticket{}
+	tk.handle()
+
+	now := start
+	first, second := newScheduler(&now), newScheduler(&now)
+
+	job, _ := Reply(snappy.Ticket{ID: 7, MailboxID: 2, TicketNonce: "abc"}, "thanks!", snappy.ReplyOptions{}, start)
+	job, _ = first.Store.Add(job)
+
+	// the first Scheduler is in the middle of running it
+	claimed, ok, err := first.Store.claim(job.ID, now, now.Add(first.Lease))
+	if err != nil || !ok || claimed.State != Running {
+		t.Fatalf("Expected the job to be claimed, got %+v, %v, %v", claimed, ok, err)
+	}
+
+	if ran, _ := second.Run(); len(ran) != 0 || len(tk.notes) != 0 {
+		t.Errorf("Expected a claimed job not to run twice, got %+v", ran)
+	}
+
+	if _, err := second.Store.Cancel(job.ID); err == nil {
+		t.Errorf("Expected a running job not to be cancelled")
+	}
+
+	// the first Scheduler died, its claim runs out
+	now = now.Add(first.Lease)
+	if ran, _ := second.Run(); len(ran) != 1 || ran[0].State != Done || len(tk.notes) != 1 {
+		t.Errorf("Expected the job to be run again once the claim ran out, got %+v", ran)
+	}
+
+	if err := first.Store.record(claimed.Lease, first.run(claimed)); err == nil {
+		t.Errorf("Expected the lost claim not to be recorded")
+	}
+
+	if j, _ := first.Store.Get(job.ID); j.State != Done || j.Attempts != 1 {
+		t.Errorf("Expected the second run to be kept, got %+v", j)
+	}
+}
+
+func TestSnooze(t *testing.T) {
+	setup()
+	defer teardown()
+
+	tk := &ticket{tags: []string{"#support"}}
+	tk.handle()
+
+	now := start
+	s := newScheduler(&now)
+
+	job, err := s.Snooze(7, start.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error in Snooze(), got %v", err)
+	}
+
+	if expected := []string{"#support", SnoozeTag}; reflect.DeepEqual(expected, tk.tags) == false {
+		t.Errorf("Expected tags %v, got %v", expected, tk.tags)
+	}
+
+	if job.Summary() != "tags -#snoozed" {
+		t.Errorf("Unexpected job %s", job.Summary())
+	}
+
+	now = start.Add(25 * time.Hour)
+	s.Run()
+
+	if expected := []string{"#support"}; reflect.DeepEqual(expected, tk.tags) == false {
+		t.Errorf("Expected the snooze to end, got tags %v", tk.tags)
+	}
+}
+
+func TestSnoozeFailure(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// the ticket is gone
+	now := start
+	s := newScheduler(&now)
+
+	if _, err := s.Snooze(7, start.Add(time.Hour)); err == nil {
+		t.Fatal("Expected an error snoozing a missing ticket")
+	}
+
+	if pending, _ := s.Store.Pending(); len(pending) != 0 {
+		t.Errorf("Expected the removal to be cancelled, got %+v", pending)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	setup()
+	defer teardown()
+
+	now := start
+	s := newScheduler(&now)
+
+	stop := make(chan struct{})
+	runs := 0
+	s.Watch(time.Millisecond, stop, func(ran []Job, err error) {
+		runs++
+		if runs == 3 {
+			close(stop)
+		}
+	})
+
+	if runs != 3 {
+		t.Errorf("Expected 3 runs, got %d", runs)
+	}
+}
@@ -0,0 +1,247 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/derekpitt/snappy/internal/atomicfile"
+)
+
+// Store keeps jobs in a JSON file. Every call reads the file and writes it
+// back, holding a lock on the file with .lock added to its name while it
+// does, so the CLI can add and cancel jobs while a Scheduler is running
+type Store struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewStore creates a Store for a file, which is created on the first Add
+func NewStore(path string) *Store {
+	return &Store{Path: path}
+}
+
+// jobs is the file's contents
+type jobs struct {
+	NextID int    `json:"next_id"`
+	Jobs   []*Job `json:"jobs"`
+}
+
+func (s *Store) load() (*jobs, error) {
+	f := &jobs{NextID: 1}
+
+	b, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("schedule: %s: %v", s.Path, err)
+	}
+
+	return f, nil
+}
+
+// save writes a temporary file first and renames it into place so a crash
+// never leaves half the jobs behind
+func (s *Store) save(f *jobs) error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(s.Path, b, 0644)
+}
+
+// update loads the jobs, changes them and saves them
+func (s *Store) update(change func(f *jobs) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lockFile(s.Path + ".lock")
+	if err != nil {
+		return fmt.Errorf("schedule: %v", err)
+	}
+	defer unlock()
+
+	f, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	if err := change(f); err != nil {
+		return err
+	}
+
+	return s.save(f)
+}
+
+// find returns the job with an id
+func (f *jobs) find(id int) (*Job, error) {
+	for _, j := range f.Jobs {
+		if j.ID == id {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("schedule: no job %d", id)
+}
+
+// Add validates a job and stores it as pending, returning it with its id
+func (s *Store) Add(j Job) (Job, error) {
+	if err := j.Validate(); err != nil {
+		return j, err
+	}
+
+	err := s.update(func(f *jobs) error {
+		j.ID = f.NextID
+		j.State = Pending
+		if j.CreatedAt.IsZero() {
+			j.CreatedAt = time.Now()
+		}
+
+		f.NextID++
+		f.Jobs = append(f.Jobs, &j)
+		return nil
+	})
+
+	return j, err
+}
+
+// Jobs returns every job, in the order they are due
+func (s *Store) Jobs() ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Job, len(f.Jobs))
+	for i, j := range f.Jobs {
+		result[i] = *j
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].next().Before(result[j].next()) })
+	return result, nil
+}
+
+// Pending returns the jobs still to run or running, in the order they are due
+func (s *Store) Pending() ([]Job, error) {
+	all, err := s.Jobs()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := all[:0]
+	for _, j := range all {
+		if j.State == Pending || j.State == Running {
+			pending = append(pending, j)
+		}
+	}
+	return pending, nil
+}
+
+// Get returns the job with an id
+func (s *Store) Get(id int) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := s.load()
+	if err != nil {
+		return Job{}, err
+	}
+
+	j, err := f.find(id)
+	if err != nil {
+		return Job{}, err
+	}
+	return *j, nil
+}
+
+// Cancel stops a pending job from running
+func (s *Store) Cancel(id int) (cancelled Job, err error) {
+	err = s.update(func(f *jobs) error {
+		j, err := f.find(id)
+		if err != nil {
+			return err
+		}
+
+		if j.State != Pending {
+			return fmt.Errorf("schedule: job %d is %s, not pending", id, j.State)
+		}
+
+		j.State = Cancelled
+		j.FinishedAt = time.Now()
+		cancelled = *j
+		return nil
+	})
+	return
+}
+
+// Prune removes jobs that finished before a time, returning how many
+func (s *Store) Prune(before time.Time) (removed int, err error) {
+	err = s.update(func(f *jobs) error {
+		kept := f.Jobs[:0]
+		for _, j := range f.Jobs {
+			if j.State != Pending && j.State != Running && j.FinishedAt.Before(before) {
+				removed++
+				continue
+			}
+			kept = append(kept, j)
+		}
+		f.Jobs = kept
+		return nil
+	})
+	return
+}
+
+// claim marks a due job as running until lease, so no other Scheduler runs
+// it. A running job whose lease ran out is claimed again
+func (s *Store) claim(id int, now, lease time.Time) (claimed Job, ok bool, err error) {
+	err = s.update(func(f *jobs) error {
+		j, err := f.find(id)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case j.State == Pending && !j.next().After(now):
+		case j.State == Running && !j.Lease.After(now):
+		default:
+			return nil
+		}
+
+		j.State, j.Lease = Running, lease
+		claimed, ok = *j, true
+		return nil
+	})
+	return
+}
+
+// record saves the outcome of running a job claimed with lease, unless the
+// claim ran out and another Scheduler took the job over
+func (s *Store) record(lease time.Time, j Job) error {
+	return s.update(func(f *jobs) error {
+		stored, err := f.find(j.ID)
+		if err != nil {
+			return err
+		}
+
+		if stored.State != Running || !stored.Lease.Equal(lease) {
+			return fmt.Errorf("schedule: job %d was claimed again before it finished", j.ID)
+		}
+
+		*stored = j
+		return nil
+	})
+}
@@ -0,0 +1,127 @@
+package schedule
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jobs.json")
+	s := NewStore(path)
+
+	if jobs, err := s.Jobs(); err != nil || len(jobs) != 0 {
+		t.Fatalf("Expected a missing file to have no jobs, got %v, %v", jobs, err)
+	}
+
+	later, _ := s.Add(ChangeTags(7, []string{"#a"}, nil, start.Add(time.Hour)))
+	sooner, _ := s.Add(ChangeTags(8, nil, []string{"#b"}, start))
+
+	// a second Store, as in another process, sees the same jobs
+	jobs, err := NewStore(path).Pending()
+	if err != nil {
+		t.Fatalf("Expected no error in Pending(), got %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != sooner.ID || jobs[1].ID != later.ID {
+		t.Errorf("Expected the jobs in the order they are due, got %+v", jobs)
+	}
+
+	cancelled, err := s.Cancel(later.ID)
+	if err != nil || cancelled.State != Cancelled {
+		t.Fatalf("Expected the job to be cancelled, got %+v, %v", cancelled, err)
+	}
+
+	if _, err := s.Cancel(later.ID); err == nil || !strings.Contains(err.Error(), "is cancelled, not pending") {
+		t.Errorf("Expected an error cancelling twice, got %v", err)
+	}
+
+	if _, err := s.Cancel(99); err == nil {
+		t.Errorf("Expected an error cancelling a missing job")
+	}
+
+	if jobs, _ := s.Pending(); len(jobs) != 1 || jobs[0].ID != sooner.ID {
+		t.Errorf("Expected one pending job, got %+v", jobs)
+	}
+
+	if removed, _ := s.Prune(time.Now().Add(time.Minute)); removed != 1 {
+		t.Errorf("Expected the cancelled job to be pruned, removed %d", removed)
+	}
+
+	if jobs, _ := s.Jobs(); len(jobs) != 1 {
+		t.Errorf("Expected one job left, got %+v", jobs)
+	}
+
+	// ids aren't reused
+	if j, _ := s.Add(ChangeTags(9, []string{"#c"}, nil, start)); j.ID != 3 {
+		t.Errorf("Expected id 3, got %d", j.ID)
+	}
+}
+
+func TestStoreLocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jobs.json")
+
+	// two Stores, as in two processes, adding at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(s *Store) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := s.Add(ChangeTags(7, []string{"#a"}, nil, start)); err != nil {
+					t.Errorf("Expected no error in Add(), got %v", err)
+				}
+			}
+		}(NewStore(path))
+	}
+	wg.Wait()
+
+	jobs, _ := NewStore(path).Jobs()
+	ids := map[int]bool{}
+	for _, j := range jobs {
+		ids[j.ID] = true
+	}
+	if len(jobs) != 40 || len(ids) != 40 {
+		t.Errorf("Expected 40 jobs with their own ids, got %d jobs and %d ids", len(jobs), len(ids))
+	}
+}
+
+func TestAddValidates(t *testing.T) {
+	s := NewStore(filepath.Join(os.TempDir(), "schedule-never-written.json"))
+
+	bad := []Job{
+		{Kind: Tags, TicketID: 7, Due: start},
+		{Kind: Tags, AddTags: []string{"#a"}, Due: start},
+		{Kind: Tags, TicketID: 7, AddTags: []string{"#a"}},
+		{Kind: Note, TicketID: 7, Due: start},
+		{Kind: Note, TicketID: 7, Due: start, Note: &snappy.NewNote{TicketNonce: "abc"}},
+		{Kind: "status", TicketID: 7, Due: start},
+	}
+
+	for _, j := range bad {
+		if _, err := s.Add(j); err == nil {
+			t.Errorf("Expected an error adding %+v", j)
+		}
+	}
+
+	if _, err := Reply(snappy.Ticket{ID: 7, TicketNonce: "abc"}, "hi", snappy.ReplyOptions{Private: true}, start); err == nil {
+		t.Errorf("Expected an error scheduling a private reply")
+	}
+}
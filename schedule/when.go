@@ -0,0 +1,111 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{}
+
+func init() {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		weekdays[name] = d
+		weekdays[name[:3]] = d
+	}
+}
+
+// When parses a due time relative to now, in loc:
+//
+//	2h30m, 3d            after a duration
+//	09:00                the next 9am
+//	monday, mon 09:00    the next Monday, at midnight or the time given
+//	today 17:00          today or tomorrow, at midnight or the time given
+//	2014-01-06 09:00     a date, with an optional time
+//	2014-01-06T09:00:00Z RFC 3339
+func When(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	now = now.In(loc)
+
+	if strings.HasSuffix(s, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && days > 0 {
+			return now.AddDate(0, 0, days), nil
+		}
+	}
+
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, strings.ToUpper(s)); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	fail := fmt.Errorf("schedule: can't tell when %q is", s)
+
+	var day string
+	var hour, minute int
+	fields := strings.Fields(s)
+
+	switch len(fields) {
+	case 1:
+		var ok bool
+		if hour, minute, ok = parseClock(fields[0]); !ok {
+			day = fields[0]
+		}
+	case 2:
+		var ok bool
+		if hour, minute, ok = parseClock(fields[1]); !ok {
+			return time.Time{}, fail
+		}
+		day = fields[0]
+	default:
+		return time.Time{}, fail
+	}
+
+	at := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, loc)
+	}
+
+	switch {
+	case day == "":
+		t := at(now)
+		if !t.After(now) {
+			t = at(now.AddDate(0, 0, 1))
+		}
+		return t, nil
+	case day == "today":
+		return at(now), nil
+	case day == "tomorrow":
+		return at(now.AddDate(0, 0, 1)), nil
+	}
+
+	weekday, ok := weekdays[day]
+	if !ok {
+		return time.Time{}, fail
+	}
+
+	days := (int(weekday) - int(now.Weekday()) + 7) % 7
+	t := at(now.AddDate(0, 0, days))
+	if !t.After(now) {
+		t = at(now.AddDate(0, 0, days+7))
+	}
+	return t, nil
+}
+
+// parseClock parses a time of day like 09:00 or 9:30
+func parseClock(s string) (hour, minute int, ok bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, false
+	}
+	return t.Hour(), t.Minute(), true
+}
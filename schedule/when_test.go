@@ -0,0 +1,49 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWhen(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+
+	// a Wednesday, 10:30 in New York
+	now := time.Date(2014, 1, 1, 15, 30, 0, 0, time.UTC)
+
+	cases := map[string]time.Time{
+		"2h30m":                now.Add(150 * time.Minute),
+		"3d":                   now.AddDate(0, 0, 3),
+		"09:00":                time.Date(2014, 1, 2, 9, 0, 0, 0, ny),
+		"11:15":                time.Date(2014, 1, 1, 11, 15, 0, 0, ny),
+		"monday":               time.Date(2014, 1, 6, 0, 0, 0, 0, ny),
+		"Mon 9:30":             time.Date(2014, 1, 6, 9, 30, 0, 0, ny),
+		"wednesday 09:00":      time.Date(2014, 1, 8, 9, 0, 0, 0, ny),
+		"wed 17:00":            time.Date(2014, 1, 1, 17, 0, 0, 0, ny),
+		"tomorrow 09:00":       time.Date(2014, 1, 2, 9, 0, 0, 0, ny),
+		"today 17:00":          time.Date(2014, 1, 1, 17, 0, 0, 0, ny),
+		"2014-01-06 09:00":     time.Date(2014, 1, 6, 9, 0, 0, 0, ny),
+		"2014-01-06":           time.Date(2014, 1, 6, 0, 0, 0, 0, ny),
+		"2014-01-06T09:00:00Z": time.Date(2014, 1, 6, 9, 0, 0, 0, time.UTC),
+	}
+
+	for s, expected := range cases {
+		got, err := When(s, now, ny)
+		if err != nil {
+			t.Errorf("%q: expected no error in When(), got %v", s, err)
+			continue
+		}
+		if !got.Equal(expected) {
+			t.Errorf("%q: expected %v, got %v", s, expected, got)
+		}
+	}
+
+	for _, s := range []string{"", "soon", "-2h", "monday noon", "next monday 09:00", "25:00"} {
+		if _, err := When(s, now, ny); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
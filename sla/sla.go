@@ -0,0 +1,452 @@
+// Package sla measures how quickly tickets are answered and checks the
+// numbers against response time targets.
+//
+// Three things are measured for each ticket:
+//
+//	first response  from OpenedAt to FirstStaffReplyAt, or to now while nobody has replied
+//	wait            from LastReplyAt to now while the customer has the last word
+//	resolution      from OpenedAt to UpdatedAt once a ticket is closed
+//
+// Snappy doesn't record when a ticket was closed, so resolution uses the
+// last time the ticket changed, which is when it was closed unless it was
+// touched again afterwards.
+//
+// With a Policy.Calendar set, durations only count business hours.
+package sla
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/calendar"
+)
+
+// Metric names one of the measurements
+type Metric string
+
+// The metrics a ticket is measured on
+const (
+	FirstResponse Metric = "first_response"
+	Wait          Metric = "wait"
+	Resolution    Metric = "resolution"
+)
+
+// Target holds the longest each metric may take. A zero duration means
+// there is no target for that metric
+type Target struct {
+	FirstResponse time.Duration `json:"first_response"`
+	Wait          time.Duration `json:"wait"`
+	Resolution    time.Duration `json:"resolution"`
+}
+
+type targetJSON struct {
+	FirstResponse string `json:"first_response,omitempty"`
+	Wait          string `json:"wait,omitempty"`
+	Resolution    string `json:"resolution,omitempty"`
+}
+
+// MarshalJSON writes the durations as strings like "4h0m0s"
+func (t Target) MarshalJSON() ([]byte, error) {
+	var j targetJSON
+	if t.FirstResponse != 0 {
+		j.FirstResponse = t.FirstResponse.String()
+	}
+	if t.Wait != 0 {
+		j.Wait = t.Wait.String()
+	}
+	if t.Resolution != 0 {
+		j.Resolution = t.Resolution.String()
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON reads durations written like "30m" or "4h"
+func (t *Target) UnmarshalJSON(b []byte) (err error) {
+	var j targetJSON
+	if err = json.Unmarshal(b, &j); err != nil {
+		return
+	}
+
+	*t = Target{}
+
+	for _, d := range []struct {
+		s   string
+		dst *time.Duration
+	}{
+		{j.FirstResponse, &t.FirstResponse},
+		{j.Wait, &t.Wait},
+		{j.Resolution, &t.Resolution},
+	} {
+		if d.s == "" {
+			continue
+		}
+		if *d.dst, err = time.ParseDuration(d.s); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (t Target) get(m Metric) time.Duration {
+	switch m {
+	case FirstResponse:
+		return t.FirstResponse
+	case Wait:
+		return t.Wait
+	case Resolution:
+		return t.Resolution
+	}
+	return 0
+}
+
+// override replaces the targets of t that o sets
+func (t Target) override(o Target) Target {
+	if o.FirstResponse != 0 {
+		t.FirstResponse = o.FirstResponse
+	}
+	if o.Wait != 0 {
+		t.Wait = o.Wait
+	}
+	if o.Resolution != 0 {
+		t.Resolution = o.Resolution
+	}
+	return t
+}
+
+// strictest keeps the shorter of each target of t and o
+func (t Target) strictest(o Target) Target {
+	pick := func(a, b time.Duration) time.Duration {
+		if a == 0 || (b != 0 && b < a) {
+			return b
+		}
+		return a
+	}
+	return Target{
+		FirstResponse: pick(t.FirstResponse, o.FirstResponse),
+		Wait:          pick(t.Wait, o.Wait),
+		Resolution:    pick(t.Resolution, o.Resolution),
+	}
+}
+
+// Policy holds the targets tickets are held to
+type Policy struct {
+	Default Target `json:"default"`
+
+	// Mailboxes override the default for tickets in a mailbox
+	Mailboxes map[int]Target `json:"mailboxes,omitempty"`
+
+	// Tags override the mailbox and default targets for tickets with a tag.
+	// When a ticket has more than one of them the strictest target wins
+	Tags map[string]Target `json:"tags,omitempty"`
+
+	// Calendar limits the measurements to business hours when set
+	Calendar *calendar.Calendar `json:"calendar,omitempty"`
+}
+
+// TargetFor returns the targets that apply to a ticket
+func (p Policy) TargetFor(t snappy.Ticket) Target {
+	target := p.Default
+
+	if m, ok := p.Mailboxes[t.MailboxID]; ok {
+		target = target.override(m)
+	}
+
+	var tagged Target
+	for _, tag := range t.Tags {
+		if tt, ok := p.Tags[strings.ToLower(tag)]; ok {
+			tagged = tagged.strictest(tt)
+		} else if tt, ok := p.Tags[tag]; ok {
+			tagged = tagged.strictest(tt)
+		}
+	}
+
+	return target.override(tagged)
+}
+
+// Breach is a metric that went over its target
+type Breach struct {
+	Metric Metric
+	Target time.Duration
+	Actual time.Duration
+
+	// Pending is set when the clock is still running, e.g. a ticket that
+	// nobody has replied to yet
+	Pending bool
+}
+
+// Result is what was measured for a ticket
+type Result struct {
+	TicketID  int
+	MailboxID int
+	Tags      []string
+	Target    Target
+
+	FirstResponse time.Duration
+	Responded     bool
+
+	Wait    time.Duration
+	Waiting bool
+
+	Resolution time.Duration
+	Resolved   bool
+
+	// Due holds when each metric that is still running hits its target
+	Due map[Metric]time.Time
+
+	Breaches []Breach
+}
+
+// Breached reports whether a metric went over its target
+func (r Result) Breached(m Metric) bool {
+	for _, b := range r.Breaches {
+		if b.Metric == m {
+			return true
+		}
+	}
+	return false
+}
+
+// Calculator measures tickets against a Policy
+type Calculator struct {
+	Policy Policy
+
+	// Now is used for the metrics that are still running, time.Now unless set
+	Now func() time.Time
+
+	// Location is the time zone of the string timestamps, UTC unless set
+	Location *time.Location
+}
+
+// New creates a Calculator
+func New(policy Policy) *Calculator {
+	return &Calculator{Policy: policy}
+}
+
+func (c *Calculator) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// parseTime parses one of the string timestamps, reporting false for empty
+// or malformed ones
+func (c *Calculator) parseTime(s string) (time.Time, bool) {
+	loc := c.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	t, err := time.ParseInLocation(snappy.TimeLayout, s, loc)
+	return t, err == nil
+}
+
+// elapsed is the time between two instants, never negative
+func (c *Calculator) elapsed(from, to time.Time) time.Duration {
+	if to.Before(from) {
+		return 0
+	}
+	if c.Policy.Calendar != nil {
+		return c.Policy.Calendar.Duration(from, to)
+	}
+	return to.Sub(from)
+}
+
+// due is when a target that started counting at from runs out
+func (c *Calculator) due(from time.Time, target time.Duration) time.Time {
+	if c.Policy.Calendar != nil {
+		return c.Policy.Calendar.Add(from, target)
+	}
+	return from.Add(target)
+}
+
+// Ticket measures a single ticket
+func (c *Calculator) Ticket(t snappy.Ticket) Result {
+	now := c.now()
+	opened := time.Unix(int64(t.OpenedAt), 0)
+
+	r := Result{
+		TicketID:  t.ID,
+		MailboxID: t.MailboxID,
+		Tags:      t.Tags,
+		Target:    c.Policy.TargetFor(t),
+	}
+
+	closed := t.Status == "closed"
+
+	if replied, ok := c.parseTime(t.FirstStaffReplyAt); ok {
+		r.FirstResponse = c.elapsed(opened, replied)
+		r.Responded = true
+	} else if !closed {
+		r.FirstResponse = c.elapsed(opened, now)
+	}
+
+	if t.LastReplyBy == "customer" && !closed && t.LastReplyAt != 0 {
+		r.Wait = c.elapsed(time.Unix(int64(t.LastReplyAt), 0), now)
+		r.Waiting = true
+	}
+
+	if updated, ok := c.parseTime(t.UpdatedAt); ok && closed {
+		r.Resolution = c.elapsed(opened, updated)
+		r.Resolved = true
+	}
+
+	check := func(m Metric, actual time.Duration, pending bool) {
+		if target := r.Target.get(m); target != 0 && actual > target {
+			r.Breaches = append(r.Breaches, Breach{Metric: m, Target: target, Actual: actual, Pending: pending})
+		}
+	}
+
+	r.Due = map[Metric]time.Time{}
+	due := func(m Metric, from time.Time) {
+		if target := r.Target.get(m); target != 0 {
+			if at := c.due(from, target); !at.IsZero() {
+				r.Due[m] = at
+			}
+		}
+	}
+
+	if !r.Responded && !closed {
+		due(FirstResponse, opened)
+	}
+	if r.Waiting {
+		due(Wait, time.Unix(int64(t.LastReplyAt), 0))
+	}
+	if !closed {
+		due(Resolution, opened)
+	}
+
+	if r.Responded || !closed {
+		check(FirstResponse, r.FirstResponse, !r.Responded)
+	}
+	if r.Waiting {
+		check(Wait, r.Wait, true)
+	}
+	if r.Resolved {
+		check(Resolution, r.Resolution, false)
+	}
+
+	return r
+}
+
+// Tickets measures a list of tickets
+func (c *Calculator) Tickets(tickets []snappy.Ticket) []Result {
+	results := make([]Result, 0, len(tickets))
+	for _, t := range tickets {
+		results = append(results, c.Ticket(t))
+	}
+	return results
+}
+
+// Distribution describes a set of durations
+type Distribution struct {
+	Count int
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// Distribute computes the distribution of durations
+func Distribute(durations []time.Duration) Distribution {
+	if len(durations) == 0 {
+		return Distribution{}
+	}
+
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	return Distribution{
+		Count: len(sorted),
+		Min:   sorted[0],
+		Max:   sorted[len(sorted)-1],
+		Mean:  total / time.Duration(len(sorted)),
+		P50:   percentile(sorted, 50),
+		P90:   percentile(sorted, 90),
+		P95:   percentile(sorted, 95),
+		P99:   percentile(sorted, 99),
+	}
+}
+
+// percentile interpolates between the closest ranks of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(rank)
+	if lo+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+
+	frac := rank - float64(lo)
+	return sorted[lo] + time.Duration(math.Round(frac*float64(sorted[lo+1]-sorted[lo])))
+}
+
+// Summary aggregates the results of many tickets
+type Summary struct {
+	Tickets int
+
+	// the distributions only include tickets where the metric is known:
+	// answered tickets, waiting tickets and closed tickets
+	FirstResponse Distribution
+	Wait          Distribution
+	Resolution    Distribution
+
+	Breaches map[Metric]int
+}
+
+// Summarize aggregates results
+func Summarize(results []Result) Summary {
+	s := Summary{
+		Tickets:  len(results),
+		Breaches: map[Metric]int{},
+	}
+
+	var first, wait, resolution []time.Duration
+
+	for _, r := range results {
+		if r.Responded {
+			first = append(first, r.FirstResponse)
+		}
+		if r.Waiting {
+			wait = append(wait, r.Wait)
+		}
+		if r.Resolved {
+			resolution = append(resolution, r.Resolution)
+		}
+		for _, b := range r.Breaches {
+			s.Breaches[b.Metric]++
+		}
+	}
+
+	s.FirstResponse = Distribute(first)
+	s.Wait = Distribute(wait)
+	s.Resolution = Distribute(resolution)
+
+	return s
+}
+
+// SummarizeByMailbox aggregates results per mailbox
+func SummarizeByMailbox(results []Result) map[int]Summary {
+	byMailbox := map[int][]Result{}
+	for _, r := range results {
+		byMailbox[r.MailboxID] = append(byMailbox[r.MailboxID], r)
+	}
+
+	summaries := map[int]Summary{}
+	for id, rs := range byMailbox {
+		summaries[id] = Summarize(rs)
+	}
+	return summaries
+}
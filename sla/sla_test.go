@@ -0,0 +1,199 @@
+package sla
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/calendar"
+)
+
+var now = time.Date(2014, 1, 2, 12, 0, 0, 0, time.UTC)
+
+func unix(s string) int {
+	t, _ := time.Parse(snappy.TimeLayout, s)
+	return int(t.Unix())
+}
+
+func testCalculator() *Calculator {
+	c := New(Policy{
+		Default:   Target{FirstResponse: 4 * time.Hour, Wait: 8 * time.Hour},
+		Mailboxes: map[int]Target{2: Target{FirstResponse: time.Hour, Resolution: 24 * time.Hour}},
+		Tags: map[string]Target{
+			"#vip":    Target{FirstResponse: 15 * time.Minute},
+			"#urgent": Target{FirstResponse: 30 * time.Minute, Wait: time.Hour},
+		},
+	})
+	c.Now = func() time.Time { return now }
+	return c
+}
+
+func TestTargetFor(t *testing.T) {
+	p := testCalculator().Policy
+
+	cases := []struct {
+		ticket   snappy.Ticket
+		expected Target
+	}{
+		{snappy.Ticket{MailboxID: 1}, Target{FirstResponse: 4 * time.Hour, Wait: 8 * time.Hour}},
+		{snappy.Ticket{MailboxID: 2}, Target{FirstResponse: time.Hour, Wait: 8 * time.Hour, Resolution: 24 * time.Hour}},
+		{snappy.Ticket{MailboxID: 2, Tags: []string{"#VIP", "#urgent"}}, Target{FirstResponse: 15 * time.Minute, Wait: time.Hour, Resolution: 24 * time.Hour}},
+	}
+
+	for _, c := range cases {
+		if got := p.TargetFor(c.ticket); reflect.DeepEqual(c.expected, got) == false {
+			t.Errorf("TargetFor(%v): expected %+v, got %+v", c.ticket.Tags, c.expected, got)
+		}
+	}
+}
+
+func TestTicket(t *testing.T) {
+	c := testCalculator()
+
+	answered := c.Ticket(snappy.Ticket{
+		ID:                1,
+		MailboxID:         1,
+		OpenedAt:          unix("2014-01-02 08:00:00"),
+		FirstStaffReplyAt: "2014-01-02 09:30:00",
+		LastReplyBy:       "customer",
+		LastReplyAt:       unix("2014-01-02 02:00:00"),
+		Status:            "waiting",
+	})
+
+	if !answered.Responded || answered.FirstResponse != 90*time.Minute {
+		t.Errorf("Expected a 90 minute first response, got %v", answered.FirstResponse)
+	}
+	if !answered.Waiting || answered.Wait != 10*time.Hour {
+		t.Errorf("Expected a 10 hour wait, got %v", answered.Wait)
+	}
+	if expected := []Breach{{Metric: Wait, Target: 8 * time.Hour, Actual: 10 * time.Hour, Pending: true}}; reflect.DeepEqual(expected, answered.Breaches) == false {
+		t.Errorf("Expected breaches %+v, got %+v", expected, answered.Breaches)
+	}
+
+	unanswered := c.Ticket(snappy.Ticket{
+		ID:        2,
+		MailboxID: 2,
+		OpenedAt:  unix("2014-01-02 10:00:00"),
+		Status:    "new",
+	})
+
+	if unanswered.Responded || !unanswered.Breached(FirstResponse) || !unanswered.Breaches[0].Pending {
+		t.Errorf("Expected a pending first response breach, got %+v", unanswered)
+	}
+
+	closed := c.Ticket(snappy.Ticket{
+		ID:                3,
+		MailboxID:         2,
+		OpenedAt:          unix("2013-12-30 10:00:00"),
+		FirstStaffReplyAt: "2013-12-30 10:30:00",
+		UpdatedAt:         "2014-01-01 10:00:00",
+		LastReplyBy:       "customer",
+		Status:            "closed",
+	})
+
+	if !closed.Resolved || closed.Resolution != 48*time.Hour || closed.Waiting {
+		t.Errorf("Expected a 48 hour resolution and no wait, got %+v", closed)
+	}
+	if closed.Breached(FirstResponse) || !closed.Breached(Resolution) {
+		t.Errorf("Expected only a resolution breach, got %+v", closed.Breaches)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	var results []Result
+	for i := 1; i <= 10; i++ {
+		results = append(results, Result{
+			MailboxID:     i % 2,
+			FirstResponse: time.Duration(i) * time.Minute,
+			Responded:     true,
+		})
+	}
+	results[9].Breaches = []Breach{{Metric: FirstResponse}}
+
+	s := Summarize(results)
+
+	expected := Distribution{
+		Count: 10,
+		Min:   time.Minute,
+		Max:   10 * time.Minute,
+		Mean:  330 * time.Second,
+		P50:   330 * time.Second,
+		P90:   546 * time.Second,
+		P95:   573 * time.Second,
+		P99:   594600 * time.Millisecond,
+	}
+
+	if reflect.DeepEqual(expected, s.FirstResponse) == false {
+		t.Errorf("Expected %+v, got %+v", expected, s.FirstResponse)
+	}
+	if s.Breaches[FirstResponse] != 1 || s.Wait.Count != 0 {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+
+	byMailbox := SummarizeByMailbox(results)
+	if len(byMailbox) != 2 || byMailbox[0].Tickets != 5 || byMailbox[0].Breaches[FirstResponse] != 1 {
+		t.Errorf("Unexpected mailbox summaries %+v", byMailbox)
+	}
+}
+
+func TestPolicyJSON(t *testing.T) {
+	var p Policy
+	err := json.Unmarshal([]byte(`{"default":{"first_response":"4h"},"mailboxes":{"2":{"wait":"30m"}},"tags":{"#vip":{"resolution":"1h30m"}}}`), &p)
+	if err != nil {
+		t.Fatalf("Expected no error in Unmarshal(), got %v", err)
+	}
+
+	expected := Policy{
+		Default:   Target{FirstResponse: 4 * time.Hour},
+		Mailboxes: map[int]Target{2: Target{Wait: 30 * time.Minute}},
+		Tags:      map[string]Target{"#vip": Target{Resolution: 90 * time.Minute}},
+	}
+
+	if reflect.DeepEqual(expected, p) == false {
+		t.Errorf("Expected %+v, got %+v", expected, p)
+	}
+
+	b, _ := json.Marshal(p.Default)
+	if string(b) != `{"first_response":"4h0m0s"}` {
+		t.Errorf("Unexpected json %s", b)
+	}
+
+	if err := json.Unmarshal([]byte(`{"wait":"soon"}`), &Target{}); err == nil {
+		t.Errorf("Expected an error for a bad duration")
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	c := testCalculator()
+	c.Policy.Calendar = calendar.Standard(time.UTC)
+
+	// opened Friday 3pm, now is Monday 10am: 3 business hours
+	c.Now = func() time.Time { return time.Date(2014, 1, 6, 10, 0, 0, 0, time.UTC) }
+
+	r := c.Ticket(snappy.Ticket{
+		ID:          1,
+		MailboxID:   1,
+		OpenedAt:    unix("2014-01-03 15:00:00"),
+		LastReplyBy: "customer",
+		LastReplyAt: unix("2014-01-03 15:00:00"),
+		Status:      "new",
+	})
+
+	if r.FirstResponse != 3*time.Hour || r.Wait != 3*time.Hour {
+		t.Errorf("Expected 3 business hours, got %v and %v", r.FirstResponse, r.Wait)
+	}
+
+	if len(r.Breaches) != 0 {
+		t.Errorf("Expected no breaches, got %+v", r.Breaches)
+	}
+
+	expected := map[Metric]time.Time{
+		FirstResponse: time.Date(2014, 1, 6, 11, 0, 0, 0, time.UTC),
+		Wait:          time.Date(2014, 1, 6, 15, 0, 0, 0, time.UTC),
+	}
+	if reflect.DeepEqual(expected, r.Due) == false {
+		t.Errorf("Expected due times %v, got %v", expected, r.Due)
+	}
+}
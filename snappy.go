@@ -3,7 +3,6 @@ package snappy
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -28,6 +27,10 @@ const (
 	version              = "0.0.1"
 )
 
+// TimeLayout is the layout of the timestamps Snappy sends as strings, like
+// a ticket's updated_at
+const TimeLayout = "2006-01-02 15:04:05"
+
 // WithAPIKey creates a new snappy client using your API key
 func WithAPIKey(apiKey string) *Snappy {
 	return &Snappy{
@@ -46,6 +49,44 @@ func WithUsernameAndPassword(username, password string) *Snappy {
 	}
 }
 
+// StatusError is returned when the API responds with anything other than a 200
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Status NOT OK (%d %s)", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// IsUnauthorized reports whether err is a StatusError for a 401 or 403
+func IsUnauthorized(err error) bool {
+	se, ok := err.(*StatusError)
+	return ok && (se.StatusCode == http.StatusUnauthorized || se.StatusCode == http.StatusForbidden)
+}
+
+// IsNotFound reports whether err is a StatusError for a 404
+func IsNotFound(err error) bool {
+	se, ok := err.(*StatusError)
+	return ok && se.StatusCode == http.StatusNotFound
+}
+
+// IsRateLimited reports whether err is a StatusError for a 429
+func IsRateLimited(err error) bool {
+	se, ok := err.(*StatusError)
+	return ok && se.StatusCode == http.StatusTooManyRequests
+}
+
+// IsServerError reports whether err is a StatusError for a 5xx
+func IsServerError(err error) bool {
+	se, ok := err.(*StatusError)
+	return ok && se.StatusCode >= http.StatusInternalServerError
+}
+
+// SetEndpointPrefix points the client at a different API root, e.g. a proxy or a test server
+func (s *Snappy) SetEndpointPrefix(endpointPrefix string) {
+	s.endpointPrefix = strings.TrimRight(endpointPrefix, "/")
+}
+
 func (up urlAndParams) finalURL(endpointPrefix string) string {
 	fullURL := fmt.Sprintf("%s%s", endpointPrefix, up.url)
 
@@ -80,7 +121,8 @@ func (s *Snappy) doRequest(requestType string, up urlAndParams, contentType stri
 	// TODO: double check to see if their api returns anything other
 	// than a 200 when a request is bad
 	if res.StatusCode != http.StatusOK {
-		return nil, errors.New("Status NOT OK")
+		res.Body.Close()
+		return nil, &StatusError{StatusCode: res.StatusCode}
 	}
 
 	return res.Body, nil
@@ -66,3 +66,41 @@ func TestStatusNotOk(t *testing.T) {
 		t.Error("expected err != nil")
 	}
 }
+
+func TestStatusErrorKinds(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	_, err := client.Accounts()
+
+	if !IsUnauthorized(err) {
+		t.Errorf("expected IsUnauthorized, got %v", err)
+	}
+
+	if IsNotFound(err) || IsRateLimited(err) || IsServerError(err) {
+		t.Error("expected only IsUnauthorized to match")
+	}
+
+	if se, ok := err.(*StatusError); !ok || se.StatusCode != http.StatusUnauthorized {
+		t.Error("expected a *StatusError with StatusCode 401")
+	}
+}
+
+func TestActionErrorDoesNotPanic(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	err := client.LikeWallPost(1, 1)
+
+	if !IsServerError(err) {
+		t.Errorf("expected IsServerError, got %v", err)
+	}
+}
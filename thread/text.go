@@ -0,0 +1,146 @@
+package thread
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/render"
+)
+
+// tidy trims trailing space from lines and squeezes runs of blank lines
+func tidy(s string) string {
+	var lines []string
+	blank := false
+
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimRight(l, " ")
+		if strings.Trim(l, "> ") == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, l)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+var (
+	// attribution lines mail clients put above quoted replies
+	attribution = regexp.MustCompile(`(?i)^(on .+ wrote:|.+ wrote:|from: .+)$`)
+
+	// separators that always start quoted history
+	separator = regexp.MustCompile(`(?i)^(-+ ?original message ?-+|_{10,})$`)
+
+	// sign offs that start a signature when they are near the end
+	signOff = regexp.MustCompile(`(?i)^(thanks|thank you|regards|best|cheers|best regards|kind regards|sent from my .+)[,.!]?$`)
+)
+
+// signOffLines is how close to the end a sign off has to be to count
+const signOffLines = 6
+
+// signatureWords and signatureLength are the most a line after a sign off
+// can have and still be taken for a name or signature rather than more of
+// the message
+const (
+	signatureWords  = 5
+	signatureLength = 40
+)
+
+// stripQuotes removes quoted history and the signature from a plain text
+// message. signature is the author's own, empty when they have none
+func stripQuotes(text string, signature string) string {
+	text = cutSignature(text, signature)
+
+	lines := strings.Split(text, "\n")
+	var kept []string
+
+	for i, l := range lines {
+		trimmed := strings.TrimSpace(l)
+
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+
+		if separator.MatchString(trimmed) || (attribution.MatchString(trimmed) && restIsQuote(lines[i+1:])) {
+			break
+		}
+
+		if trimmed == "--" || (signOff.MatchString(trimmed) && len(lines)-i <= signOffLines && restIsSignature(lines[i+1:])) {
+			break
+		}
+
+		kept = append(kept, l)
+	}
+
+	return strings.TrimSpace(tidy(strings.Join(kept, "\n")))
+}
+
+// restIsQuote reports whether what follows an attribution line looks like
+// quoted history rather than the person's own words
+func restIsQuote(rest []string) bool {
+	for _, l := range rest {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		return strings.HasPrefix(l, ">") || attribution.MatchString(l) || strings.Contains(l, ":")
+	}
+	return true
+}
+
+// restIsSignature reports whether what follows a sign off is only a name or
+// signature block, up to any quoted history
+func restIsSignature(rest []string) bool {
+	for _, l := range rest {
+		l = strings.TrimSpace(l)
+		switch {
+		case l == "" || strings.HasPrefix(l, ">"):
+			continue
+		case separator.MatchString(l) || attribution.MatchString(l):
+			return true
+		case len(strings.Fields(l)) > signatureWords || utf8.RuneCountInString(l) > signatureLength:
+			return false
+		}
+	}
+	return true
+}
+
+// cutSignature cuts text at signature when it starts a line near the end,
+// not counting quoted history after it
+func cutSignature(text, signature string) string {
+	sig := strings.TrimSpace(render.NoteText(snappy.Note{Content: signature}))
+	if sig == "" {
+		return text
+	}
+
+	for end := len(text); end > 0; {
+		i := strings.LastIndex(text[:end], sig)
+		if i < 0 {
+			break
+		}
+
+		lineStart := strings.LastIndex(text[:i], "\n") + 1
+		if strings.TrimSpace(text[lineStart:i]) == "" && ownLines(text[i+len(sig):]) <= signOffLines {
+			return text[:i]
+		}
+		end = i
+	}
+
+	return text
+}
+
+// ownLines counts the lines of s that aren't blank or quoted
+func ownLines(s string) (n int) {
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, ">") {
+			n++
+		}
+	}
+	return
+}
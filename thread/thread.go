@@ -0,0 +1,177 @@
+// Package thread turns a ticket and its notes into a readable conversation:
+// notes in order, each attributed to a staff member or a contact, with the
+// quoted history and signatures that mail clients add taken out.
+package thread
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/render"
+)
+
+// Author is whoever wrote a message
+type Author struct {
+	Name      string
+	Address   string
+	Staff     bool
+	StaffID   int
+	ContactID int
+}
+
+func (a Author) String() string {
+	switch {
+	case a.Name != "" && a.Address != "":
+		return fmt.Sprintf("%s <%s>", a.Name, a.Address)
+	case a.Name != "":
+		return a.Name
+	case a.Address != "":
+		return a.Address
+	}
+	return "unknown"
+}
+
+// Message is a single note in a thread
+type Message struct {
+	NoteID  int
+	Time    time.Time
+	Author  Author
+	Private bool
+
+	// Text is the note's own words as plain text
+	Text string
+
+	Attachments []snappy.Document
+}
+
+// Thread is a ticket's conversation
+type Thread struct {
+	Ticket   snappy.Ticket
+	Messages []Message
+}
+
+// New builds a thread. staff is optional, it is used to name staff members
+// and to strip their signatures from their own notes
+func New(t snappy.Ticket, notes []snappy.Note, staff []snappy.Employee) *Thread {
+	employees := map[int]snappy.Employee{}
+	for _, e := range staff {
+		employees[e.ID] = e
+	}
+
+	sorted := append([]snappy.Note{}, notes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].CreatedAt != sorted[j].CreatedAt {
+			return sorted[i].CreatedAt < sorted[j].CreatedAt
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	th := &Thread{Ticket: t}
+
+	for _, n := range sorted {
+		th.Messages = append(th.Messages, Message{
+			NoteID:      n.ID,
+			Time:        time.Unix(int64(n.CreatedAt), 0).UTC(),
+			Author:      author(n, employees),
+			Private:     n.Scope == "private",
+			Text:        stripQuotes(render.NoteText(n), employees[n.CreatedByStaffID].Signature),
+			Attachments: n.Attachments,
+		})
+	}
+
+	return th
+}
+
+func author(n snappy.Note, employees map[int]snappy.Employee) Author {
+	a := Author{
+		Name:      strings.TrimSpace(n.Creator.FirstName + " " + n.Creator.LastName),
+		Address:   n.Creator.Address,
+		StaffID:   n.CreatedByStaffID,
+		ContactID: n.CreatedByContactID,
+		Staff:     n.CreatedByStaffID != 0,
+	}
+
+	if e, ok := employees[n.CreatedByStaffID]; ok && a.Staff {
+		a.Name = strings.TrimSpace(e.FirstName + " " + e.LastName)
+		a.Address = e.Email
+	}
+
+	return a
+}
+
+func (m Message) role() string {
+	role := "customer"
+	if m.Author.Staff {
+		role = "staff"
+	}
+	if m.Private {
+		role += ", private"
+	}
+	return role
+}
+
+const timeFormat = "2006-01-02 15:04 MST"
+
+// Text renders the thread as a plain text transcript
+func (th *Thread) Text() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s (#%d)\n", th.Ticket.DefaultSubject, th.Ticket.ID)
+
+	for _, m := range th.Messages {
+		fmt.Fprintf(&b, "\n--- %s (%s) %s\n\n", m.Author, m.role(), m.Time.Format(timeFormat))
+		if m.Text != "" {
+			b.WriteString(m.Text)
+			b.WriteString("\n")
+		}
+		for _, a := range m.Attachments {
+			fmt.Fprintf(&b, "[attachment: %s]\n", a.Filename)
+		}
+	}
+
+	return b.String()
+}
+
+// markdownSpecial are characters that change the meaning of a line when it starts with them
+const markdownSpecial = "#>-*+|`=~_"
+
+func escapeMarkdownLine(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if trimmed != "" && strings.ContainsRune(markdownSpecial, rune(trimmed[0])) {
+		return line[:len(line)-len(trimmed)] + "\\" + trimmed
+	}
+	return line
+}
+
+// Markdown renders the thread as a Markdown transcript
+func (th *Thread) Markdown() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s (#%d)\n", th.Ticket.DefaultSubject, th.Ticket.ID)
+
+	for i, m := range th.Messages {
+		if i > 0 {
+			b.WriteString("\n---\n")
+		}
+
+		fmt.Fprintf(&b, "\n**%s** (%s) — %s\n\n", m.Author, m.role(), m.Time.Format(timeFormat))
+
+		for _, line := range strings.Split(m.Text, "\n") {
+			if line == "" {
+				b.WriteString("\n")
+				continue
+			}
+			// two trailing spaces keep the line breaks of the original message
+			b.WriteString(escapeMarkdownLine(line) + "  \n")
+		}
+
+		for _, a := range m.Attachments {
+			fmt.Fprintf(&b, "\n- attachment: `%s`\n", a.Filename)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,165 @@
+package thread
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/derekpitt/snappy"
+)
+
+func testThread() *Thread {
+	ticket := snappy.Ticket{ID: 7, DefaultSubject: "Printer on fire"}
+
+	notes := []snappy.Note{
+		snappy.Note{
+			ID:               2,
+			CreatedAt:        200,
+			CreatedByStaffID: 5,
+			Content:          "<p>Have you tried water?</p><p>Jane Doe<br>Support</p><blockquote><p>It is on fire</p></blockquote>",
+		},
+		snappy.Note{
+			ID:                 1,
+			CreatedAt:          100,
+			CreatedByContactID: 9,
+			Creator:            snappy.Contact{FirstName: "Test", LastName: "One", Address: "test1@test.com"},
+			Content:            "<p>My printer is on fire</p><p>Thanks,<br>Test</p>",
+			Attachments:        []snappy.Document{snappy.Document{Filename: "fire.jpg"}},
+		},
+		snappy.Note{
+			ID:                 3,
+			CreatedAt:          300,
+			CreatedByContactID: 9,
+			Creator:            snappy.Contact{FirstName: "Test", LastName: "One", Address: "test1@test.com"},
+			Content:            "# That worked\n\nOn Mon, Jan 6, 2014 at 10:00 AM Jane Doe <jane@test.com> wrote:\n> Have you tried water?\n",
+		},
+		snappy.Note{
+			ID:               4,
+			CreatedAt:        300,
+			CreatedByStaffID: 5,
+			Scope:            "private",
+			Content:          "closing this one\n-- \nJane",
+		},
+	}
+
+	staff := []snappy.Employee{
+		snappy.Employee{ID: 5, FirstName: "Jane", LastName: "Doe", Email: "jane@test.com", Signature: "<p>Jane Doe<br>Support</p>"},
+	}
+
+	return New(ticket, notes, staff)
+}
+
+func TestNew(t *testing.T) {
+	th := testThread()
+
+	var ids []int
+	var texts []string
+	for _, m := range th.Messages {
+		ids = append(ids, m.NoteID)
+		texts = append(texts, m.Text)
+	}
+
+	if expected := []int{1, 2, 3, 4}; reflect.DeepEqual(expected, ids) == false {
+		t.Errorf("Expected notes in order %v, got %v", expected, ids)
+	}
+
+	expectedTexts := []string{
+		"My printer is on fire",
+		"Have you tried water?",
+		"# That worked",
+		"closing this one",
+	}
+	if reflect.DeepEqual(expectedTexts, texts) == false {
+		t.Errorf("Expected texts %q, got %q", expectedTexts, texts)
+	}
+
+	contact := th.Messages[0].Author
+	if contact.Staff || contact.ContactID != 9 || contact.String() != "Test One <test1@test.com>" {
+		t.Errorf("Expected a contact author, got %+v", contact)
+	}
+
+	staff := th.Messages[1].Author
+	if !staff.Staff || staff.StaffID != 5 || staff.String() != "Jane Doe <jane@test.com>" {
+		t.Errorf("Expected a staff author, got %+v", staff)
+	}
+
+	if th.Messages[1].Private || !th.Messages[3].Private {
+		t.Errorf("Expected only the last note to be private")
+	}
+}
+
+func TestStripQuotes(t *testing.T) {
+	cases := map[string]string{
+		"Sounds good\n\nFrom: Jane <jane@test.com>\nSent: Monday\nSubject: Re: help\n\nold stuff": "Sounds good",
+		"Sounds good\n\n-----Original Message-----\nold stuff":                                    "Sounds good",
+		"Here is the log:\nerror: out of paper\n\nCheers":                                         "Here is the log:\nerror: out of paper",
+		"Joe wrote: this is my own sentence\nand it goes on":                                      "Joe wrote: this is my own sentence\nand it goes on",
+		"Fixed\n\nSent from my phone":                                                             "Fixed",
+		"It works now\n\nThanks,\nSam Smith\nHead of Support, Acme Inc.\n+1 555 123 4567":         "It works now",
+		"It works now\nThanks! Also, the order number is 1234":                                    "It works now\nThanks! Also, the order number is 1234",
+		"It works now\n\nThanks!\nAlso, the order number is 1234 if you need it":                  "It works now\n\nThanks!\nAlso, the order number is 1234 if you need it",
+	}
+
+	for in, expected := range cases {
+		if got := stripQuotes(in, ""); got != expected {
+			t.Errorf("stripQuotes(%q): expected %q, got %q", in, expected, got)
+		}
+	}
+}
+
+func TestSignatureOnlyOwnNotes(t *testing.T) {
+	notes := []snappy.Note{
+		{ID: 1, CreatedAt: 100, CreatedByContactID: 9, Content: "<p>Jane Doe from Support said to write in.</p><p>Jane Doe<br>Support</p><p>My order is 1234</p>"},
+		{ID: 2, CreatedAt: 200, CreatedByStaffID: 6, Content: "<p>On it</p><p>Jane Doe<br>Support</p>"},
+		{ID: 3, CreatedAt: 300, CreatedByStaffID: 5, Content: "<p>Jane Doe<br>Support told me to check</p><p>Thanks</p><p>Jane Doe<br>Support</p>" + strings.Repeat("<p>more words here</p>", 7)},
+	}
+	staff := []snappy.Employee{
+		{ID: 5, Signature: "<p>Jane Doe<br>Support</p>"},
+		{ID: 6, Signature: "<p>Sam</p>"},
+	}
+
+	th := New(snappy.Ticket{ID: 7}, notes, staff)
+
+	expected := []string{
+		"Jane Doe from Support said to write in.\n\nJane Doe\nSupport\n\nMy order is 1234",
+		"On it\n\nJane Doe\nSupport",
+	}
+	for i, want := range expected {
+		if got := th.Messages[i].Text; got != want {
+			t.Errorf("Message %d: expected %q, got %q", i, want, got)
+		}
+	}
+
+	// a signature far from the end is the author's own words
+	if !strings.Contains(th.Messages[2].Text, "more words here") {
+		t.Errorf("Expected the note not to be cut, got %q", th.Messages[2].Text)
+	}
+}
+
+func TestRender(t *testing.T) {
+	th := testThread()
+
+	text := th.Text()
+	for _, want := range []string{
+		"Printer on fire (#7)",
+		"--- Test One <test1@test.com> (customer) 1970-01-01 00:01 UTC",
+		"--- Jane Doe <jane@test.com> (staff, private)",
+		"[attachment: fire.jpg]",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected text transcript to contain %q, got:\n%s", want, text)
+		}
+	}
+
+	md := th.Markdown()
+	for _, want := range []string{
+		"# Printer on fire (#7)",
+		"**Jane Doe <jane@test.com>** (staff)",
+		"\\# That worked  \n",
+		"- attachment: `fire.jpg`",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Expected markdown transcript to contain %q, got:\n%s", want, md)
+		}
+	}
+}
@@ -27,11 +27,20 @@ type Ticket struct {
 	Tags              []string `json:"tags"`
 	TicketNonce       string   `json:"nonce"`
 
+	NextRecipients Recipients `json:"next_recipients"`
+
 	Contacts []Contact `json:"contacts"`
 	Mailbox  Mailbox   `json:"mailbox"`
 	Opener   Contact   `json:"opener"`
 }
 
+// Recipients holds who the next reply to a ticket goes to
+type Recipients struct {
+	To  []NoteAddress `json:"to"`
+	Cc  []NoteAddress `json:"cc"`
+	Bcc []NoteAddress `json:"bcc"`
+}
+
 // Ticket gets the details of a ticket
 func (s *Snappy) Ticket(ticketID int) (ticket Ticket, err error) {
 	up := urlAndParams{
@@ -109,6 +118,11 @@ func (s *Snappy) UpdateTags(ticketID int, tags ...string) (err error) {
 	rc, err := s.postForm(up, map[string][]string{
 		"tags": []string{string(b)},
 	})
+
+	if err != nil {
+		return
+	}
+
 	defer rc.Close()
 
 	return
@@ -0,0 +1,561 @@
+// Package triage is a full screen terminal interface for working through the
+// tickets in a mailbox. It only uses plain ANSI escape codes, and reads keys
+// from any io.Reader so it can be driven by a test as easily as by a
+// terminal in raw mode.
+//
+// Keys in the ticket list:
+//
+//	j, down    next ticket
+//	k, up      previous ticket
+//	enter      open the ticket's notes
+//	tab        switch between the inbox and your tickets
+//	r          refresh
+//	q          quit
+//
+// Keys in a ticket:
+//
+//	j, k       scroll
+//	t          change tags, e.g. "+#billing -@someone"
+//	R          reply to the ticket
+//	d          download an attachment
+//	q, esc     back to the list
+//
+// The Snappy API has no way to change a ticket's status, so that is left out.
+package triage
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/derekpitt/snappy"
+	"github.com/derekpitt/snappy/render"
+)
+
+const (
+	clearScreen = "\x1b[2J\x1b[H"
+	reverse     = "\x1b[7m"
+	bold        = "\x1b[1m"
+	reset       = "\x1b[0m"
+
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	leaveAltScreen = "\x1b[?25h\x1b[?1049l"
+)
+
+// keys that don't map to a single printable byte
+const (
+	keyUp    = "up"
+	keyDown  = "down"
+	keyEnter = "enter"
+	keyEsc   = "esc"
+	keyTab   = "tab"
+	keyBack  = "backspace"
+	keyCtrlC = "ctrl-c"
+)
+
+type view int
+
+const (
+	listView view = iota
+	ticketView
+)
+
+type listing struct {
+	name  string
+	fetch func(*snappy.Snappy, int) ([]snappy.Ticket, error)
+}
+
+var listings = []listing{
+	{"inbox", (*snappy.Snappy).InboxAtMailbox},
+	{"yours", (*snappy.Snappy).YoursAtMailbox},
+}
+
+// UI holds the state of a triage session
+type UI struct {
+	// Width and Height of the terminal, 80x24 unless set
+	Width, Height int
+
+	// StaffID replies are sent as. 0 lets Snappy pick
+	StaffID int
+
+	// DownloadDir is where attachments are saved, the working directory unless set
+	DownloadDir string
+
+	client    *snappy.Snappy
+	mailboxID int
+	in        *bufio.Reader
+	out       io.Writer
+
+	view     view
+	listing  int
+	tickets  []snappy.Ticket
+	selected int
+	top      int
+	notes    []snappy.Note
+	scroll   int
+	message  string
+}
+
+// New creates a triage UI for a mailbox, reading keys from in and drawing to out
+func New(client *snappy.Snappy, mailboxID int, in io.Reader, out io.Writer) *UI {
+	return &UI{
+		Width:     80,
+		Height:    24,
+		client:    client,
+		mailboxID: mailboxID,
+		in:        bufio.NewReader(in),
+		out:       out,
+	}
+}
+
+// Run draws the UI and handles keys until q is pressed or in runs out
+func (u *UI) Run() error {
+	io.WriteString(u.out, enterAltScreen)
+	defer io.WriteString(u.out, leaveAltScreen)
+
+	u.refresh()
+
+	for {
+		u.draw()
+
+		key, err := u.readKey()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if quit := u.handle(key); quit {
+			return nil
+		}
+	}
+}
+
+// readKey reads one key press, turning escape sequences into names
+func (u *UI) readKey() (string, error) {
+	b, err := u.in.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	switch b {
+	case '\r', '\n':
+		return keyEnter, nil
+	case '\t':
+		return keyTab, nil
+	case 127, 8:
+		return keyBack, nil
+	case 3:
+		return keyCtrlC, nil
+	case 27:
+		if u.in.Buffered() == 0 {
+			return keyEsc, nil
+		}
+
+		if next, _ := u.in.ReadByte(); next != '[' {
+			return keyEsc, nil
+		}
+
+		switch code, _ := u.in.ReadByte(); code {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		}
+
+		return keyEsc, nil
+	}
+
+	if b < utf8.RuneSelf {
+		return string(b), nil
+	}
+
+	// a multi byte character, typed into a prompt
+	u.in.UnreadByte()
+	r, _, err := u.in.ReadRune()
+	return string(r), err
+}
+
+// prompt reads a line of input on the bottom row. ok is false if it was cancelled
+func (u *UI) prompt(label string) (line string, ok bool) {
+	for {
+		u.draw()
+		fmt.Fprintf(u.out, "\x1b[%d;1H\x1b[2K%s%s", u.Height, label, line)
+
+		key, err := u.readKey()
+		if err != nil {
+			return "", false
+		}
+
+		switch key {
+		case keyEnter:
+			return line, true
+		case keyEsc, keyCtrlC:
+			return "", false
+		case keyBack:
+			if r := []rune(line); len(r) > 0 {
+				line = string(r[:len(r)-1])
+			}
+		case keyUp, keyDown, keyTab:
+		default:
+			line += key
+		}
+	}
+}
+
+// handle reacts to a key, returning true when the UI should exit
+func (u *UI) handle(key string) bool {
+	u.message = ""
+
+	if key == keyCtrlC {
+		return true
+	}
+
+	if u.view == listView {
+		return u.handleList(key)
+	}
+
+	u.handleTicket(key)
+	return false
+}
+
+func (u *UI) handleList(key string) bool {
+	switch key {
+	case "q":
+		return true
+	case "j", keyDown:
+		if u.selected < len(u.tickets)-1 {
+			u.selected++
+		}
+	case "k", keyUp:
+		if u.selected > 0 {
+			u.selected--
+		}
+	case keyTab:
+		u.listing = (u.listing + 1) % len(listings)
+		u.refresh()
+	case "r":
+		u.refresh()
+	case keyEnter:
+		u.open()
+	}
+
+	return false
+}
+
+func (u *UI) handleTicket(key string) {
+	switch key {
+	case "q", keyEsc:
+		u.view = listView
+	case "j", keyDown:
+		u.scroll++
+	case "k", keyUp:
+		if u.scroll > 0 {
+			u.scroll--
+		}
+	case "t":
+		u.tag()
+	case "R":
+		u.reply()
+	case "d":
+		u.download()
+	}
+}
+
+func (u *UI) refresh() {
+	tickets, err := listings[u.listing].fetch(u.client, u.mailboxID)
+	if err != nil {
+		u.message = "error: " + err.Error()
+		return
+	}
+
+	u.tickets = tickets
+	if u.selected >= len(tickets) {
+		u.selected = len(tickets) - 1
+	}
+	if u.selected < 0 {
+		u.selected = 0
+	}
+}
+
+func (u *UI) current() *snappy.Ticket {
+	if u.selected < len(u.tickets) {
+		return &u.tickets[u.selected]
+	}
+	return nil
+}
+
+func (u *UI) open() {
+	t := u.current()
+	if t == nil {
+		return
+	}
+
+	notes, err := u.client.TicketNotes(t.ID)
+	if err != nil {
+		u.message = "error: " + err.Error()
+		return
+	}
+
+	u.notes = notes
+	u.scroll = 0
+	u.view = ticketView
+}
+
+func (u *UI) tag() {
+	t := u.current()
+
+	line, ok := u.prompt("tags (+add -remove): ")
+	if !ok || strings.TrimSpace(line) == "" {
+		return
+	}
+
+	tags := append([]string{}, t.Tags...)
+	for _, change := range strings.Fields(line) {
+		if strings.HasPrefix(change, "-") {
+			tags = without(tags, change[1:])
+			continue
+		}
+
+		tag := strings.TrimPrefix(change, "+")
+		tags = append(without(tags, tag), tag)
+	}
+
+	if err := u.client.UpdateTags(t.ID, tags...); err != nil {
+		u.message = "error: " + err.Error()
+		return
+	}
+
+	t.Tags = tags
+	u.message = "tags updated"
+}
+
+func without(tags []string, tag string) []string {
+	result := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t != tag {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func (u *UI) reply() {
+	t := u.current()
+
+	line, ok := u.prompt("reply: ")
+	if !ok || strings.TrimSpace(line) == "" {
+		return
+	}
+
+	_, err := u.client.ReplyToTicket(*t, html.EscapeString(line), snappy.ReplyOptions{StaffID: u.StaffID, CheckConflicts: true})
+
+	if conflict, ok := err.(*snappy.ConflictError); ok {
+		*t = conflict.Ticket
+		u.open()
+		u.message = "reply not sent, the ticket has new notes since it was loaded"
+		return
+	}
+
+	// the reply went out even if its note wasn't found
+	if err != nil && err != snappy.ErrNoteNotFound {
+		u.message = "error: " + err.Error()
+		return
+	}
+
+	u.open()
+	u.message = "reply sent"
+}
+
+func (u *UI) attachments() []snappy.Document {
+	var documents []snappy.Document
+	for _, n := range u.notes {
+		documents = append(documents, n.Attachments...)
+	}
+	return documents
+}
+
+func (u *UI) download() {
+	t := u.current()
+	documents := u.attachments()
+
+	if len(documents) == 0 {
+		u.message = "no attachments"
+		return
+	}
+
+	line, ok := u.prompt(fmt.Sprintf("attachment to download (1-%d): ", len(documents)))
+	if !ok {
+		return
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || n < 1 || n > len(documents) {
+		u.message = "no such attachment"
+		return
+	}
+
+	doc := documents[n-1]
+	path := filepath.Join(u.DownloadDir, filepath.Base(doc.Filename))
+
+	if err := u.save(t.ID, doc.ID, path); err != nil {
+		u.message = "error: " + err.Error()
+		return
+	}
+
+	u.message = "saved " + path
+}
+
+func (u *UI) save(ticketID, attachmentID int, path string) error {
+	rc, err := u.client.DownloadTicketAttachment(ticketID, attachmentID)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, rc); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// printable replaces the control characters in s, which customers could use
+// to move the cursor or change the terminal's settings. Newlines are kept
+func printable(s string) string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n':
+			return r
+		case r == '\t':
+			return ' '
+		case r < 0x20, r >= 0x7f && r < 0xa0:
+			return '\uFFFD'
+		}
+		return r
+	}, s)
+}
+
+// fitLine makes s a single printable line and cuts it to the terminal width
+func (u *UI) fitLine(s string) string {
+	s = strings.Replace(printable(s), "\n", " ", -1)
+
+	if utf8.RuneCountInString(s) <= u.Width {
+		return s
+	}
+	return string([]rune(s)[:u.Width])
+}
+
+func (u *UI) draw() {
+	var lines []string
+	var header, footer string
+
+	switch u.view {
+	case listView:
+		header = fmt.Sprintf("mailbox %d: %s (%d)", u.mailboxID, listings[u.listing].name, len(u.tickets))
+		footer = "j/k move  enter open  tab inbox/yours  r refresh  q quit"
+		lines = u.listLines()
+	case ticketView:
+		t := u.current()
+		header = fmt.Sprintf("#%d %s [%s] %s", t.ID, t.DefaultSubject, t.Status, strings.Join(t.Tags, " "))
+		footer = "j/k scroll  t tags  R reply  d download  q back"
+		lines = u.ticketLines()
+	}
+
+	if u.message != "" {
+		footer = u.message
+	}
+
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	b.WriteString(bold + u.fitLine(header) + reset + "\r\n")
+
+	for _, line := range lines {
+		b.WriteString(line + "\r\n")
+	}
+
+	fmt.Fprintf(&b, "\x1b[%d;1H%s", u.Height, u.fitLine(footer))
+	io.WriteString(u.out, b.String())
+}
+
+func (u *UI) listLines() []string {
+	rows := u.Height - 2
+
+	if u.selected < u.top {
+		u.top = u.selected
+	}
+	if u.selected >= u.top+rows {
+		u.top = u.selected - rows + 1
+	}
+
+	var lines []string
+	for i := u.top; i < len(u.tickets) && i < u.top+rows; i++ {
+		t := u.tickets[i]
+		line := u.fitLine(fmt.Sprintf("%-8d %-8s %s  %s", t.ID, t.Status, t.Summary, strings.Join(t.Tags, " ")))
+
+		if i == u.selected {
+			line = reverse + line + reset
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func (u *UI) ticketLines() []string {
+	var all []string
+	attachment := 0
+
+	for _, n := range u.notes {
+		from := strings.TrimSpace(n.Creator.FirstName + " " + n.Creator.LastName)
+		all = append(all, bold+u.fitLine(fmt.Sprintf("%s <%s> (%s)", from, n.Creator.Address, n.Scope))+reset)
+
+		for _, line := range strings.Split(printable(render.NoteText(n)), "\n") {
+			for utf8.RuneCountInString(line) > u.Width {
+				r := []rune(line)
+				all = append(all, string(r[:u.Width]))
+				line = string(r[u.Width:])
+			}
+			all = append(all, line)
+		}
+
+		for _, a := range n.Attachments {
+			attachment++
+			all = append(all, u.fitLine(fmt.Sprintf("[%d] %s (%d bytes)", attachment, a.Filename, a.Size)))
+		}
+
+		all = append(all, "")
+	}
+
+	rows := u.Height - 2
+	if max := len(all) - rows; u.scroll > max {
+		u.scroll = max
+	}
+	if u.scroll < 0 {
+		u.scroll = 0
+	}
+
+	end := u.scroll + rows
+	if end > len(all) {
+		end = len(all)
+	}
+
+	return all[u.scroll:end]
+}
@@ -0,0 +1,177 @@
+package triage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/derekpitt/snappy"
+)
+
+var (
+	mux    *http.ServeMux
+	server *httptest.Server
+	client *snappy.Snappy
+)
+
+func setup() {
+	mux = http.NewServeMux()
+	server = httptest.NewServer(mux)
+
+	client = snappy.WithAPIKey("apikey")
+	client.SetEndpointPrefix(server.URL)
+}
+
+func teardown() {
+	server.Close()
+}
+
+func TestTriageSession(t *testing.T) {
+	setup()
+	defer teardown()
+
+	dir, err := ioutil.TempDir("", "triage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mux.HandleFunc("/mailbox/1/inbox", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"id":1,"status":"new","summary":"first\u001b]0;pwned\u0007"},
+			{"id":2,"mailbox_id":1,"status":"new","summary":"second","nonce":"abc","default_subject":"Help","tags":["#support"]}
+		]`)
+	})
+
+	yours := false
+	mux.HandleFunc("/mailbox/1/yours", func(w http.ResponseWriter, r *http.Request) {
+		yours = true
+		fmt.Fprintf(w, `[]`)
+	})
+
+	mux.HandleFunc("/ticket/2/notes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{
+			"id":5,
+			"content":"<p>My printer is &quot;broken&quot;\u001b[6n</p>",
+			"creator":{"first_name":"Test","last_name":"1","address":"test@test.com"},
+			"attachments":[{"id":9,"filename":"photo.jpg","size":8}]
+		}]`)
+	})
+
+	var gotTags []string
+	mux.HandleFunc("/ticket/2/tags", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		values, _ := url.ParseQuery(string(b))
+		json.Unmarshal([]byte(values.Get("tags")), &gotTags)
+	})
+
+	mux.HandleFunc("/ticket/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":2,"mailbox_id":1,"status":"new","nonce":"abc","default_subject":"Help","tags":["#support","#billing"]}`)
+	})
+
+	var gotNote snappy.NewNote
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&gotNote)
+	})
+
+	mux.HandleFunc("/ticket/2/attachment/9/download", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hey now!")
+	})
+
+	keys := strings.Join([]string{
+		"\x1b[B",       // down to the second ticket
+		"\r",           // open it
+		"t+#billing\r", // add a tag
+		"Rthanks <3\r", // reply
+		"d1\r",         // download the first attachment
+		"q",            // back to the list
+		"\t",           // switch to yours
+		"q",            // quit
+	}, "")
+
+	var screen bytes.Buffer
+	ui := New(client, 1, strings.NewReader(keys), &screen)
+	ui.DownloadDir = dir
+
+	if err := ui.Run(); err != nil {
+		t.Fatalf("Expected no error in Run(): %v", err)
+	}
+
+	if !strings.Contains(screen.String(), `My printer is "broken"`) {
+		t.Error("expected the note to be drawn as text")
+	}
+
+	if strings.Contains(screen.String(), "\x1b]0;") || strings.Contains(screen.String(), "\x07") || strings.Contains(screen.String(), "\x1b[6n") {
+		t.Error("expected the control characters in the summary and note to be replaced")
+	}
+
+	if expected := []string{"#support", "#billing"}; reflect.DeepEqual(expected, gotTags) == false {
+		t.Errorf("expected tags %v, got %v", expected, gotTags)
+	}
+
+	if gotNote.TicketNonce != "abc" || gotNote.Message != "thanks &lt;3" || gotNote.MailboxID != 1 {
+		t.Errorf("unexpected reply %+v", gotNote)
+	}
+
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "photo.jpg")); string(b) != "hey now!" {
+		t.Errorf("expected the attachment to be saved, got %q", b)
+	}
+
+	if !yours {
+		t.Error("expected tab to load your tickets")
+	}
+}
+
+func TestTriageShowsErrors(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	var screen bytes.Buffer
+	if err := New(client, 1, strings.NewReader("q"), &screen).Run(); err != nil {
+		t.Fatalf("Expected no error in Run(): %v", err)
+	}
+
+	if !strings.Contains(screen.String(), "error: Status NOT OK") {
+		t.Error("expected the error on the status line")
+	}
+}
+
+func TestTriageReplyConflict(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/mailbox/1/inbox", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":2,"mailbox_id":1,"nonce":"abc","last_reply_at":100}]`)
+	})
+	mux.HandleFunc("/ticket/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":2,"mailbox_id":1,"nonce":"abc","last_reply_at":200}`)
+	})
+	mux.HandleFunc("/ticket/2/notes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":5,"created_at":100,"content":"help"},{"id":6,"created_at":200,"created_by_staff_id":3,"content":"on it"}]`)
+	})
+	mux.HandleFunc("/note", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the reply not to be sent")
+	})
+
+	var screen bytes.Buffer
+	if err := New(client, 1, strings.NewReader("\rRthanks!\rqq"), &screen).Run(); err != nil {
+		t.Fatalf("Expected no error in Run(): %v", err)
+	}
+
+	if !strings.Contains(screen.String(), "reply not sent, the ticket has new notes since it was loaded") {
+		t.Error("expected the conflict on the status line")
+	}
+}
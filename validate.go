@@ -0,0 +1,179 @@
+package snappy
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits checked by Validate, in characters
+const (
+	MaxSubjectLength  = 255
+	MaxMessageLength  = 1 << 20
+	MaxWallPostLength = 10000
+	MaxNameLength     = 255
+	MaxTagLength      = 50
+)
+
+// FieldError is a problem with one field
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError is returned by Validate, and by CreateNote and
+// CreateWallPost before sending anything, with every problem found
+type ValidationError struct {
+	What   string
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		problems[i] = f.Error()
+	}
+	return fmt.Sprintf("snappy: invalid %s: %s", e.What, strings.Join(problems, "; "))
+}
+
+// add records a problem with a field
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns e if it has any problems, so callers don't get a non-nil
+// error interface holding a nil pointer
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// IsValidationError reports whether err is a ValidationError
+func IsValidationError(err error) bool {
+	_, ok := err.(*ValidationError)
+	return ok
+}
+
+// length checks that a field is no longer than max characters
+func (e *ValidationError) length(field, value string, max int) {
+	if n := utf8.RuneCountInString(value); n > max {
+		e.add(field, "%d characters, the most is %d", n, max)
+	}
+}
+
+// Validate checks a note before it is sent. Replies need a message and the
+// ticket's nonce; new tickets need a subject, message and mailbox instead
+func (n NewNote) Validate() error {
+	v := &ValidationError{What: "note"}
+
+	if strings.TrimSpace(n.Message) == "" {
+		v.add("message", "required")
+	}
+	v.length("message", n.Message, MaxMessageLength)
+
+	if n.TicketNonce == "" {
+		if strings.TrimSpace(n.Subject) == "" {
+			v.add("subject", "required for a new ticket")
+		}
+		if n.MailboxID == 0 {
+			v.add("mailbox_id", "required for a new ticket")
+		}
+	}
+	if strings.ContainsAny(n.Subject, "\r\n") {
+		v.add("subject", "has a line break")
+	}
+	v.length("subject", n.Subject, MaxSubjectLength)
+
+	if n.MailboxID < 0 {
+		v.add("mailbox_id", "negative")
+	}
+	if n.StaffID < 0 {
+		v.add("staff_id", "negative")
+	}
+
+	v.addresses("to", n.To)
+	v.addresses("from", n.From)
+
+	return v.err()
+}
+
+// addresses checks each address is a bare email address, as net/mail parses
+// it, with the name kept separately
+func (e *ValidationError) addresses(field string, addresses []NoteAddress) {
+	for i, a := range addresses {
+		prefix := fmt.Sprintf("%s[%d].", field, i)
+
+		if strings.ContainsAny(a.Name, "\r\n") {
+			e.add(prefix+"name", "has a line break")
+		}
+		e.length(prefix+"name", a.Name, MaxNameLength)
+
+		if a.Address == "" {
+			e.add(prefix+"address", "required")
+			continue
+		}
+
+		parsed, err := mail.ParseAddress(a.Address)
+		if err != nil {
+			e.add(prefix+"address", "%q: %v", a.Address, err)
+		} else if parsed.Address != a.Address {
+			e.add(prefix+"address", "%q should be just the address, put the name in name", a.Address)
+		}
+	}
+}
+
+// Validate checks a wall post before it is sent
+func (p NewWallPost) Validate() error {
+	v := &ValidationError{What: "wall post"}
+
+	if strings.TrimSpace(p.Content) == "" {
+		v.add("content", "required")
+	}
+	v.length("content", p.Content, MaxWallPostLength)
+
+	for i, tag := range p.Tags {
+		if problem := checkTag(tag); problem != "" {
+			v.add(fmt.Sprintf("tags[%d]", i), "%q %s", tag, problem)
+		}
+	}
+
+	if p.TicketID < 0 {
+		v.add("ticket", "negative")
+	}
+	if p.NoteID < 0 {
+		v.add("note", "negative")
+	}
+
+	return v.err()
+}
+
+// checkTag describes what is wrong with a tag: it may start with "#" or "@"
+// and has no spaces or commas
+func checkTag(tag string) string {
+	name := strings.TrimLeft(tag, "#@")
+
+	switch {
+	case tag == "":
+		return "is empty"
+	case len(tag)-len(name) > 1:
+		return "starts with more than one # or @"
+	case name == "":
+		return "has no name"
+	case strings.ContainsAny(name, "#@,"):
+		return "has a # , or @ after the start"
+	case strings.IndexFunc(name, unicode.IsSpace) >= 0:
+		return "has a space"
+	case utf8.RuneCountInString(tag) > MaxTagLength:
+		return fmt.Sprintf("is longer than %d characters", MaxTagLength)
+	}
+
+	return ""
+}
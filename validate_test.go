@@ -0,0 +1,94 @@
+package snappy
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func fields(err error) (result []string) {
+	if err == nil {
+		return
+	}
+	for _, f := range err.(*ValidationError).Fields {
+		result = append(result, f.Field)
+	}
+	return
+}
+
+func TestValidateNote(t *testing.T) {
+	cases := []struct {
+		note     NewNote
+		expected []string
+	}{
+		{NewNote{Message: "hi", TicketNonce: "abc"}, nil},
+		{NewNote{Subject: "Help", Message: "hi", MailboxID: 1, To: []NoteAddress{{Name: "Test 1", Address: "test@test.com"}}}, nil},
+		{NewNote{}, []string{"message", "subject", "mailbox_id"}},
+		{NewNote{Subject: "a\nb", Message: " ", TicketNonce: "abc", StaffID: -1}, []string{"message", "subject", "staff_id"}},
+		{NewNote{Subject: strings.Repeat("é", MaxSubjectLength+1), Message: "hi", MailboxID: 1}, []string{"subject"}},
+		{NewNote{Message: "hi", TicketNonce: "abc", To: []NoteAddress{
+			{Address: "test@test.com"},
+			{Name: "No Address"},
+			{Address: "not an address"},
+			{Address: "Test <test@test.com>"},
+		}, From: []NoteAddress{{Name: "a\r\nBcc: x", Address: "test@test.com"}}}, []string{"to[1].address", "to[2].address", "to[3].address", "from[0].name"}},
+	}
+
+	for _, c := range cases {
+		err := c.note.Validate()
+		if got := fields(err); reflect.DeepEqual(c.expected, got) == false {
+			t.Errorf("%+v: expected problems with %v, got %v", c.note, c.expected, err)
+		}
+	}
+}
+
+func TestValidateWallPost(t *testing.T) {
+	cases := []struct {
+		post     NewWallPost
+		expected []string
+	}{
+		{NewWallPost{Content: "hi", Type: "post", Tags: []string{"test1", "#billing", "@sam"}}, nil},
+		{NewWallPost{Content: " ", TicketID: -1}, []string{"content", "ticket"}},
+		{NewWallPost{Content: strings.Repeat("a", MaxWallPostLength+1)}, []string{"content"}},
+		{NewWallPost{Content: "hi", Tags: []string{"", "##a", "#", "a,b", "two words", "#" + strings.Repeat("a", MaxTagLength)}},
+			[]string{"tags[0]", "tags[1]", "tags[2]", "tags[3]", "tags[4]", "tags[5]"}},
+	}
+
+	for _, c := range cases {
+		err := c.post.Validate()
+		if got := fields(err); reflect.DeepEqual(c.expected, got) == false {
+			t.Errorf("%+v: expected problems with %v, got %v", c.post, c.expected, err)
+		}
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	err := NewNote{To: []NoteAddress{{Address: "nope"}}}.Validate()
+
+	if !IsValidationError(err) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+
+	expected := `snappy: invalid note: message: required; subject: required for a new ticket; mailbox_id: required for a new ticket; to[0].address: "nope": mail: missing '@' or angle-addr`
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestCreateValidatesFirst(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected no request, got %s %s", r.Method, r.URL.Path)
+	})
+
+	if err := client.CreateNote(NewNote{TicketNonce: "abc"}); !IsValidationError(err) {
+		t.Errorf("Expected a ValidationError from CreateNote(), got %v", err)
+	}
+
+	if err := client.CreateWallPost(1, NewWallPost{Type: "post"}); !IsValidationError(err) {
+		t.Errorf("Expected a ValidationError from CreateWallPost(), got %v", err)
+	}
+}